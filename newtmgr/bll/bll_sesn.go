@@ -439,6 +439,14 @@ func (s *BllSesn) CoapIsTcp() bool {
 	return true
 }
 
+func (s *BllSesn) Capabilities() sesn.SesnCaps {
+	return sesn.SesnCaps{
+		Observe:    true,
+		Reconnect:  true,
+		MaxPayload: s.MtuOut(),
+	}
+}
+
 func (s *BllSesn) Filters() (nmcoap.MsgFilter, nmcoap.MsgFilter) {
 	return s.txvr.Filters()
 }
@@ -25,14 +25,41 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const BLE_ATT_ATTR_MAX_LEN = 512
 
 const BLE_ATT_MTU_DFLT = 23
 
+// Size of the ATT write request / command header (opcode and handle).
+const BLE_ATT_WRITE_HDR_SZ = 3
+
+// Bounds on the connection supervision timeout (Core spec, Vol 6, Part B,
+// 4.5.2).  The controller expresses the timeout in units of 10 ms.
+const BLE_SUPERVISION_TMO_UNIT = 10 * time.Millisecond
+const BLE_SUPERVISION_TMO_MIN = 100 * time.Millisecond
+const BLE_SUPERVISION_TMO_MAX = 32 * time.Second
+
+// Connection parameters requested by a connect procedure.  Intervals are in
+// units of 1.25 ms.
+const BLE_CONN_ITVL_UNIT = 1250 * time.Microsecond
+const BLE_CONN_ITVL_MIN_DFLT = 24
+const BLE_CONN_ITVL_MAX_DFLT = 40
+const BLE_CONN_LATENCY_DFLT = 0
+
+// Calculates the value that a supervision timeout must exceed for a
+// connection with the specified parameters: (1 + latency) * max-interval * 2
+// (Core spec, Vol 6, Part B, 4.5.2).
+func SupervisionTmoFloor(itvlMax int, latency int) time.Duration {
+	return time.Duration((1+latency)*itvlMax*2) * BLE_CONN_ITVL_UNIT
+}
+
 const CccdUuid = 0x2902
 
+const GattSvcUuid = 0x1801
+const SvcChgChrUuid = 0x2a05
+
 const IotivitySvcUuid = "ade3d529-c784-4f63-a987-eb69f70ee816"
 const IotivityReqChrUuid = "ad7b334f-4637-4b86-90b6-9d787f03d218"
 const IotivityRspChrUuid = "e9241982-4580-42c4-8831-95048216b256"
@@ -390,6 +417,11 @@ const (
 	BLE_ADV_EVENT_DIRECT_IND_LD                 = 4
 )
 
+// In a received advertisement report (as opposed to an advertise
+// procedure), event type 4 indicates a scan response rather than a low duty
+// cycle directed advertisement.
+const BLE_ADV_EVENT_SCAN_RSP BleAdvEventType = 4
+
 var BleAdvEventTypeStringMap = map[BleAdvEventType]string{
 	BLE_ADV_EVENT_IND:           "ind",
 	BLE_ADV_EVENT_DIRECT_IND_HD: "direct_ind_hd",
@@ -619,12 +651,101 @@ type BleAdvReport struct {
 	Sender    BleDev
 	Rssi      int8
 
+	// The undecoded payload of the report.  blehostd delivers scan
+	// responses as separate reports, so exactly one of these is populated:
+	// RawScanRsp for a scan response, RawAdv for everything else.
+	RawAdv     []byte
+	RawScanRsp []byte
+
 	Fields BleAdvFields
 }
 
 type BleAdvRptFn func(r BleAdvReport)
 type BleAdvPredicate func(adv BleAdvReport) bool
 
+// Creates an advertisement predicate that matches a report from any of the
+// specified devices.
+func BleDevListPredicate(devs []BleDev) BleAdvPredicate {
+	return func(adv BleAdvReport) bool {
+		for _, d := range devs {
+			if adv.Sender == d {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Selects a peer by the contents of its advertisement rather than its
+// address.  This is useful for devices that use rotating random addresses.
+// Every criterion that is set must match.
+type BleAdvCriteria struct {
+	// Service data: the service UUID (16- or 128-bit), and a prefix that
+	// the accompanying data must start with.  An empty prefix matches any
+	// data for the UUID.
+	SvcDataUuid *BleUuid
+	SvcData     []byte
+
+	// A prefix that the manufacturer-specific data must start with.  The
+	// first two bytes of the data are the little-endian company ID.
+	MfgData []byte
+}
+
+// Encodes a UUID as it appears at the start of a service data field.
+func svcDataUuidBytes(uuid BleUuid) []byte {
+	if uuid.U16 != 0 {
+		return []byte{byte(uuid.U16), byte(uuid.U16 >> 8)}
+	}
+
+	// 128-bit UUIDs are transmitted in little-endian order.
+	b := make([]byte, len(uuid.U128))
+	for i, v := range uuid.U128 {
+		b[len(b)-1-i] = v
+	}
+	return b
+}
+
+func (c *BleAdvCriteria) Match(adv BleAdvReport) bool {
+	if c.SvcDataUuid != nil {
+		field := adv.Fields.SvcDataUuid128
+		if c.SvcDataUuid.U16 != 0 {
+			field = adv.Fields.SvcDataUuid16
+		}
+
+		prefix := append(svcDataUuidBytes(*c.SvcDataUuid), c.SvcData...)
+		if !bytes.HasPrefix(field, prefix) {
+			return false
+		}
+	}
+
+	if len(c.MfgData) > 0 &&
+		!bytes.HasPrefix(adv.Fields.MfgData, c.MfgData) {
+
+		return false
+	}
+
+	return true
+}
+
+// Creates an advertisement predicate from the criteria.
+func (c *BleAdvCriteria) Predicate() BleAdvPredicate {
+	return c.Match
+}
+
+func (c *BleAdvCriteria) String() string {
+	var parts []string
+
+	if c.SvcDataUuid != nil {
+		parts = append(parts, fmt.Sprintf("svc_data=%s:%x",
+			c.SvcDataUuid.String(), c.SvcData))
+	}
+	if len(c.MfgData) > 0 {
+		parts = append(parts, fmt.Sprintf("mfg_data=%x", c.MfgData))
+	}
+
+	return strings.Join(parts, " ")
+}
+
 type BleRole int
 
 const (
@@ -647,6 +768,19 @@ type BleConnDesc struct {
 	Authenticated   bool
 	Bonded          bool
 	KeySize         int
+
+	// Summarized link health, from 0 (unusable) to 100 (healthy).  Only
+	// populated for descriptors of active connections; see
+	// nmble.Conn.Quality() for the heuristic.
+	Quality int
+
+	// Connection supervision timeout currently in effect.  Zero if unknown.
+	SupervisionTimeout time.Duration
+
+	// If the peer was selected by scanning, the advertisement that matched
+	// and a description of the advertisement criteria, if any.
+	MatchedAdv      *BleAdvReport
+	MatchedCriteria string
 }
 
 func (d *BleConnDesc) String() string {
@@ -670,6 +804,24 @@ const (
 	BLE_ENCRYPT_NEVER BleEncryptWhen = iota
 	BLE_ENCRYPT_AS_REQD
 	BLE_ENCRYPT_ALWAYS
+
+	// Like BLE_ENCRYPT_ALWAYS, but if the peer rejects pairing, the
+	// connection proceeds unencrypted rather than failing.
+	BLE_ENCRYPT_PREFER
+)
+
+// Selects the ATT operation used to send requests to a characteristic.
+type BleWriteType int
+
+const (
+	// Use the session-wide setting (SesnCfgBle.WriteRsp).
+	BLE_WRITE_TYPE_DFLT BleWriteType = iota
+
+	// Write request; the peer acknowledges each write.
+	BLE_WRITE_TYPE_RSP
+
+	// Write command; no acknowledgement.
+	BLE_WRITE_TYPE_NO_RSP
 )
 
 type BleGattOp int
@@ -802,6 +954,55 @@ const (
 	BLE_DISC_CHR_PROP_EXTENDED                             = 0x80
 )
 
+var bleDiscChrPropNames = []struct {
+	prop BleDiscChrProperties
+	name string
+}{
+	{BLE_DISC_CHR_PROP_BROADCAST, "broadcast"},
+	{BLE_DISC_CHR_PROP_READ, "read"},
+	{BLE_DISC_CHR_PROP_WRITE_NO_RSP, "write_no_rsp"},
+	{BLE_DISC_CHR_PROP_WRITE, "write"},
+	{BLE_DISC_CHR_PROP_NOTIFY, "notify"},
+	{BLE_DISC_CHR_PROP_INDICATE, "indicate"},
+	{BLE_DISC_CHR_PROP_AUTH_SIGN_WRITE, "auth_sign_write"},
+	{BLE_DISC_CHR_PROP_EXTENDED, "extended"},
+}
+
+func (p BleDiscChrProperties) CanRead() bool {
+	return p&BLE_DISC_CHR_PROP_READ != 0
+}
+
+func (p BleDiscChrProperties) CanWrite() bool {
+	return p&BLE_DISC_CHR_PROP_WRITE != 0
+}
+
+func (p BleDiscChrProperties) CanWriteNoRsp() bool {
+	return p&BLE_DISC_CHR_PROP_WRITE_NO_RSP != 0
+}
+
+func (p BleDiscChrProperties) CanNotify() bool {
+	return p&BLE_DISC_CHR_PROP_NOTIFY != 0
+}
+
+func (p BleDiscChrProperties) CanIndicate() bool {
+	return p&BLE_DISC_CHR_PROP_INDICATE != 0
+}
+
+// Lists the set properties, separated by "|" (e.g., "read|notify").
+func (p BleDiscChrProperties) String() string {
+	var names []string
+	for _, pn := range bleDiscChrPropNames {
+		if p&pn.prop != 0 {
+			names = append(names, pn.name)
+		}
+	}
+
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
 type BleGattAccess struct {
 	Op         BleGattOp
 	ConnHandle uint16
@@ -851,6 +1052,17 @@ func CompareChrIds(a BleChrId, b BleChrId) int {
 	return 0
 }
 
+// Selects the standard GATT characteristic pair that carries CoAP resource
+// requests and responses.
+type BleResSecLevel int
+
+const (
+	// The Iotivity service; the default.
+	BLE_RES_SEC_PUBLIC BleResSecLevel = iota
+	BLE_RES_SEC_UNAUTH
+	BLE_RES_SEC_SECURE
+)
+
 type BleMgmtChrs struct {
 	NmpReqChr *BleChrId
 	NmpRspChr *BleChrId
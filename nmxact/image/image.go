@@ -0,0 +1,309 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Parses Mynewt image files.
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+const (
+	IMAGE_MAGIC_V1      = 0x96f3b83c
+	IMAGE_MAGIC_V2      = 0x96f3b83d
+	IMAGE_TRAILER_MAGIC = 0x6907
+)
+
+const IMAGE_HEADER_SIZE = 32
+const IMAGE_TLV_HDR_SIZE = 4
+const IMAGE_TRAILER_SIZE = 4
+
+// TLV types used by version 1 images.
+const (
+	IMAGE_TLV_V1_SHA256   = 1
+	IMAGE_TLV_V1_RSA2048  = 2
+	IMAGE_TLV_V1_ECDSA224 = 3
+	IMAGE_TLV_V1_ECDSA256 = 4
+)
+
+// TLV types used by version 2 images.
+const (
+	IMAGE_TLV_KEYHASH  = 0x01
+	IMAGE_TLV_SHA256   = 0x10
+	IMAGE_TLV_RSA2048  = 0x20
+	IMAGE_TLV_ECDSA224 = 0x21
+	IMAGE_TLV_ECDSA256 = 0x22
+)
+
+const IMAGE_HASH_LEN = 32
+
+type ImageVersion struct {
+	Major    uint8
+	Minor    uint8
+	Rev      uint16
+	BuildNum uint32
+}
+
+type ImageTlv struct {
+	Type uint8
+	Data []byte
+}
+
+type ImageInfo struct {
+	HdrVer  int // Image header format; 1 or 2.
+	Version ImageVersion
+	Flags   uint32
+	HdrSz   int // Size of the header, including padding.
+	BodySz  int // Size of the image body.
+
+	// Value of the SHA256 TLV; this is the hash the device reports for the
+	// image.  Nil if the image does not contain a SHA256 TLV.
+	Hash []byte
+
+	Tlvs []ImageTlv
+}
+
+// On-disk header of a version 1 image.
+type imageHdrV1 struct {
+	Magic uint32
+	TlvSz uint16
+	KeyId uint8
+	Pad1  uint8
+	HdrSz uint16
+	Pad2  uint16
+	ImgSz uint32
+	Flags uint32
+	Vers  ImageVersion
+	Pad3  uint32
+}
+
+// On-disk header of a version 2 image.
+type imageHdrV2 struct {
+	Magic uint32
+	Pad1  uint32
+	HdrSz uint16
+	Pad2  uint16
+	ImgSz uint32
+	Flags uint32
+	Vers  ImageVersion
+	Pad3  uint32
+}
+
+type imageTlvHdr struct {
+	Type uint8
+	Pad  uint8
+	Len  uint16
+}
+
+type imageTrailer struct {
+	Magic     uint16
+	TlvTotLen uint16
+}
+
+func (v ImageVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d.%d", v.Major, v.Minor, v.Rev, v.BuildNum)
+}
+
+// Retrieves the first TLV of the specified type, or nil if there is none.
+func (info *ImageInfo) FindTlv(tlvType uint8) *ImageTlv {
+	for i := range info.Tlvs {
+		if info.Tlvs[i].Type == tlvType {
+			return &info.Tlvs[i]
+		}
+	}
+
+	return nil
+}
+
+// Parses a sequence of TLVs occupying the entirety of the specified buffer.
+func parseTlvs(b []byte) ([]ImageTlv, error) {
+	var tlvs []ImageTlv
+
+	for len(b) > 0 {
+		if len(b) < IMAGE_TLV_HDR_SIZE {
+			return nil, fmt.Errorf("Truncated image TLV header")
+		}
+
+		var hdr imageTlvHdr
+		if err := binary.Read(bytes.NewReader(b), binary.LittleEndian,
+			&hdr); err != nil {
+
+			return nil, err
+		}
+		b = b[IMAGE_TLV_HDR_SIZE:]
+
+		if int(hdr.Len) > len(b) {
+			return nil, fmt.Errorf("Truncated image TLV; type=%d len=%d "+
+				"remaining=%d", hdr.Type, hdr.Len, len(b))
+		}
+
+		tlvs = append(tlvs, ImageTlv{
+			Type: hdr.Type,
+			Data: b[:hdr.Len],
+		})
+		b = b[hdr.Len:]
+	}
+
+	return tlvs, nil
+}
+
+func parseV1(b []byte) (*ImageInfo, error) {
+	var hdr imageHdrV1
+	if err := binary.Read(bytes.NewReader(b), binary.LittleEndian,
+		&hdr); err != nil {
+
+		return nil, err
+	}
+
+	tlvOff := int(hdr.HdrSz) + int(hdr.ImgSz)
+	tlvEnd := tlvOff + int(hdr.TlvSz)
+	if tlvEnd > len(b) {
+		return nil, fmt.Errorf("Image truncated; expected=%d actual=%d",
+			tlvEnd, len(b))
+	}
+
+	tlvs, err := parseTlvs(b[tlvOff:tlvEnd])
+	if err != nil {
+		return nil, err
+	}
+
+	info := &ImageInfo{
+		HdrVer:  1,
+		Version: hdr.Vers,
+		Flags:   hdr.Flags,
+		HdrSz:   int(hdr.HdrSz),
+		BodySz:  int(hdr.ImgSz),
+		Tlvs:    tlvs,
+	}
+
+	if tlv := info.FindTlv(IMAGE_TLV_V1_SHA256); tlv != nil {
+		info.Hash = tlv.Data
+	}
+
+	return info, nil
+}
+
+func parseV2(b []byte) (*ImageInfo, error) {
+	var hdr imageHdrV2
+	if err := binary.Read(bytes.NewReader(b), binary.LittleEndian,
+		&hdr); err != nil {
+
+		return nil, err
+	}
+
+	trailerOff := int(hdr.HdrSz) + int(hdr.ImgSz)
+	if trailerOff+IMAGE_TRAILER_SIZE > len(b) {
+		return nil, fmt.Errorf("Image truncated; expected>=%d actual=%d",
+			trailerOff+IMAGE_TRAILER_SIZE, len(b))
+	}
+
+	var trailer imageTrailer
+	if err := binary.Read(bytes.NewReader(b[trailerOff:]),
+		binary.LittleEndian, &trailer); err != nil {
+
+		return nil, err
+	}
+
+	if trailer.Magic != IMAGE_TRAILER_MAGIC {
+		return nil, fmt.Errorf("Invalid image trailer magic: 0x%04x",
+			trailer.Magic)
+	}
+
+	// The total TLV length includes the trailer itself.
+	if int(trailer.TlvTotLen) < IMAGE_TRAILER_SIZE {
+		return nil, fmt.Errorf("Invalid image TLV length: %d",
+			trailer.TlvTotLen)
+	}
+	tlvEnd := trailerOff + int(trailer.TlvTotLen)
+	if tlvEnd > len(b) {
+		return nil, fmt.Errorf("Image truncated; expected=%d actual=%d",
+			tlvEnd, len(b))
+	}
+
+	tlvs, err := parseTlvs(b[trailerOff+IMAGE_TRAILER_SIZE : tlvEnd])
+	if err != nil {
+		return nil, err
+	}
+
+	info := &ImageInfo{
+		HdrVer:  2,
+		Version: hdr.Vers,
+		Flags:   hdr.Flags,
+		HdrSz:   int(hdr.HdrSz),
+		BodySz:  int(hdr.ImgSz),
+		Tlvs:    tlvs,
+	}
+
+	if tlv := info.FindTlv(IMAGE_TLV_SHA256); tlv != nil {
+		info.Hash = tlv.Data
+	}
+
+	return info, nil
+}
+
+// Parses a Mynewt image from the specified buffer.  Both version 1 and
+// version 2 image headers are supported.
+func ParseBytes(b []byte) (*ImageInfo, error) {
+	if len(b) < IMAGE_HEADER_SIZE {
+		return nil, fmt.Errorf("Image too short to contain header; len=%d",
+			len(b))
+	}
+
+	magic := binary.LittleEndian.Uint32(b)
+
+	var info *ImageInfo
+	var err error
+
+	switch magic {
+	case IMAGE_MAGIC_V1:
+		info, err = parseV1(b)
+	case IMAGE_MAGIC_V2:
+		info, err = parseV2(b)
+	default:
+		return nil, fmt.Errorf("Invalid image magic: 0x%08x", magic)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if info.HdrSz < IMAGE_HEADER_SIZE {
+		return nil, fmt.Errorf("Invalid image header size: %d", info.HdrSz)
+	}
+
+	if info.Hash != nil && len(info.Hash) != IMAGE_HASH_LEN {
+		return nil, fmt.Errorf("Invalid image hash length: %d",
+			len(info.Hash))
+	}
+
+	return info, nil
+}
+
+// Reads and parses a Mynewt image.
+func Parse(r io.Reader) (*ImageInfo, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseBytes(b)
+}
@@ -0,0 +1,185 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mgmt
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/runtimeco/go-coap"
+
+	"mynewt.apache.org/newtmgr/nmxact/nmcoap"
+)
+
+// Describes an active CoAP observe relationship.
+type ObserveInfo struct {
+	Token []byte
+	Path  string
+
+	// When the registration was most recently sent.
+	Registered time.Time
+
+	// When the most recent notification arrived; zero if none has.
+	LastNotify time.Time
+
+	// The number of notifications received since the registration was sent.
+	NumNotify int
+}
+
+// Indicates how long it has been since the peer was last heard from on this
+// relationship.  A relationship whose age keeps growing is likely stale.
+func (oi *ObserveInfo) Age() time.Duration {
+	if oi.LastNotify.IsZero() {
+		return time.Since(oi.Registered)
+	}
+	return time.Since(oi.LastNotify)
+}
+
+type observation struct {
+	info ObserveInfo
+
+	// The registration request; retransmitted to refresh the relationship.
+	req coap.Message
+}
+
+// Extracts the value of a message's Observe option.  Returns -1 if the
+// option is absent.
+func observeVal(m coap.Message) int {
+	switch v := m.Option(coap.Observe).(type) {
+	case int:
+		return v
+	case uint32:
+		return int(v)
+	default:
+		return -1
+	}
+}
+
+// Records the observe registration or deregistration carried by an outgoing
+// request, if any.
+func (t *Transceiver) noteObserveTx(req coap.Message) {
+	key := hex.EncodeToString(req.Token())
+
+	t.obsMtx.Lock()
+	defer t.obsMtx.Unlock()
+
+	switch observeVal(req) {
+	case nmcoap.OBSERVE_START.Spec():
+		t.observations[key] = &observation{
+			info: ObserveInfo{
+				Token:      req.Token(),
+				Path:       req.PathString(),
+				Registered: time.Now(),
+			},
+			req: req,
+		}
+
+	case nmcoap.OBSERVE_STOP.Spec():
+		delete(t.observations, key)
+	}
+}
+
+// Updates the relationship, if any, that an incoming message belongs to.
+func (t *Transceiver) noteObserveRx(msg coap.Message) {
+	key := hex.EncodeToString(msg.Token())
+
+	t.obsMtx.Lock()
+	defer t.obsMtx.Unlock()
+
+	o := t.observations[key]
+	if o == nil {
+		return
+	}
+
+	// An error response terminates the relationship (RFC 7641, 3.2).
+	if msg.Code() >= coap.BadRequest {
+		delete(t.observations, key)
+		return
+	}
+
+	o.info.LastNotify = time.Now()
+	o.info.NumNotify++
+}
+
+// Retrieves the active observe relationships, oldest registration first.
+func (t *Transceiver) Observations() []ObserveInfo {
+	t.obsMtx.Lock()
+	defer t.obsMtx.Unlock()
+
+	infos := make([]ObserveInfo, 0, len(t.observations))
+	for _, o := range t.observations {
+		infos = append(infos, o.info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Registered.Before(infos[j].Registered)
+	})
+
+	return infos
+}
+
+// Retrieves the registration request for the relationship with the
+// specified token and assigns it a fresh message ID.  The caller retransmits
+// it to re-register (RFC 7641, 3.3.1).
+func (t *Transceiver) ObserveRefreshReq(token []byte) (coap.Message, error) {
+	t.obsMtx.Lock()
+	defer t.obsMtx.Unlock()
+
+	o := t.observations[hex.EncodeToString(token)]
+	if o == nil {
+		return nil, fmt.Errorf("no observe relationship with token %s",
+			hex.EncodeToString(token))
+	}
+
+	req, err := withMessageId(o.req, nmcoap.NextMessageId())
+	if err != nil {
+		return nil, err
+	}
+
+	o.req = req
+	return req, nil
+}
+
+// Creates a copy of a message with the specified message ID.  go-coap
+// messages are immutable in this respect, so the message is re-encoded with
+// the new ID.  TCP messages don't carry an ID and are returned unchanged.
+func withMessageId(m coap.Message, id uint16) (coap.Message, error) {
+	if _, ok := m.(*coap.DgramMessage); !ok {
+		return m, nil
+	}
+
+	b, err := m.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	// Bytes 2 and 3 of the datagram header contain the message ID.
+	binary.BigEndian.PutUint16(b[2:4], id)
+
+	nm := &coap.DgramMessage{}
+	if err := nm.UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+
+	return nm, nil
+}
@@ -22,6 +22,7 @@ package mgmt
 import (
 	"encoding/hex"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -38,6 +39,27 @@ import (
 
 type TxFn func(req []byte) error
 
+// Describes a request that is awaiting a response.
+type RequestInfo struct {
+	// Set for NMP requests.
+	Seq   uint8
+	Group uint16
+	Id    uint8
+
+	// Set for CoAP listeners.
+	IsCoap    bool
+	CoapPath  string
+	CoapToken []byte
+
+	// When the request was sent, or when the CoAP listener was added.
+	Start time.Time
+}
+
+// Indicates how long the request has been outstanding.
+func (ri *RequestInfo) Age() time.Duration {
+	return time.Since(ri.Start)
+}
+
 type Transceiver struct {
 	// Only for plain NMP; nil for OMP transceivers.
 	nd *nmp.Dispatcher
@@ -50,19 +72,62 @@ type Transceiver struct {
 	isTcp bool
 	proto sesn.MgmtProto
 	wg    sync.WaitGroup
+
+	// If nonzero, a management request fails if no data is received for
+	// this long after the first fragment of a response arrives.
+	rxFragTimeout time.Duration
+
+	// Signalled whenever part of a request's response is received, keyed by
+	// NMP sequence number.  Protected by progMtx.
+	progChans map[uint8]chan struct{}
+	progMtx   sync.Mutex
+
+	// Outstanding NMP requests and CoAP listeners; protected by pendingMtx.
+	pendingNmp  map[uint8]RequestInfo
+	pendingCoap map[string]RequestInfo
+	pendingMtx  sync.Mutex
+
+	// Active CoAP observe relationships, keyed by hex-encoded token;
+	// protected by obsMtx.
+	observations map[string]*observation
+	obsMtx       sync.Mutex
+
+	// Held while a request's fragments are being written, so that the
+	// fragments of concurrent requests are not interleaved.
+	txMtx sync.Mutex
+
+	// Unsolicited NMP messages awaiting the unsolicited callback, and
+	// whether a Goroutine is delivering them; protected by unsolMtx.
+	unsolCb     func(r nmp.NmpRsp)
+	unsolQueue  []nmp.NmpRsp
+	unsolActive bool
+	unsolMtx    sync.Mutex
 }
 
+// The maximum number of unsolicited messages queued for delivery.  Further
+// messages are dropped until the callback catches up.
+const UNSOLICITED_QUEUE_DEPTH = 16
+
+// Creates a transceiver.  `logDepth` is the number of stack frames skipped
+// when listener additions and removals are logged; see
+// sesn.SesnCfg.TxvrLogDepth.
 func NewTransceiver(txFilterCb, rxFilterCb nmcoap.MsgFilter, isTcp bool,
 	mgmtProto sesn.MgmtProto, logDepth int) (*Transceiver, error) {
 
 	t := &Transceiver{
-		txFilterCb: txFilterCb,
-		isTcp:      isTcp,
-		proto:      mgmtProto,
+		txFilterCb:  txFilterCb,
+		isTcp:       isTcp,
+		proto:       mgmtProto,
+		progChans:   map[uint8]chan struct{}{},
+		pendingNmp:  map[uint8]RequestInfo{},
+		pendingCoap: map[string]RequestInfo{},
+
+		observations: map[string]*observation{},
 	}
 
 	if mgmtProto == sesn.MGMT_PROTO_NMP {
 		t.nd = nmp.NewDispatcher(logDepth)
+		t.nd.SetFragCb(t.notifyProgress)
 	}
 
 	od, err := omp.NewDispatcher(rxFilterCb, isTcp, logDepth)
@@ -70,10 +135,195 @@ func NewTransceiver(txFilterCb, rxFilterCb nmcoap.MsgFilter, isTcp bool,
 		return nil, err
 	}
 	t.od = od
+	t.od.SetCoapRxCb(t.noteObserveRx)
 
 	return t, nil
 }
 
+func (t *Transceiver) addPendingNmp(hdr *nmp.NmpHdr) {
+	t.pendingMtx.Lock()
+	defer t.pendingMtx.Unlock()
+
+	t.pendingNmp[hdr.Seq] = RequestInfo{
+		Seq:   hdr.Seq,
+		Group: hdr.Group,
+		Id:    hdr.Id,
+		Start: time.Now(),
+	}
+}
+
+func (t *Transceiver) removePendingNmp(seq uint8) {
+	t.pendingMtx.Lock()
+	defer t.pendingMtx.Unlock()
+
+	delete(t.pendingNmp, seq)
+}
+
+// Retrieves the NMP requests awaiting a response and the active CoAP
+// listeners, oldest first.
+func (t *Transceiver) PendingRequests() []RequestInfo {
+	t.pendingMtx.Lock()
+	defer t.pendingMtx.Unlock()
+
+	ris := make([]RequestInfo, 0, len(t.pendingNmp)+len(t.pendingCoap))
+	for _, ri := range t.pendingNmp {
+		ris = append(ris, ri)
+	}
+	for _, ri := range t.pendingCoap {
+		ris = append(ris, ri)
+	}
+
+	sort.Slice(ris, func(i, j int) bool {
+		return ris[i].Start.Before(ris[j].Start)
+	})
+
+	return ris
+}
+
+// Aborts the outstanding NMP request with the specified sequence number.  The
+// request fails with an error; other requests are unaffected.
+func (t *Transceiver) CancelRequest(seq uint8) error {
+	t.pendingMtx.Lock()
+	_, ok := t.pendingNmp[seq]
+	t.pendingMtx.Unlock()
+
+	if !ok {
+		return fmt.Errorf("No pending NMP request; seq=%d", seq)
+	}
+
+	t.ErrorOne(seq, fmt.Errorf("request cancelled"))
+	return nil
+}
+
+// Registers a channel that gets signalled each time part of the response to
+// the specified request is received.  Returns nil if no inter-fragment
+// timeout is configured.
+func (t *Transceiver) addProgListener(seq uint8) chan struct{} {
+	if t.rxFragTimeout == 0 {
+		return nil
+	}
+
+	t.progMtx.Lock()
+	defer t.progMtx.Unlock()
+
+	ch := make(chan struct{}, 1)
+	t.progChans[seq] = ch
+	return ch
+}
+
+func (t *Transceiver) removeProgListener(seq uint8, ch chan struct{}) {
+	if ch == nil {
+		return
+	}
+
+	t.progMtx.Lock()
+	defer t.progMtx.Unlock()
+
+	if t.progChans[seq] == ch {
+		delete(t.progChans, seq)
+	}
+}
+
+func signalProgress(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// Signals progress to the request with the specified sequence number.
+func (t *Transceiver) notifyProgress(seq uint8) {
+	t.progMtx.Lock()
+	defer t.progMtx.Unlock()
+
+	if ch := t.progChans[seq]; ch != nil {
+		signalProgress(ch)
+	}
+}
+
+// Signals progress to every request.  OMP responses carry their NMP header
+// inside the CoAP payload, so a fragment can't be attributed to a request
+// until its packet is complete.
+func (t *Transceiver) notifyAllProgress() {
+	t.progMtx.Lock()
+	defer t.progMtx.Unlock()
+
+	for _, ch := range t.progChans {
+		signalProgress(ch)
+	}
+}
+
+// Waits for a response on the specified listener.  The overall timeout is an
+// upper bound on the wait.  If an inter-fragment timeout is configured, the
+// wait also fails if a response starts to arrive and then stalls for that
+// long.
+func (t *Transceiver) awaitRsp(nl *nmp.Listener, prog <-chan struct{},
+	timeout time.Duration) (nmp.NmpRsp, error) {
+
+	var fragTimer *time.Timer
+	var fragTmoChan <-chan time.Time
+	defer func() {
+		if fragTimer != nil {
+			fragTimer.Stop()
+		}
+	}()
+
+	tmoChan := nl.AfterTimeout(timeout)
+	for {
+		select {
+		case err := <-nl.ErrChan:
+			return nil, err
+		case rsp := <-nl.RspChan:
+			return rsp, nil
+		case _, ok := <-tmoChan:
+			if ok {
+				return nil, nmxutil.NewRspTimeoutError("NMP timeout")
+			}
+		case <-prog:
+			// Data received; restart the inter-fragment timer.  The timer
+			// isn't armed until the first fragment arrives so that the
+			// time the peer spends processing the request isn't counted.
+			if fragTimer == nil {
+				fragTimer = time.NewTimer(t.rxFragTimeout)
+				fragTmoChan = fragTimer.C
+			} else {
+				if !fragTimer.Stop() {
+					<-fragTimer.C
+				}
+				fragTimer.Reset(t.rxFragTimeout)
+			}
+		case <-fragTmoChan:
+			return nil, nmxutil.NewRspTimeoutError(fmt.Sprintf(
+				"NMP timeout; response stalled for %s", t.rxFragTimeout))
+		}
+	}
+}
+
+// Splits a packet into MTU-sized fragments and writes each in turn.  If a
+// write exceeds the MTU after earlier fragments have gone out, the error is
+// flagged as partial: the peer has already received part of the packet.
+// The fragments of concurrent packets are never interleaved.
+func (t *Transceiver) txFrags(txCb TxFn, b []byte, mtu int) error {
+	frags, err := nmxutil.Fragment(b, mtu)
+	if err != nil {
+		return err
+	}
+
+	t.txMtx.Lock()
+	defer t.txMtx.Unlock()
+
+	for i, frag := range frags {
+		if err := txCb(frag); err != nil {
+			if e, ok := err.(*nmxutil.MtuExceededError); ok && i > 0 {
+				e.Partial = true
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (t *Transceiver) txRxNmp(txCb TxFn, req *nmp.NmpMsg, mtu int,
 	timeout time.Duration) (nmp.NmpRsp, error) {
 
@@ -83,6 +333,12 @@ func (t *Transceiver) txRxNmp(txCb TxFn, req *nmp.NmpMsg, mtu int,
 	}
 	defer t.nd.RemoveListener(req.Hdr.Seq)
 
+	t.addPendingNmp(&req.Hdr)
+	defer t.removePendingNmp(req.Hdr.Seq)
+
+	prog := t.addProgListener(req.Hdr.Seq)
+	defer t.removeProgListener(req.Hdr.Seq, prog)
+
 	b, err := nmp.EncodeNmpPlain(req)
 	if err != nil {
 		return nil, err
@@ -92,26 +348,12 @@ func (t *Transceiver) txRxNmp(txCb TxFn, req *nmp.NmpMsg, mtu int,
 	if t.isTcp == false && len(b) > mtu {
 		return nil, fmt.Errorf("Request too big")
 	}
-	frags := nmxutil.Fragment(b, mtu)
-	for _, frag := range frags {
-		if err := txCb(frag); err != nil {
-			return nil, err
-		}
+	if err := t.txFrags(txCb, b, mtu); err != nil {
+		return nil, err
 	}
 
 	// Now wait for NMP response.
-	for {
-		select {
-		case err := <-nl.ErrChan:
-			return nil, err
-		case rsp := <-nl.RspChan:
-			return rsp, nil
-		case _, ok := <-nl.AfterTimeout(timeout):
-			if ok {
-				return nil, nmxutil.NewRspTimeoutError("NMP timeout")
-			}
-		}
-	}
+	return t.awaitRsp(nl, prog, timeout)
 }
 
 func (t *Transceiver) txRxOmp(txCb TxFn, req *nmp.NmpMsg, mtu int,
@@ -123,6 +365,12 @@ func (t *Transceiver) txRxOmp(txCb TxFn, req *nmp.NmpMsg, mtu int,
 	}
 	defer t.od.RemoveNmpListener(req.Hdr.Seq)
 
+	t.addPendingNmp(&req.Hdr)
+	defer t.removePendingNmp(req.Hdr.Seq)
+
+	prog := t.addProgListener(req.Hdr.Seq)
+	defer t.removeProgListener(req.Hdr.Seq, prog)
+
 	var b []byte
 	if t.isTcp {
 		b, err = omp.EncodeOmpTcp(t.txFilterCb, req)
@@ -138,21 +386,60 @@ func (t *Transceiver) txRxOmp(txCb TxFn, req *nmp.NmpMsg, mtu int,
 	if t.isTcp == false && len(b) > mtu {
 		return nil, fmt.Errorf("Request too big")
 	}
-	frags := nmxutil.Fragment(b, mtu)
-	for _, frag := range frags {
-		if err := txCb(frag); err != nil {
-			return nil, err
-		}
+	if err := t.txFrags(txCb, b, mtu); err != nil {
+		return nil, err
 	}
 
 	// Now wait for NMP response.
+	return t.awaitRsp(nl, prog, timeout)
+}
+
+// Sends a pre-encoded NMP request and waits for the response.  The request is
+// transmitted exactly as specified; the response is returned undecoded.  The
+// two are matched by sequence number.  Only plain NMP transceivers support
+// raw requests.  A timeout of 0 means wait indefinitely.
+func (t *Transceiver) TxRxRawNmp(txCb TxFn, frame []byte, mtu int,
+	timeout time.Duration) ([]byte, error) {
+
+	if t.nd == nil {
+		return nil, fmt.Errorf("Raw NMP requests not supported by %s "+
+			"transceiver", t.proto.String())
+	}
+
+	hdr, err := nmp.DecodeNmpHdr(frame)
+	if err != nil {
+		return nil, err
+	}
+
+	nl, err := t.nd.AddRawListener(hdr.Seq)
+	if err != nil {
+		return nil, err
+	}
+	defer t.nd.RemoveListener(hdr.Seq)
+
+	t.addPendingNmp(hdr)
+	defer t.removePendingNmp(hdr.Seq)
+
+	log.Debugf("Tx raw NMP request: %s", hex.Dump(frame))
+	if t.isTcp == false && len(frame) > mtu {
+		return nil, fmt.Errorf("Request too big")
+	}
+	if err := t.txFrags(txCb, frame, mtu); err != nil {
+		return nil, err
+	}
+
+	var tmoChan <-chan time.Time
+	if timeout != 0 {
+		tmoChan = nl.AfterTimeout(timeout)
+	}
+
 	for {
 		select {
 		case err := <-nl.ErrChan:
 			return nil, err
-		case rsp := <-nl.RspChan:
-			return rsp, nil
-		case _, ok := <-nl.AfterTimeout(timeout):
+		case b := <-nl.RawChan:
+			return b, nil
+		case _, ok := <-tmoChan:
 			if ok {
 				return nil, nmxutil.NewRspTimeoutError("NMP timeout")
 			}
@@ -170,6 +457,26 @@ func (t *Transceiver) TxRxMgmt(txCb TxFn, req *nmp.NmpMsg, mtu int,
 	}
 }
 
+// Like TxRxMgmt(), but also reports how the request was transmitted.  The
+// statistics are valid even if the request fails.
+func (t *Transceiver) TxRxMgmtEx(txCb TxFn, req *nmp.NmpMsg, mtu int,
+	timeout time.Duration) (nmp.NmpRsp, sesn.TxStats, error) {
+
+	var stats sesn.TxStats
+
+	countCb := func(b []byte) error {
+		if err := txCb(b); err != nil {
+			return err
+		}
+		stats.Frags++
+		stats.Bytes += len(b)
+		return nil
+	}
+
+	rsp, err := t.TxRxMgmt(countCb, req, mtu, timeout)
+	return rsp, stats, err
+}
+
 func (t *Transceiver) TxCoap(txCb TxFn, req coap.Message, mtu int) error {
 	b, err := nmcoap.Encode(req)
 	if err != nil {
@@ -177,13 +484,11 @@ func (t *Transceiver) TxCoap(txCb TxFn, req coap.Message, mtu int) error {
 	}
 
 	log.Debugf("tx CoAP request: %s", hex.Dump(b))
-	frags := nmxutil.Fragment(b, mtu)
-	for _, frag := range frags {
-		if err := txCb(frag); err != nil {
-			return err
-		}
+	if err := t.txFrags(txCb, b, mtu); err != nil {
+		return err
 	}
 
+	t.noteObserveTx(req)
 	return nil
 }
 
@@ -197,12 +502,25 @@ func (t *Transceiver) ListenCoap(
 		return nil, err
 	}
 
+	t.pendingMtx.Lock()
+	t.pendingCoap[mc.String()] = RequestInfo{
+		IsCoap:    true,
+		CoapPath:  mc.Path,
+		CoapToken: mc.Token,
+		Start:     time.Now(),
+	}
+	t.pendingMtx.Unlock()
+
 	return ol, nil
 }
 
 func (t *Transceiver) StopListenCoap(mc nmcoap.MsgCriteria) {
 	mc.Path = strings.TrimPrefix(mc.Path, "/")
 	t.od.RemoveCoapListener(mc)
+
+	t.pendingMtx.Lock()
+	delete(t.pendingCoap, mc.String())
+	t.pendingMtx.Unlock()
 }
 
 func (t *Transceiver) DispatchNmpRsp(data []byte) {
@@ -211,6 +529,7 @@ func (t *Transceiver) DispatchNmpRsp(data []byte) {
 		t.nd.Dispatch(data)
 	} else {
 		log.Debugf("rx omp response: %s", hex.Dump(data))
+		t.notifyAllProgress()
 		t.od.Dispatch(data)
 	}
 }
@@ -254,6 +573,109 @@ func (t *Transceiver) Filters() (nmcoap.MsgFilter, nmcoap.MsgFilter) {
 	return t.txFilterCb, t.od.RxFilter()
 }
 
+// Sets the callback to execute when an NMP response arrives with no
+// outstanding request.  Only plain NMP transceivers support unsolicited
+// messages; for other protocols this is a no-op.  The callback runs in a
+// Goroutine of its own, one message at a time, so it may send requests and
+// wait for their responses.
+func (t *Transceiver) SetUnsolicitedCb(cb func(r nmp.NmpRsp)) {
+	if t.nd == nil {
+		return
+	}
+
+	t.unsolMtx.Lock()
+	t.unsolCb = cb
+	t.unsolMtx.Unlock()
+
+	if cb == nil {
+		t.nd.SetUnsolicitedCb(nil)
+	} else {
+		t.nd.SetUnsolicitedCb(t.queueUnsolicited)
+	}
+}
+
+// Queues an unsolicited message for the callback.  The delivering Goroutine
+// is started on demand and exits once the queue is empty.
+func (t *Transceiver) queueUnsolicited(r nmp.NmpRsp) {
+	t.unsolMtx.Lock()
+	defer t.unsolMtx.Unlock()
+
+	if len(t.unsolQueue) >= UNSOLICITED_QUEUE_DEPTH {
+		log.Debugf("Unsolicited NMP message queue full; dropping message")
+		return
+	}
+	t.unsolQueue = append(t.unsolQueue, r)
+
+	if !t.unsolActive {
+		t.unsolActive = true
+		go t.deliverUnsolicited()
+	}
+}
+
+func (t *Transceiver) deliverUnsolicited() {
+	for {
+		t.unsolMtx.Lock()
+		if len(t.unsolQueue) == 0 {
+			t.unsolActive = false
+			t.unsolMtx.Unlock()
+			return
+		}
+		r := t.unsolQueue[0]
+		t.unsolQueue = t.unsolQueue[1:]
+		cb := t.unsolCb
+		t.unsolMtx.Unlock()
+
+		if cb != nil {
+			cb(r)
+		}
+	}
+}
+
+// Configures the callback executed when reassembly of a plain NMP response
+// detects a lost fragment.  OMP responses are not reassembled by the
+// transceiver, so the callback is never executed for OMP transceivers.  This
+// must be called before any requests are sent.
+func (t *Transceiver) SetFragGapCb(cb nmp.FragGapFn) {
+	if t.nd != nil {
+		t.nd.SetFragGapCb(cb)
+	}
+}
+
+// Configures how responses with an unexpected management protocol version
+// are handled.  The callback, if any, is executed for the first such
+// response.  If `strict` is true, the corresponding request fails with an
+// nmxutil.ProtoMismatchError; otherwise the response is decoded normally.
+// This must be called before any requests are sent.
+func (t *Transceiver) SetProtoMismatchCb(cb nmp.ProtoMismatchFn,
+	strict bool) {
+
+	pc := nmp.NewProtoChecker(cb, strict)
+	if t.nd != nil {
+		t.nd.SetProtoChecker(pc)
+	}
+	if t.od != nil {
+		t.od.SetProtoChecker(pc)
+	}
+}
+
+// Configures the pool that NMP response reassembly buffers are drawn from.
+// The pool may be shared with other transceivers.  This must be called
+// before any requests are sent.
+func (t *Transceiver) SetBufPool(pool *nmxutil.BufPool) {
+	if t.nd != nil {
+		t.nd.SetBufPool(pool)
+	}
+}
+
+// Sets the inter-fragment timeout for management responses.  Once a response
+// starts to arrive, the request fails if no further data is received for this
+// duration.  The request's overall timeout remains in effect.  A value of 0
+// disables the inter-fragment timeout.  This must be called before any
+// requests are sent.
+func (t *Transceiver) SetRxFragTimeout(tmo time.Duration) {
+	t.rxFragTimeout = tmo
+}
+
 func (t *Transceiver) SetFilters(txFilter nmcoap.MsgFilter,
 	rxFilter nmcoap.MsgFilter) {
 
@@ -0,0 +1,152 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package mgmt
+
+import (
+	"testing"
+	"time"
+
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+	"mynewt.apache.org/newtmgr/nmxact/sesn"
+)
+
+func encodeEchoRsp(seq uint8) []byte {
+	b, err := nmp.EncodeNmpPlain(&nmp.NmpMsg{
+		Hdr: nmp.NmpHdr{
+			Op:    nmp.NMP_OP_WRITE_RSP,
+			Group: nmp.NMP_GROUP_DEFAULT,
+			Id:    nmp.NMP_ID_DEF_ECHO,
+			Seq:   seq,
+		},
+		Body: &nmp.EchoRsp{Payload: "x"},
+	})
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// Verifies that the inter-fragment timeout of a request is only driven by
+// its own response; traffic for other requests neither arms nor resets it.
+func TestTxvrRxFragTimeoutPerSeq(t *testing.T) {
+	const fragTmo = 50 * time.Millisecond
+
+	txvr, err := NewTransceiver(nil, nil, false, sesn.MGMT_PROTO_NMP, 0)
+	if err != nil {
+		t.Fatalf("NewTransceiver: %s", err.Error())
+	}
+	defer txvr.Stop()
+	txvr.SetRxFragTimeout(fragTmo)
+
+	req := nmp.NewEchoReq()
+	req.Payload = "x"
+	m := req.Msg()
+	other := m.Hdr.Seq + 1
+
+	// The peer finishes another request's response right away, but takes
+	// several inter-fragment timeouts to process this one.
+	txCb := func(b []byte) error {
+		go func() {
+			txvr.DispatchNmpRsp(encodeEchoRsp(other))
+			time.Sleep(3 * fragTmo)
+
+			rsp := encodeEchoRsp(m.Hdr.Seq)
+			txvr.DispatchNmpRsp(rsp[:len(rsp)-1])
+			time.Sleep(fragTmo / 5)
+			txvr.DispatchNmpRsp(rsp[len(rsp)-1:])
+		}()
+		return nil
+	}
+
+	if _, err := txvr.TxRxMgmt(txCb, m, 256, time.Second); err != nil {
+		t.Fatalf("TxRxMgmt: %s", err.Error())
+	}
+
+	// A response that starts and then stalls still times out.
+	m = req.Msg()
+	m.Hdr.Seq++
+	txCb = func(b []byte) error {
+		rsp := encodeEchoRsp(m.Hdr.Seq)
+		go txvr.DispatchNmpRsp(rsp[:len(rsp)-1])
+		return nil
+	}
+
+	start := time.Now()
+	_, err = txvr.TxRxMgmt(txCb, m, 256, time.Second)
+	if err == nil {
+		t.Fatalf("stalled response did not time out")
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Fatalf("stalled response hit the overall timeout (%s)", elapsed)
+	}
+}
+
+// Verifies that the unsolicited callback can send a request and receive its
+// response, even though both arrive through the same receive Goroutine.
+func TestTxvrUnsolicitedCbRequest(t *testing.T) {
+	txvr, err := NewTransceiver(nil, nil, false, sesn.MGMT_PROTO_NMP, 0)
+	if err != nil {
+		t.Fatalf("NewTransceiver: %s", err.Error())
+	}
+	defer txvr.Stop()
+
+	// All incoming packets are dispatched by a single Goroutine, as they
+	// are by a real session.
+	rxCh := make(chan []byte, 4)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go func() {
+		for {
+			select {
+			case b := <-rxCh:
+				txvr.DispatchNmpRsp(b)
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+
+	errCh := make(chan error, 1)
+	txvr.SetUnsolicitedCb(func(r nmp.NmpRsp) {
+		req := nmp.NewEchoReq()
+		req.Payload = "x"
+		m := req.Msg()
+
+		txCb := func(b []byte) error {
+			rxCh <- encodeEchoRsp(m.Hdr.Seq)
+			return nil
+		}
+		_, err := txvr.TxRxMgmt(txCb, m, 256, time.Second)
+		errCh <- err
+	})
+
+	// No request is outstanding with this sequence number.
+	rxCh <- encodeEchoRsp(nmp.NewEchoReq().Msg().Hdr.Seq)
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatalf("request from unsolicited callback failed: %s",
+				err.Error())
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("unsolicited callback never completed its request")
+	}
+}
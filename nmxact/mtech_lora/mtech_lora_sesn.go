@@ -89,11 +89,15 @@ func (s *LoraSesn) Open() error {
 	}
 
 	txvr, err := mgmt.NewTransceiver(s.cfg.TxFilterCb, s.cfg.RxFilterCb, false,
-		s.cfg.MgmtProto, 3)
+		s.cfg.MgmtProto, s.cfg.TxvrLogDepth)
 	if err != nil {
 		return err
 	}
 	s.txvr = txvr
+	s.txvr.SetUnsolicitedCb(s.cfg.UnsolicitedCb)
+	s.txvr.SetRxFragTimeout(s.cfg.RxFragTimeout)
+	s.txvr.SetFragGapCb(s.cfg.FragGapCb)
+	s.txvr.SetProtoMismatchCb(s.cfg.ProtoMismatchCb, s.cfg.ProtoStrict)
 	s.stopChan = make(chan struct{})
 
 	msgType := "rsp"
@@ -347,6 +351,14 @@ func (s *LoraSesn) CoapIsTcp() bool {
 	return false
 }
 
+func (s *LoraSesn) Capabilities() sesn.SesnCaps {
+	return sesn.SesnCaps{
+		Observe:    true,
+		Reconnect:  false,
+		MaxPayload: s.MtuOut(),
+	}
+}
+
 func (s *LoraSesn) RxAccept() (sesn.Sesn, *sesn.SesnCfg, error) {
 	if !s.isOpen {
 		return nil, nil, nmxutil.NewSesnClosedError(
@@ -390,7 +402,11 @@ func (s *LoraSesn) RxCoap(opt sesn.TxOptions) (coap.Message, error) {
 		return nil, fmt.Errorf("RxCoap() only connected sessions")
 	}
 
-	waitTmoChan := time.After(opt.Timeout)
+	timeout, err := opt.AttemptTimeout()
+	if err != nil {
+		return nil, err
+	}
+	waitTmoChan := time.After(timeout)
 	s.wg.Add(1)
 	defer s.wg.Done()
 	for {
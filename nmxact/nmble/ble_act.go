@@ -589,8 +589,10 @@ func findChr(x *BleXport, bl *Listener, r *BleFindChrReq) (
 }
 
 // Blocking.
-func exchangeMtu(x *BleXport, bl *Listener, r *BleExchangeMtuReq) (
-	int, error) {
+// Blocking.  `timeout` limits how long to wait for the peer to answer once
+// blehostd has accepted the request.
+func exchangeMtu(x *BleXport, bl *Listener, r *BleExchangeMtuReq,
+	timeout time.Duration) (int, error) {
 
 	const rspType = MSG_TYPE_EXCHANGE_MTU
 	const evtType = MSG_TYPE_MTU_CHANGE_EVT
@@ -605,6 +607,7 @@ func exchangeMtu(x *BleXport, bl *Listener, r *BleExchangeMtuReq) (
 	}
 
 	bhdTmoChan := bl.AfterTimeout(x.RspTimeout())
+	var peerTmoChan <-chan time.Time
 	for {
 		select {
 		case err := <-bl.ErrChan:
@@ -618,6 +621,9 @@ func exchangeMtu(x *BleXport, bl *Listener, r *BleExchangeMtuReq) (
 					return 0, StatusError(MSG_OP_RSP, rspType, msg.Status)
 				}
 
+				// The exchange is underway; wait for the peer's response.
+				peerTmoChan = time.After(timeout)
+
 			case *BleMtuChangeEvt:
 				if msg.Status != 0 {
 					return 0, StatusError(MSG_OP_EVT, evtType, msg.Status)
@@ -633,6 +639,11 @@ func exchangeMtu(x *BleXport, bl *Listener, r *BleExchangeMtuReq) (
 				x.Restart("Blehostd timeout: " + MsgTypeToString(rspType))
 			}
 			bhdTmoChan = nil
+
+		case <-peerTmoChan:
+			return 0, nmxutil.NewBleMtuExchangeTmoError(fmt.Sprintf(
+				"Peer did not answer ATT MTU exchange; timeout=%s",
+				timeout))
 		}
 	}
 }
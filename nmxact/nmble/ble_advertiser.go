@@ -166,7 +166,20 @@ func (a *Advertiser) stopAdvertising() error {
 func (a *Advertiser) buildSesn(cfg AdvertiseCfg, connHandle uint16,
 	bl *Listener) (sesn.Sesn, error) {
 
-	s, err := NewBleSesn(a.bx, cfg.SesnCfg)
+	// The peer is whoever connected.
+	sc := cfg.SesnCfg
+	if sc.PeerSpec.Ble.Addr == (BleAddr{}) {
+		desc, err := ConnFindXact(a.bx, connHandle)
+		if err != nil {
+			return nil, err
+		}
+		sc.PeerSpec.Ble = BleDev{
+			AddrType: desc.PeerIdAddrType,
+			Addr:     desc.PeerIdAddr,
+		}
+	}
+
+	s, err := NewBleSesn(a.bx, sc)
 	if err != nil {
 		return nil, err
 	}
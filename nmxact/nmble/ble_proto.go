@@ -253,6 +253,9 @@ const (
 	ERR_CODE_ATT_INSUFFICIENT_ENC           = 0x0f
 	ERR_CODE_ATT_UNSUPPORTED_GROUP          = 0x10
 	ERR_CODE_ATT_INSUFFICIENT_RES           = 0x11
+
+	// Common profile and service error codes.
+	ERR_CODE_ATT_PROC_IN_PROGRESS = 0xfe
 )
 
 var AttErrCodeStringMap = map[int]string{
@@ -273,6 +276,7 @@ var AttErrCodeStringMap = map[int]string{
 	ERR_CODE_ATT_INSUFFICIENT_ENC:       "insufficient encryption",
 	ERR_CODE_ATT_UNSUPPORTED_GROUP:      "unsupported group",
 	ERR_CODE_ATT_INSUFFICIENT_RES:       "insufficient resources",
+	ERR_CODE_ATT_PROC_IN_PROGRESS:       "procedure already in progress",
 }
 
 const (
@@ -1020,6 +1024,10 @@ type BleConnFindRsp struct {
 	Authenticated   bool        `json:"authenticated"`
 	Bonded          bool        `json:"bonded"`
 	KeySize         int         `json:"key_size"`
+
+	// Optional; units of 10 ms.  Only reported by newer versions of
+	// blehostd.
+	SupervisionTimeout int `json:"supervision_timeout,omitempty"`
 }
 
 type BleResetReq struct {
@@ -20,11 +20,13 @@
 package nmble
 
 import (
+	"context"
 	"time"
 
 	"github.com/runtimeco/go-coap"
 
 	. "mynewt.apache.org/newtmgr/nmxact/bledefs"
+	"mynewt.apache.org/newtmgr/nmxact/mgmt"
 	"mynewt.apache.org/newtmgr/nmxact/nmcoap"
 	"mynewt.apache.org/newtmgr/nmxact/nmp"
 	"mynewt.apache.org/newtmgr/nmxact/sesn"
@@ -66,20 +68,114 @@ func (s *BleSesn) Open() error {
 	return s.Ns.Open()
 }
 
+func (s *BleSesn) OpenUntil(deadline time.Time) error {
+	if err := s.bx.AcquireMasterPrimary(s); err != nil {
+		return err
+	}
+	defer s.bx.ReleaseMaster()
+
+	return s.Ns.OpenUntil(deadline)
+}
+
+func (s *BleSesn) AbortOpen() {
+	s.Ns.AbortOpen()
+}
+
 func (s *BleSesn) OpenConnected(
 	connHandle uint16, eventListener *Listener) error {
 
 	return s.Ns.OpenConnected(connHandle, eventListener)
 }
 
+func (s *BleSesn) OpenConnectedCtx(ctx context.Context,
+	connHandle uint16, eventListener *Listener) error {
+
+	return s.Ns.OpenConnectedCtx(ctx, connHandle, eventListener)
+}
+
 func (s *BleSesn) Close() error {
 	return s.Ns.Close()
 }
 
+func (s *BleSesn) Pause() error {
+	return s.Ns.Pause()
+}
+
+func (s *BleSesn) Resume() error {
+	if err := s.bx.AcquireMasterPrimary(s); err != nil {
+		return err
+	}
+	defer s.bx.ReleaseMaster()
+
+	return s.Ns.Resume()
+}
+
+func (s *BleSesn) IsPaused() bool {
+	return s.Ns.IsPaused()
+}
+
+func (s *BleSesn) QuotaUsed() int64 {
+	return s.Ns.QuotaUsed()
+}
+
+func (s *BleSesn) Goodput() float64 {
+	return s.Ns.Goodput()
+}
+
+func (s *BleSesn) ResetQuota() {
+	s.Ns.ResetQuota()
+}
+
 func (s *BleSesn) IsOpen() bool {
 	return s.Ns.IsOpen()
 }
 
+func (s *BleSesn) Flush() error {
+	return s.Ns.Flush()
+}
+
+func (s *BleSesn) WaitClosed() error {
+	return s.Ns.WaitClosed()
+}
+
+func (s *BleSesn) MtuHistory() []MtuChange {
+	return s.Ns.MtuHistory()
+}
+
+func (s *BleSesn) ConnectTimeline() []ConnectPhaseTime {
+	return s.Ns.ConnectTimeline()
+}
+
+func (s *BleSesn) PendingRequests() []mgmt.RequestInfo {
+	return s.Ns.PendingRequests()
+}
+
+func (s *BleSesn) CancelRequest(seq uint8) error {
+	return s.Ns.CancelRequest(seq)
+}
+
+func (s *BleSesn) SubscribeChr(chrId *BleChrId,
+	cb func(data []byte)) (*Subscription, error) {
+
+	return s.Ns.SubscribeChr(chrId, cb)
+}
+
+func (s *BleSesn) Subscriptions() []*Subscription {
+	return s.Ns.Subscriptions()
+}
+
+func (s *BleSesn) Observations() []mgmt.ObserveInfo {
+	return s.Ns.Observations()
+}
+
+func (s *BleSesn) RefreshObservation(token []byte) error {
+	return s.Ns.RefreshObservation(token)
+}
+
+func (s *BleSesn) TxRawNmp(frame []byte, opt sesn.TxOptions) ([]byte, error) {
+	return s.Ns.TxRawNmp(frame, opt)
+}
+
 func (s *BleSesn) MtuIn() int {
 	return s.Ns.MtuIn()
 }
@@ -92,6 +188,10 @@ func (s *BleSesn) CoapIsTcp() bool {
 	return s.Ns.CoapIsTcp()
 }
 
+func (s *BleSesn) Capabilities() sesn.SesnCaps {
+	return s.Ns.Capabilities()
+}
+
 func (s *BleSesn) MgmtProto() sesn.MgmtProto {
 	return s.Ns.MgmtProto()
 }
@@ -100,6 +200,30 @@ func (s *BleSesn) ConnInfo() (BleConnDesc, error) {
 	return s.Ns.ConnInfo()
 }
 
+func (s *BleSesn) Profile() (*Profile, error) {
+	return s.Ns.Profile()
+}
+
+func (s *BleSesn) Rediscover() error {
+	return s.Ns.Rediscover()
+}
+
+func (s *BleSesn) WaitForNotification(chrId BleChrId,
+	match func(data []byte) bool, timeout time.Duration) ([]byte, error) {
+
+	return s.Ns.WaitForNotification(chrId, match, timeout)
+}
+
+func (s *BleSesn) ChrProperties(chrId BleChrId) (
+	BleDiscChrProperties, error) {
+
+	return s.Ns.ChrProperties(chrId)
+}
+
+func (s *BleSesn) MgmtTargets() ([]BleUuid, error) {
+	return s.Ns.MgmtTargets()
+}
+
 func (s *BleSesn) SetOobKey(key []byte) {
 	s.Ns.SetOobKey(key)
 }
@@ -110,6 +234,12 @@ func (s *BleSesn) TxRxMgmt(m *nmp.NmpMsg,
 	return s.Ns.TxRxMgmt(m, timeout)
 }
 
+func (s *BleSesn) TxRxMgmtEx(m *nmp.NmpMsg,
+	timeout time.Duration) (nmp.NmpRsp, sesn.TxStats, error) {
+
+	return s.Ns.TxRxMgmtEx(m, timeout)
+}
+
 func (s *BleSesn) TxCoap(m coap.Message) error {
 	return s.Ns.TxCoap(m)
 }
@@ -87,17 +87,35 @@ func BleDescFromConnFindRsp(r *BleConnFindRsp) BleConnDesc {
 		Authenticated:   r.Authenticated,
 		Bonded:          r.Bonded,
 		KeySize:         r.KeySize,
+
+		SupervisionTimeout: time.Duration(r.SupervisionTimeout) *
+			BLE_SUPERVISION_TMO_UNIT,
 	}
 }
 
 func BleAdvReportFromScanEvt(e *BleScanEvt) BleAdvReport {
+	// Copy the raw bytes so that callers can retain them independently of
+	// the parsed fields.
+	raw := make([]byte, len(e.Data.Bytes))
+	copy(raw, e.Data.Bytes)
+
+	var rawAdv []byte
+	var rawScanRsp []byte
+	if e.EventType == BLE_ADV_EVENT_SCAN_RSP {
+		rawScanRsp = raw
+	} else {
+		rawAdv = raw
+	}
+
 	return BleAdvReport{
 		EventType: e.EventType,
 		Sender: BleDev{
 			AddrType: e.AddrType,
 			Addr:     e.Addr,
 		},
-		Rssi: e.Rssi,
+		Rssi:       e.Rssi,
+		RawAdv:     rawAdv,
+		RawScanRsp: rawScanRsp,
 
 		Fields: BleAdvFields{
 			Data: e.Data.Bytes,
@@ -139,9 +157,9 @@ func NewBleConnectReq() *BleConnectReq {
 		DurationMs:         30000,
 		ScanItvl:           0x0010,
 		ScanWindow:         0x0010,
-		ItvlMin:            24,
-		ItvlMax:            40,
-		Latency:            0,
+		ItvlMin:            BLE_CONN_ITVL_MIN_DFLT,
+		ItvlMax:            BLE_CONN_ITVL_MAX_DFLT,
+		Latency:            BLE_CONN_LATENCY_DFLT,
 		SupervisionTimeout: 0x0200,
 		MinCeLen:           0x0010,
 		MaxCeLen:           0x0300,
@@ -743,6 +761,99 @@ func BuildMgmtChrs(mgmtProto sesn.MgmtProto) (BleMgmtChrs, error) {
 	return mgmtChrs, nil
 }
 
+// Retrieves the standard request and response characteristics for CoAP
+// resources of the specified security level.
+func ResChrIds(level BleResSecLevel) (BleChrId, BleChrId, error) {
+	switch level {
+	case BLE_RES_SEC_PUBLIC:
+		svcUuid, _ := ParseUuid(IotivitySvcUuid)
+		reqChrUuid, _ := ParseUuid(IotivityReqChrUuid)
+		rspChrUuid, _ := ParseUuid(IotivityRspChrUuid)
+		return BleChrId{SvcUuid: svcUuid, ChrUuid: reqChrUuid},
+			BleChrId{SvcUuid: svcUuid, ChrUuid: rspChrUuid}, nil
+
+	case BLE_RES_SEC_UNAUTH:
+		svcUuid, _ := ParseUuid(UnauthSvcUuid)
+		reqChrUuid, _ := ParseUuid(UnauthReqChrUuid)
+		rspChrUuid, _ := ParseUuid(UnauthRspChrUuid)
+		return BleChrId{SvcUuid: svcUuid, ChrUuid: reqChrUuid},
+			BleChrId{SvcUuid: svcUuid, ChrUuid: rspChrUuid}, nil
+
+	case BLE_RES_SEC_SECURE:
+		svcUuid := BleUuid{U16: SecureSvcUuid}
+		reqChrUuid := BleUuid{U16: SecureReqChrUuid}
+		rspChrUuid := BleUuid{U16: SecureRspChrUuid}
+		return BleChrId{SvcUuid: svcUuid, ChrUuid: reqChrUuid},
+			BleChrId{SvcUuid: svcUuid, ChrUuid: rspChrUuid}, nil
+
+	default:
+		return BleChrId{}, BleChrId{},
+			fmt.Errorf("invalid resource security level: %d", level)
+	}
+}
+
+// Builds the characteristics a session uses, applying the session's
+// configured management target and CoAP resource characteristics.
+func buildSesnChrs(cfg sesn.SesnCfg) (BleMgmtChrs, error) {
+	mgmtChrs, err := BuildMgmtChrs(cfg.MgmtProto)
+	if err != nil {
+		return mgmtChrs, err
+	}
+
+	if cfg.Ble.MgmtTarget != nil {
+		mgmtChrs.NmpReqChr.SvcUuid = *cfg.Ble.MgmtTarget
+		mgmtChrs.NmpRspChr.SvcUuid = *cfg.Ble.MgmtTarget
+	}
+
+	if cfg.Ble.ResReqChr != nil {
+		req := *cfg.Ble.ResReqChr
+		rsp := *cfg.Ble.ResRspChr
+		mgmtChrs.ResReqChr = &req
+		mgmtChrs.ResRspChr = &rsp
+		return mgmtChrs, nil
+	}
+
+	req, rsp, err := ResChrIds(cfg.Ble.ResSecLevel)
+	if err != nil {
+		return mgmtChrs, err
+	}
+	mgmtChrs.ResReqChr = &req
+	mgmtChrs.ResRspChr = &rsp
+
+	return mgmtChrs, nil
+}
+
+// Lists the management targets a peer exposes, in discovery order.  A target
+// is any service that contains the standard management request and response
+// characteristics for the specified protocol.  Single-core devices expose
+// only the standard service.
+func MgmtTargets(p *Profile, mgmtProto sesn.MgmtProto) ([]BleUuid, error) {
+	mgmtChrs, err := BuildMgmtChrs(mgmtProto)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []BleUuid
+	for _, svc := range p.Services() {
+		req := false
+		rsp := false
+		for _, c := range svc.Chrs {
+			if c.Uuid == mgmtChrs.NmpReqChr.ChrUuid {
+				req = true
+			}
+			if c.Uuid == mgmtChrs.NmpRspChr.ChrUuid {
+				rsp = true
+			}
+		}
+
+		if req && rsp {
+			targets = append(targets, svc.Uuid)
+		}
+	}
+
+	return targets, nil
+}
+
 func IsSecErr(err error) bool {
 	bhdErr := nmxutil.ToBleHost(err)
 	if bhdErr == nil {
@@ -762,6 +873,19 @@ func IsSecErr(err error) bool {
 	}
 }
 
+// Indicates whether the given error represents a failed or rejected pairing
+// procedure, as opposed to a timeout or a lost connection.  The connection
+// remains usable (unencrypted) after such a failure.
+func IsPairingRejected(err error) bool {
+	bhe := nmxutil.ToBleHost(err)
+	if bhe == nil {
+		return false
+	}
+
+	return ErrCodeToSmUs(bhe.Status) != -1 ||
+		ErrCodeToSmPeer(bhe.Status) != -1
+}
+
 // Attempts to convert the given error to a BLE security error.  The conversion
 // succeeds if the error represents a pairing failure due to missing or
 // mismatched key material.
@@ -80,6 +80,38 @@ type XportCfg struct {
 	// Whether to restart automatically when an error is detected.
 	// Default: true.
 	Restart bool
+
+	// If nonzero, the sessions of this transport reassemble NMP responses
+	// into buffers drawn from a shared pool, rather than allocating new
+	// ones for each response.  Buffers larger than this many bytes are not
+	// returned to the pool.  This reduces garbage collection pressure when
+	// many sessions transfer data concurrently.
+	// Default: 0 (no pooling).
+	ReassemblyPoolMax int
+}
+
+// Describes the BLE host and controller underlying a transport.  blehostd
+// does not report the controller's version, LE feature set, or connection
+// limit, so only the parameters established at startup are included.
+type XportInfo struct {
+	// Static random address in use by the controller.
+	RandAddr BleAddr
+
+	// The ATT MTU the host offers during MTU exchange.  This is the ceiling
+	// for every connection; the peer may negotiate a lower value.
+	PreferredMtu uint16
+
+	// The largest attribute value the host can write in a single request.
+	MaxAttrLen int
+
+	// When the host and controller completed their initial sync.
+	SyncTime time.Time
+}
+
+// The channel to the blehostd process.  Satisfied by *unixchild.Client; tests
+// substitute a fake host.
+type hostLink interface {
+	TxToChild(data []byte) error
 }
 
 // Implements xport.Xport.
@@ -92,6 +124,7 @@ type BleXport struct {
 	advertiser *Advertiser
 	cfg        XportCfg
 	client     *unixchild.Client
+	link       hostLink
 	cm         ChrMgr
 	d          *Dispatcher
 	master     Master
@@ -104,7 +137,13 @@ type BleXport struct {
 	// Map of open sessions (key: connection handle).
 	sesns map[uint16]*NakedSesn
 
-	// Protects `enabled`.
+	// Shared by the sessions' reassemblers; nil if pooling is disabled.
+	bufPool *nmxutil.BufPool
+
+	// Collected at startup; nil while the transport is not running.
+	info *XportInfo
+
+	// Protects `enabled` and `info`.
 	mtx sync.Mutex
 }
 
@@ -132,6 +171,7 @@ func (bx *BleXport) startUnixChild() error {
 
 	config.ChildArgs = append(config.ChildArgs, bx.cfg.BlehostdArgs...)
 	bx.client = unixchild.New(config)
+	bx.link = bx.client
 
 	if err := bx.client.Start(); err != nil {
 		if unixchild.IsUcAcceptError(err) {
@@ -241,7 +281,7 @@ func (bx *BleXport) startSyncer() error {
 	return nil
 }
 
-func (bx *BleXport) setAddr() error {
+func (bx *BleXport) setAddr() (BleAddr, error) {
 	// Generate a new random address if none was specified.
 	var addr BleAddr
 	if bx.cfg.RandAddr != nil {
@@ -250,16 +290,16 @@ func (bx *BleXport) setAddr() error {
 		var err error
 		addr, err = GenRandAddrXact(bx)
 		if err != nil {
-			return err
+			return addr, err
 		}
 	}
 
 	// Set the random address on the controller.
 	if err := SetRandAddrXact(bx, addr); err != nil {
-		return err
+		return addr, err
 	}
 
-	return nil
+	return addr, nil
 }
 
 func (bx *BleXport) shutdown(cause error) error {
@@ -290,6 +330,10 @@ func (bx *BleXport) shutdown(cause error) error {
 
 	bx.sesns = map[uint16]*NakedSesn{}
 
+	bx.mtx.Lock()
+	bx.info = nil
+	bx.mtx.Unlock()
+
 	// Stop monitoring host-controller sync.
 	synced := bx.syncer.Synced()
 	log.Debugf("Stopping BLE syncer")
@@ -333,7 +377,7 @@ func (bx *BleXport) shutdown(cause error) error {
 // Transmit data to blehostd; host-controller sync not required.
 func (bx *BleXport) txNoSync(data []byte) error {
 	log.Debugf("Tx to blehostd:\n%s", hex.Dump(data))
-	return bx.client.TxToChild(data)
+	return bx.link.TxToChild(data)
 }
 
 func (bx *BleXport) startEvent() error {
@@ -379,9 +423,11 @@ func (bx *BleXport) startEvent() error {
 	if err := bx.startSyncer(); err != nil {
 		return fail(err)
 	}
+	syncTime := time.Now()
 
 	// Set the random address.
-	if err := bx.setAddr(); err != nil {
+	addr, err := bx.setAddr()
+	if err != nil {
 		return fail(err)
 	}
 
@@ -390,6 +436,15 @@ func (bx *BleXport) startEvent() error {
 		return fail(err)
 	}
 
+	bx.mtx.Lock()
+	bx.info = &XportInfo{
+		RandAddr:     addr,
+		PreferredMtu: bx.cfg.PreferredMtu,
+		MaxAttrLen:   BLE_ATT_ATTR_MAX_LEN,
+		SyncTime:     syncTime,
+	}
+	bx.mtx.Unlock()
+
 	return nil
 }
 
@@ -590,6 +645,28 @@ func (bx *BleXport) RemoveSesn(connHandle uint16) *NakedSesn {
 	return s
 }
 
+// Retrieves the number of open sessions using the transport.
+func (bx *BleXport) NumSesns() int {
+	bx.mtx.Lock()
+	defer bx.mtx.Unlock()
+
+	return len(bx.sesns)
+}
+
+// Retrieves a description of the host and controller.  This information is
+// collected when the transport starts; an error is returned if the transport
+// is not running.
+func (bx *BleXport) Info() (XportInfo, error) {
+	bx.mtx.Lock()
+	defer bx.mtx.Unlock()
+
+	if bx.info == nil {
+		return XportInfo{}, nmxutil.NewXportError("BLE xport not started")
+	}
+
+	return *bx.info, nil
+}
+
 func (bx *BleXport) FindSesn(connHandle uint16) *NakedSesn {
 	bx.mtx.Lock()
 	defer bx.mtx.Unlock()
@@ -617,6 +694,10 @@ func NewBleXport(cfg XportCfg) (*BleXport, error) {
 
 	bx.tq = task.NewTaskQueue("ble_xport")
 
+	if cfg.ReassemblyPoolMax > 0 {
+		bx.bufPool = nmxutil.NewBufPool(cfg.ReassemblyPoolMax)
+	}
+
 	bx.advertiser = NewAdvertiser(bx)
 	bx.master = NewMaster(bx)
 
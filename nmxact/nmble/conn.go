@@ -40,13 +40,55 @@ type Notification struct {
 type NotifyListener struct {
 	NotifyChan chan Notification
 	ErrChan    chan error
+
+	// Closed when the listener's owner stops receiving.  A pending delivery
+	// is abandoned rather than blocking the connection.
+	doneChan chan struct{}
+	doneOnce sync.Once
 }
 
 func NewNotifyListener() *NotifyListener {
 	return &NotifyListener{
 		NotifyChan: make(chan Notification),
 		ErrChan:    make(chan error, 1),
+		doneChan:   make(chan struct{}),
+	}
+}
+
+// Indicates that the owner will no longer receive from the listener.  Unlike
+// Conn.StopListening(), this does not require the connection's lock, so it is
+// safe to call while a notification is being delivered.
+func (nl *NotifyListener) stopRx() {
+	nl.doneOnce.Do(func() { close(nl.doneChan) })
+}
+
+// Indicates why the ATT MTU of a connection changed.
+type MtuChangeCause int
+
+const (
+	// Connection established with the default MTU.
+	MTU_CHANGE_CONNECT MtuChangeCause = iota
+
+	// MTU exchange procedure initiated by this side.
+	MTU_CHANGE_EXCHANGE
+
+	// MTU change reported by the host (e.g., an exchange initiated by the
+	// peer).
+	MTU_CHANGE_EVENT
+)
+
+var mtuChangeCauseStringMap = map[MtuChangeCause]string{
+	MTU_CHANGE_CONNECT:  "connect",
+	MTU_CHANGE_EXCHANGE: "exchange",
+	MTU_CHANGE_EVENT:    "event",
+}
+
+func (c MtuChangeCause) String() string {
+	s := mtuChangeCauseStringMap[c]
+	if s == "" {
+		return "???"
 	}
+	return s
 }
 
 // Sent up to the parent session to indicate that IO is required to complete a
@@ -91,6 +133,22 @@ type Conn struct {
 	notifyMap  map[*Characteristic]*NotifyListener
 	wg         sync.WaitGroup
 
+	// Handles of the CCCDs this side has written to enable notifications or
+	// indications.
+	cccds map[uint16]struct{}
+
+	// If set, shutting down releases the connection without terminating
+	// it.  Used while adopting a connection owned by someone else.
+	keepLink bool
+
+	// Receives the connection's events; see eventListen().
+	eventBl *Listener
+
+	// Temporary observers of incoming notifications, keyed by
+	// characteristic value handle.  Unlike notifyMap entries, several taps
+	// can observe the same characteristic alongside its listener.
+	taps map[uint16]map[chan []byte]struct{}
+
 	// Indicates a disconnect to the user of this type.
 	disconnectChan chan error
 
@@ -105,9 +163,37 @@ type Conn struct {
 	// The queue of actions that run in the main loop.
 	tq task.TaskQueue
 
+	// Link degradation detection.  If a request has been sent and nothing
+	// has been heard from the peer for longer than the window, the callback
+	// is executed.
+	degradedWindow time.Duration
+	degradedCb     func(idle time.Duration)
+	lastTx         time.Time
+	awaitingRx     bool
+	degraded       bool
+
+	// Inputs to the connection quality score.
+	quality linkQuality
+
+	// Supervision timeout requested in the most recent connect procedure.
+	// Reported in the connection descriptor when blehostd does not report
+	// the value in effect.
+	supervisionTmo time.Duration
+
+	// Whether a write command has been issued since the last ATT round
+	// trip; i.e., whether Flush() has anything to wait for.
+	unflushed bool
+
+	// Executed whenever the ATT MTU changes.
+	mtuChangeCb func(mtu uint16, cause MtuChangeCause)
+
 	// Protects:
 	// * connHandle
 	// * notifyMap
+	// * lastTx, awaitingRx, degraded, quality
+	// * unflushed
+	// * desc, attMtu
+	// * cccds
 	mtx sync.Mutex
 }
 
@@ -121,6 +207,8 @@ func NewConn(bx *BleXport) *Conn {
 		dropChan:       make(chan struct{}),
 		smIoChan:       make(chan SmIoDemand, 1),
 		notifyMap:      map[*Characteristic]*NotifyListener{},
+		cccds:          map[uint16]struct{}{},
+		taps:           map[uint16]map[chan []byte]struct{}{},
 	}
 
 	return c
@@ -143,6 +231,7 @@ func (c *Conn) abortNotifyListeners(err error) {
 		close(nl.NotifyChan)
 		close(nl.ErrChan)
 	}
+	c.notifyMap = map[*Characteristic]*NotifyListener{}
 }
 
 func (c *Conn) initTaskQueue() error {
@@ -171,6 +260,103 @@ func (c *Conn) runTask(fn func() error) error {
 	return err
 }
 
+// Configures the link degradation heuristic.  The callback is executed when a
+// request has gone unanswered by the peer for longer than the specified
+// window.  It is executed at most once per period of silence.  This must be
+// called before the connection is established.
+func (c *Conn) SetLinkDegradedCb(window time.Duration,
+	cb func(idle time.Duration)) {
+
+	c.degradedWindow = window
+	c.degradedCb = cb
+}
+
+// Sets the callback to execute whenever the connection's ATT MTU changes.
+// This must be called before the connection is established.
+func (c *Conn) SetMtuChangeCb(cb func(mtu uint16, cause MtuChangeCause)) {
+	c.mtuChangeCb = cb
+}
+
+func (c *Conn) setAttMtu(mtu uint16, cause MtuChangeCause) {
+	c.mtx.Lock()
+	log.Debugf("BLE ATT MTU updated; from=%d to=%d cause=%s",
+		c.attMtu, mtu, cause.String())
+	c.attMtu = mtu
+	c.mtx.Unlock()
+
+	if c.mtuChangeCb != nil {
+		c.mtuChangeCb(mtu, cause)
+	}
+}
+
+// Records that a request was sent to the peer.
+func (c *Conn) markTx() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if !c.awaitingRx {
+		c.lastTx = time.Now()
+		c.awaitingRx = true
+	}
+}
+
+// Records that something was received from the peer.  Assumes the mutex is
+// held.
+func (c *Conn) markRxNoLock() {
+	if c.awaitingRx {
+		c.quality.addLatency(time.Since(c.lastTx))
+	}
+	c.awaitingRx = false
+	c.degraded = false
+}
+
+func (c *Conn) markRx() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.markRxNoLock()
+}
+
+// Periodically checks for a degraded link in the background.
+func (c *Conn) degradedListen() {
+	if c.degradedCb == nil || c.degradedWindow <= 0 {
+		return
+	}
+
+	// Terminates on:
+	// * Connection drop.
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+
+		ticker := time.NewTicker(c.degradedWindow / 4)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				c.mtx.Lock()
+				idle := time.Since(c.lastTx)
+				fire := c.awaitingRx && !c.degraded &&
+					idle >= c.degradedWindow
+				if fire {
+					c.degraded = true
+				}
+				c.mtx.Unlock()
+
+				if fire {
+					log.Debugf("BLE link appears degraded; "+
+						"no response from peer in %s", idle)
+					c.degradedCb(idle)
+				}
+
+			case <-c.dropChan:
+				return
+			}
+		}
+	}()
+}
+
 func (c *Conn) writeHandle(handle uint16, payload []byte,
 	name string) error {
 
@@ -185,9 +371,14 @@ func (c *Conn) writeHandle(handle uint16, payload []byte,
 	}
 	defer c.rxvr.RemoveListener(name, bl)
 
+	c.markTx()
 	if err := write(c.bx, bl, r); err != nil {
+		c.recordWrite(false)
 		return err
 	}
+	c.markRx()
+	c.recordWrite(true)
+	c.setUnflushed(false)
 
 	return nil
 }
@@ -206,9 +397,13 @@ func (c *Conn) writeHandleNoRsp(handle uint16, payload []byte,
 	}
 	defer c.rxvr.RemoveListener(name, bl)
 
+	c.markTx()
 	if err := writeCmd(c.bx, bl, r); err != nil {
+		c.recordWrite(false)
 		return err
 	}
+	c.recordWrite(true)
+	c.setUnflushed(true)
 
 	return nil
 }
@@ -227,14 +422,25 @@ func (c *Conn) shutdown(cause error) error {
 		return err
 	}
 
+	c.mtx.Lock()
+	keepLink := c.keepLink
+	eventBl := c.eventBl
+	c.mtx.Unlock()
+
 	if c.connHandle != BLE_CONN_HANDLE_NONE {
-		c.terminate()
-		select {
-		case <-c.dropChan:
-		case <-time.After(time.Second * 30):
-			// This shouldn't happen.  Either blehostd is buggy or an event got
-			// dropped.
-			c.bx.Restart("No disconnect event received after 30 seconds")
+		if !keepLink {
+			c.terminate()
+			select {
+			case <-c.dropChan:
+			case <-time.After(time.Second * 30):
+				// This shouldn't happen.  Either blehostd is buggy or an event
+				// got dropped.
+				c.bx.Restart("No disconnect event received after 30 seconds")
+			}
+		} else if eventBl != nil {
+			// The link stays up, so no disconnect event will stop the event
+			// listener; release it instead.
+			c.bx.RemoveListener(eventBl)
 		}
 	}
 
@@ -254,9 +460,10 @@ func (c *Conn) shutdown(cause error) error {
 }
 
 func (c *Conn) newDisconnectError(reason int) error {
+	desc := c.ConnInfo()
 	str := fmt.Sprintf("BLE peer disconnected; "+
 		"reason=\"%s\" (%d) connection=%s",
-		ErrCodeToString(reason), reason, c.desc.String())
+		ErrCodeToString(reason), reason, desc.String())
 
 	return nmxutil.NewBleSesnDisconnectError(reason, str)
 }
@@ -268,6 +475,8 @@ func (c *Conn) eventListen(bl *Listener) error {
 	// * Receive of disconnect event.
 	//
 	// On terminate, this Goroutine shuts the connection object down.
+	c.eventBl = bl
+
 	c.wg.Add(1)
 	go func() {
 		defer c.wg.Done()
@@ -292,9 +501,7 @@ func (c *Conn) eventListen(bl *Listener) error {
 								msg.Status)
 							log.Debugf(err.Error())
 						} else {
-							log.Debugf("BLE ATT MTU updated; from=%d to=%d",
-								c.attMtu, msg.Mtu)
-							c.attMtu = msg.Mtu
+							c.setAttMtu(msg.Mtu, MTU_CHANGE_EVENT)
 						}
 
 					case *BleEncChangeEvt:
@@ -336,20 +543,36 @@ func (c *Conn) rxNotify(msg *BleNotifyRxEvt) {
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
 
+	c.markRxNoLock()
+
 	chr := c.profile.FindChrByHandle(uint16(msg.AttrHandle))
 	if chr == nil {
 		return
 	}
 
+	// Taps never block the connection; a tap that falls behind misses
+	// notifications.
+	for ch := range c.taps[chr.ValHandle] {
+		select {
+		case ch <- msg.Data.Bytes:
+		default:
+			log.Debugf("Notification tap full; dropping notification "+
+				"from %s", chr.String())
+		}
+	}
+
 	nl := c.notifyMap[chr]
 	if nl == nil {
 		return
 	}
 
-	nl.NotifyChan <- Notification{
+	select {
+	case nl.NotifyChan <- Notification{
 		Chr:        chr,
 		Data:       msg.Data.Bytes,
 		Indication: msg.Indication,
+	}:
+	case <-nl.doneChan:
 	}
 }
 
@@ -387,13 +610,22 @@ func (c *Conn) notifyListen() error {
 	return nil
 }
 
+// Queries blehostd for the current connection descriptor.  The query is
+// performed without the mutex held; only the store is locked.
 func (c *Conn) updateDescriptor() error {
-	d, err := ConnFindXact(c.bx, c.connHandle)
+	c.mtx.Lock()
+	connHandle := c.connHandle
+	c.mtx.Unlock()
+
+	d, err := ConnFindXact(c.bx, connHandle)
 	if err != nil {
 		return err
 	}
 
+	c.mtx.Lock()
 	c.desc = d
+	c.mtx.Unlock()
+
 	return nil
 }
 
@@ -401,20 +633,26 @@ func (c *Conn) finalizeConnection(connHandle uint16,
 	eventListener *Listener) error {
 
 	c.mtx.Lock()
-	defer c.mtx.Unlock()
 
 	c.connHandle = connHandle
 
 	// Listen for events in the background.
 	if err := c.eventListen(eventListener); err != nil {
+		c.mtx.Unlock()
 		return err
 	}
 
 	// Listen for notifications in the background.
 	if err := c.notifyListen(); err != nil {
+		c.mtx.Unlock()
 		return err
 	}
 
+	// Watch for a degraded link in the background.
+	c.degradedListen()
+
+	c.mtx.Unlock()
+
 	if err := c.updateDescriptor(); err != nil {
 		return err
 	}
@@ -430,10 +668,23 @@ func (c *Conn) IsConnected() bool {
 }
 
 func (c *Conn) ConnInfo() BleConnDesc {
-	return c.desc
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	d := c.desc
+	if c.connHandle != BLE_CONN_HANDLE_NONE {
+		d.Quality = c.qualityNoLock()
+		if d.SupervisionTimeout == 0 {
+			d.SupervisionTimeout = c.supervisionTmo
+		}
+	}
+	return d
 }
 
 func (c *Conn) AttMtu() uint16 {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
 	return c.attMtu
 }
 
@@ -441,8 +692,10 @@ func (c *Conn) Profile() *Profile {
 	return &c.profile
 }
 
+// Connects to the specified peer.  A supervisionTmo of 0 selects the host
+// default.
 func (c *Conn) Connect(ownAddrType BleAddrType, peer BleDev,
-	timeout time.Duration) error {
+	timeout time.Duration, supervisionTmo time.Duration) error {
 
 	if err := c.initTaskQueue(); err != nil {
 		return err
@@ -454,6 +707,20 @@ func (c *Conn) Connect(ownAddrType BleAddrType, peer BleDev,
 		r.PeerAddrType = peer.AddrType
 		r.PeerAddr = peer.Addr
 		r.DurationMs = int(timeout / time.Millisecond)
+		if supervisionTmo != 0 {
+			r.SupervisionTimeout = int(supervisionTmo /
+				BLE_SUPERVISION_TMO_UNIT)
+		}
+
+		st := time.Duration(r.SupervisionTimeout) * BLE_SUPERVISION_TMO_UNIT
+		if floor := SupervisionTmoFloor(r.ItvlMax, r.Latency); st <= floor {
+			return fmt.Errorf("Invalid supervision timeout: %s; must "+
+				"exceed %s", st, floor)
+		}
+
+		c.mtx.Lock()
+		c.supervisionTmo = st
+		c.mtx.Unlock()
 
 		bl, err := c.rxvr.AddListener("connect", SeqKey(r.Seq))
 		if err != nil {
@@ -517,7 +784,18 @@ func (c *Conn) Inherit(connHandle uint16, bl *Listener) error {
 	return nil
 }
 
-func (c *Conn) ExchangeMtu() error {
+// Configures whether shutting down the connection object leaves the
+// underlying BLE connection up.
+func (c *Conn) setKeepLink(keep bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.keepLink = keep
+}
+
+// Negotiates the ATT MTU with the peer.  If the peer does not answer within
+// the specified timeout, a BleMtuExchangeTmoError is returned.
+func (c *Conn) ExchangeMtu(timeout time.Duration) error {
 	fn := func() error {
 		r := NewBleExchangeMtuReq()
 		r.ConnHandle = c.connHandle
@@ -528,12 +806,12 @@ func (c *Conn) ExchangeMtu() error {
 		}
 		defer c.rxvr.RemoveListener("exchange-mtu", bl)
 
-		mtu, err := exchangeMtu(c.bx, bl, r)
+		mtu, err := exchangeMtu(c.bx, bl, r, timeout)
 		if isExchangeMtuError(err) {
 			return err
 		}
 
-		c.attMtu = uint16(mtu)
+		c.setAttMtu(uint16(mtu), MTU_CHANGE_EXCHANGE)
 		return nil
 	}
 
@@ -559,6 +837,110 @@ func (c *Conn) DiscoverSvcs() error {
 	return c.runTask(fn)
 }
 
+// Re-runs service discovery and replaces the cached profile.  Notification
+// listeners are carried over to the rediscovered characteristics; listeners
+// whose characteristic no longer exists are aborted.
+func (c *Conn) Rediscover() error {
+	fn := func() error {
+		svcs, err := c.discAllSvcs()
+		if err != nil {
+			return err
+		}
+
+		if err := c.discAllChrs(svcs); err != nil {
+			return err
+		}
+
+		c.mtx.Lock()
+		defer c.mtx.Unlock()
+
+		// Remember which characteristic each listener is attached to.  The
+		// characteristic objects are about to be replaced, so identify them
+		// by UUID.
+		ids := map[BleChrId]*NotifyListener{}
+		for id, chr := range c.profile.chrs {
+			if nl := c.notifyMap[chr]; nl != nil {
+				ids[id] = nl
+			}
+		}
+
+		c.profile.SetServices(svcs)
+
+		notifyMap := map[*Characteristic]*NotifyListener{}
+		for id, nl := range ids {
+			chr := c.profile.FindChrByUuid(id)
+			if chr == nil {
+				nl.ErrChan <- fmt.Errorf(
+					"Characteristic %s removed during rediscovery",
+					id.String())
+				close(nl.NotifyChan)
+				close(nl.ErrChan)
+			} else {
+				notifyMap[chr] = nl
+			}
+		}
+		c.notifyMap = notifyMap
+
+		// Descriptor handles may have moved; the caller is expected to
+		// subscribe again.
+		c.cccds = map[uint16]struct{}{}
+
+		return nil
+	}
+
+	return c.runTask(fn)
+}
+
+func (c *Conn) setUnflushed(unflushed bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.unflushed = unflushed
+}
+
+// Indicates whether write commands have been issued that Flush() has not yet
+// confirmed.
+func (c *Conn) Unflushed() bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return c.unflushed
+}
+
+// Blocks until all previously issued writes have reached the peer.
+// blehostd does not report when queued write commands leave the controller,
+// so this performs an ATT round trip instead: discovery of the GATT service.
+// ATT PDUs on a connection are delivered in order, so the peer's answer
+// implies that every earlier write arrived.
+func (c *Conn) Flush() error {
+	fn := func() error {
+		r := NewBleDiscSvcUuidReq()
+		r.ConnHandle = c.connHandle
+		r.Uuid = BleUuid{U16: GattSvcUuid}
+
+		bl, err := c.rxvr.AddListener("flush", SeqKey(r.Seq))
+		if err != nil {
+			return err
+		}
+		defer c.rxvr.RemoveListener("flush", bl)
+
+		c.markTx()
+		if _, err := discSvcUuid(c.bx, bl, r); err != nil {
+			// A peer lacking the service still answered the request.
+			bhe := nmxutil.ToBleHost(err)
+			if bhe == nil || bhe.Status != ERR_CODE_EDONE {
+				return err
+			}
+		}
+		c.markRx()
+		c.setUnflushed(false)
+
+		return nil
+	}
+
+	return c.runTask(fn)
+}
+
 func (c *Conn) WriteChr(chr *Characteristic, payload []byte,
 	name string) error {
 
@@ -579,32 +961,199 @@ func (c *Conn) WriteChrNoRsp(chr *Characteristic, payload []byte,
 	return c.runTask(fn)
 }
 
+// Determines the CCCD handle and value needed to subscribe to the specified
+// characteristic.
+func subscribeParams(chr *Characteristic) (uint16, []byte, error) {
+	uuid := BleUuid{CccdUuid, [16]byte{}}
+	dsc := FindDscByUuid(chr, uuid)
+	if dsc == nil {
+		return 0, nil, fmt.Errorf(
+			"Cannot subscribe to characteristic %s; no CCCD; properties=%s",
+			chr.Uuid.String(), chr.Properties.String())
+	}
+
+	var payload []byte
+	switch chr.SubscribeType() {
+	case BLE_DISC_CHR_PROP_NOTIFY:
+		payload = []byte{1, 0}
+	case BLE_DISC_CHR_PROP_INDICATE:
+		payload = []byte{2, 0}
+	default:
+		return 0, nil, fmt.Errorf("Cannot subscribe to characteristic %s; "+
+			"properties indicate unsubscribable; properties=%s",
+			chr.Uuid.String(), chr.Properties.String())
+	}
+
+	return dsc.Handle, payload, nil
+}
+
 func (c *Conn) Subscribe(chr *Characteristic) error {
 	fn := func() error {
-		uuid := BleUuid{CccdUuid, [16]byte{}}
-		dsc := FindDscByUuid(chr, uuid)
-		if dsc == nil {
-			return fmt.Errorf("Cannot subscribe to characteristic %s; no CCCD",
+		handle, payload, err := subscribeParams(chr)
+		if err != nil {
+			return err
+		}
+
+		if c.hasCccd(handle) {
+			log.Debugf("Already subscribed to %s; not rewriting CCCD",
 				chr.Uuid.String())
+			return nil
 		}
 
-		var payload []byte
-		switch chr.SubscribeType() {
-		case BLE_DISC_CHR_PROP_NOTIFY:
-			payload = []byte{1, 0}
-		case BLE_DISC_CHR_PROP_INDICATE:
-			payload = []byte{2, 0}
-		default:
-			return fmt.Errorf("Cannot subscribe to characteristic %s; "+
-				"properties indicate unsubscribable", chr.Uuid.String())
+		if err := c.writeCccd(handle, payload); err != nil {
+			return err
 		}
 
-		return c.writeHandle(dsc.Handle, payload, "subscribe")
+		c.addCccd(handle)
+		return nil
 	}
 
 	return c.runTask(fn)
 }
 
+// Writes a CCCD to enable notifications or indications.  A peer that retained
+// the subscription from an earlier connection may reject the write as
+// already in progress; the subscription is in place, so that counts as
+// success.
+func (c *Conn) writeCccd(handle uint16, payload []byte) error {
+	err := c.writeHandle(handle, payload, "subscribe")
+	if bhe := nmxutil.ToBleHost(err); bhe != nil &&
+		ErrCodeToAtt(bhe.Status) == ERR_CODE_ATT_PROC_IN_PROGRESS {
+
+		log.Debugf("Peer already subscribed via CCCD %d", handle)
+		return nil
+	}
+
+	return err
+}
+
+// Indicates whether this side has already enabled notifications or
+// indications via the specified CCCD on the current connection.  The peer's
+// CCCD cannot be read (blehostd has no GATT read), so a subscription that
+// the peer retained across a reconnect is not detected here; writeCccd()
+// handles the peer's rejection of the redundant write.
+func (c *Conn) hasCccd(handle uint16) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	_, ok := c.cccds[handle]
+	return ok
+}
+
+func (c *Conn) addCccd(handle uint16) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.cccds[handle] = struct{}{}
+}
+
+func (c *Conn) removeCccd(handle uint16) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	delete(c.cccds, handle)
+}
+
+// Disables notifications and indications on the specified characteristic.
+func (c *Conn) Unsubscribe(chr *Characteristic) error {
+	fn := func() error {
+		handle, _, err := subscribeParams(chr)
+		if err != nil {
+			return err
+		}
+
+		if err := c.writeHandle(handle, []byte{0, 0},
+			"unsubscribe"); err != nil {
+
+			return err
+		}
+
+		c.removeCccd(handle)
+		return nil
+	}
+
+	return c.runTask(fn)
+}
+
+// Disables every subscription established through this connection object.
+// All CCCDs are written even if one write fails; the first error is returned.
+func (c *Conn) UnsubscribeAll() error {
+	fn := func() error {
+		c.mtx.Lock()
+		handles := make([]uint16, 0, len(c.cccds))
+		for h := range c.cccds {
+			handles = append(handles, h)
+		}
+		c.mtx.Unlock()
+
+		var firstErr error
+		for _, h := range handles {
+			err := c.writeHandle(h, []byte{0, 0}, "unsubscribe")
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+
+			c.removeCccd(h)
+		}
+
+		return firstErr
+	}
+
+	return c.runTask(fn)
+}
+
+// Subscribes to several characteristics at once.  Rather than waiting for each
+// CCCD write to be acknowledged before sending the next, all writes are handed
+// to blehostd up front and the acknowledgements are collected afterwards; the
+// host queues the writes and the whole batch costs roughly one round trip.
+// The returned slice contains the result of each subscription, in the order
+// the characteristics were specified.
+func (c *Conn) SubscribeMulti(chrs []*Characteristic) []error {
+	errs := make([]error, len(chrs))
+
+	fn := func() error {
+		start := time.Now()
+
+		var wg sync.WaitGroup
+		for i, chr := range chrs {
+			handle, payload, err := subscribeParams(chr)
+			if err != nil {
+				errs[i] = err
+				continue
+			}
+			if c.hasCccd(handle) {
+				continue
+			}
+
+			wg.Add(1)
+			go func(i int, handle uint16, payload []byte) {
+				defer wg.Done()
+				errs[i] = c.writeCccd(handle, payload)
+				if errs[i] == nil {
+					c.addCccd(handle)
+				}
+			}(i, handle, payload)
+		}
+		wg.Wait()
+
+		log.Debugf("Subscribed to %d characteristic(s) in %s",
+			len(chrs), time.Since(start))
+
+		return nil
+	}
+
+	if err := c.runTask(fn); err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+	}
+
+	return errs
+}
+
 func (c *Conn) ListenForNotifications(chr *Characteristic) (
 	*NotifyListener, error) {
 
@@ -633,7 +1182,54 @@ func (c *Conn) ListenForNotifications(chr *Characteristic) (
 	return nl, nil
 }
 
-func (c *Conn) InitiateSecurity() error {
+// Starts copying notifications from the specified characteristic to a new
+// channel.  The tap coexists with any listener on the characteristic.
+func (c *Conn) addNotifyTap(chr *Characteristic) chan []byte {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	ch := make(chan []byte, NOTIFY_TAP_QUEUE_DEPTH)
+	if c.taps[chr.ValHandle] == nil {
+		c.taps[chr.ValHandle] = map[chan []byte]struct{}{}
+	}
+	c.taps[chr.ValHandle][ch] = struct{}{}
+
+	return ch
+}
+
+func (c *Conn) removeNotifyTap(chr *Characteristic, ch chan []byte) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	delete(c.taps[chr.ValHandle], ch)
+	if len(c.taps[chr.ValHandle]) == 0 {
+		delete(c.taps, chr.ValHandle)
+	}
+}
+
+// Detaches a listener created by ListenForNotifications() and closes its
+// channels.  This has no effect on the peer's CCCD.  Returns false if the
+// listener is no longer attached (e.g., because the connection dropped).
+func (c *Conn) StopListening(nl *NotifyListener) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for chr, cur := range c.notifyMap {
+		if cur == nl {
+			delete(c.notifyMap, chr)
+			close(nl.NotifyChan)
+			close(nl.ErrChan)
+			return true
+		}
+	}
+
+	return false
+}
+
+// Initiates the security procedure and waits for the link to become
+// encrypted.  If the procedure does not complete within the specified timeout,
+// a BleSecurityTmoError is returned.
+func (c *Conn) InitiateSecurity(timeout time.Duration) error {
 	fn := func() error {
 		r := NewBleSecurityInitiateReq()
 		r.ConnHandle = c.connHandle
@@ -649,12 +1245,18 @@ func (c *Conn) InitiateSecurity() error {
 			return err
 		}
 
-		encErr, tmoErr := c.encBlocker.Wait(time.Second*15, c.dropChan)
+		encErr, tmoErr := c.encBlocker.Wait(timeout, c.dropChan)
 		if encErr != nil {
 			return encErr.(error)
 		}
 		if tmoErr != nil {
-			return fmt.Errorf("Timeout waiting for security to be established")
+			// End the procedure with the timeout error.  Anything else
+			// waiting on the blocker sees the failure rather than success.
+			err := nmxutil.NewBleSecurityTmoError(fmt.Sprintf(
+				"Timeout waiting for security to be established; "+
+					"timeout=%s", timeout))
+			c.encBlocker.Unblock(err)
+			return err
 		}
 
 		return nil
@@ -684,6 +1286,23 @@ func (c *Conn) Stop() error {
 	return c.runShutdown(fmt.Errorf("stopped"))
 }
 
+// Breaks the connection without waiting for the connection's task queue.
+// The link is terminated (unless it is being kept alive), all procedures
+// waiting on blehostd fail, and a shutdown is queued to run once the current
+// job returns.  Intended for a connection with a stuck job.
+func (c *Conn) Abort(cause error) {
+	c.mtx.Lock()
+	keepLink := c.keepLink
+	c.mtx.Unlock()
+
+	if c.connHandle != BLE_CONN_HANDLE_NONE && !keepLink {
+		c.terminate()
+	}
+
+	c.rxvr.RemoveAll("abort")
+	c.enqueueShutdown(cause)
+}
+
 func (c *Conn) discAllDscsOnce(startHandle uint16, endHandle uint16) (
 	[]*Descriptor, error) {
 
@@ -0,0 +1,129 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package nmble
+
+import (
+	"time"
+)
+
+// Connection quality heuristic.  blehostd reports neither the connection's
+// RSSI nor its supervision timeout, so the score is derived from what the
+// host can observe of the peer's responsiveness.  Starting from 100, points
+// are deducted for:
+//
+//   - Latency (up to 40): the smoothed time between a request and the next
+//     packet from the peer.  No penalty up to QUALITY_LATENCY_GOOD; the full
+//     penalty at QUALITY_LATENCY_BAD or worse.
+//   - Failures (up to 40): the smoothed fraction of recent ATT writes that
+//     failed or timed out.
+//   - Stall (up to 20): how long the peer has been silent while a response
+//     is outstanding, relative to QUALITY_STALL_BAD.  A peer that stays
+//     silent is likely approaching its supervision timeout.
+//
+// A freshly established connection scores 100.
+const (
+	QUALITY_LATENCY_GOOD = 100 * time.Millisecond
+	QUALITY_LATENCY_BAD  = 2 * time.Second
+	QUALITY_STALL_BAD    = 4 * time.Second
+
+	qualityLatencyWeight = 40
+	qualityFailWeight    = 40
+	qualityStallWeight   = 20
+
+	// Smoothing factor of the moving averages; each sample contributes 1/8.
+	qualityAlpha = 0.125
+)
+
+type linkQuality struct {
+	latency    time.Duration
+	hasLatency bool
+	failRate   float64
+}
+
+func (q *linkQuality) addLatency(d time.Duration) {
+	if !q.hasLatency {
+		q.latency = d
+		q.hasLatency = true
+	} else {
+		q.latency += time.Duration(qualityAlpha * float64(d-q.latency))
+	}
+}
+
+func (q *linkQuality) addWrite(ok bool) {
+	sample := 0.0
+	if !ok {
+		sample = 1.0
+	}
+	q.failRate += qualityAlpha * (sample - q.failRate)
+}
+
+// Maps `val` onto [0, 1], where `good` and below is 0 and `bad` and above is
+// 1.
+func qualityFraction(val time.Duration, good time.Duration,
+	bad time.Duration) float64 {
+
+	if val <= good {
+		return 0
+	}
+	if val >= bad {
+		return 1
+	}
+	return float64(val-good) / float64(bad-good)
+}
+
+// Records the outcome of an ATT write.
+func (c *Conn) recordWrite(ok bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.quality.addWrite(ok)
+}
+
+// Assumes the mutex is held.
+func (c *Conn) qualityNoLock() int {
+	penalty := 0.0
+
+	if c.quality.hasLatency {
+		penalty += qualityLatencyWeight * qualityFraction(
+			c.quality.latency, QUALITY_LATENCY_GOOD, QUALITY_LATENCY_BAD)
+	}
+
+	penalty += qualityFailWeight * c.quality.failRate
+
+	if c.awaitingRx {
+		penalty += qualityStallWeight * qualityFraction(
+			time.Since(c.lastTx), 0, QUALITY_STALL_BAD)
+	}
+
+	score := 100 - int(penalty+0.5)
+	if score < 0 {
+		score = 0
+	}
+	return score
+}
+
+// Quality calculates the connection's current quality score, from 0
+// (unusable) to 100 (healthy).  See the heuristic described above.
+func (c *Conn) Quality() int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return c.qualityNoLock()
+}
@@ -20,6 +20,7 @@
 package nmble
 
 import (
+	"fmt"
 	"sync"
 	"time"
 
@@ -47,6 +48,13 @@ type DiscovererParams struct {
 
 // Listens for advertisements; reports the ones that match the specified
 // predicate.  This type is not thread-safe.
+//
+// Scanning does not disturb established connections; the controller
+// interleaves scan windows with connection events.  Some controllers can't
+// do this, and reject the scan while any connection is up.  In this case,
+// the discoverer reports a BleCapabilityError rather than the raw host
+// error.  Scanning and initiating a connection are always mutually
+// exclusive; callers serialize them with the transport's master resource.
 type Discoverer struct {
 	params   DiscovererParams
 	bl       *Listener
@@ -82,6 +90,25 @@ func (d *Discoverer) scanCancel() error {
 	return nil
 }
 
+// Indicates whether a scan failure means the controller can't scan while
+// connected.
+func isScanConflict(err error) bool {
+	bhe := nmxutil.ToBleHost(err)
+	if bhe == nil {
+		return false
+	}
+
+	switch bhe.Status {
+	case ERR_CODE_ENOTSUP,
+		ERR_CODE_HCI_BASE + ERR_CODE_HCI_CMD_DISALLOWED,
+		ERR_CODE_HCI_BASE + ERR_CODE_HCI_UNSUPPORTED,
+		ERR_CODE_HCI_BASE + ERR_CODE_HCI_CTLR_BUSY:
+		return true
+	default:
+		return false
+	}
+}
+
 func (d *Discoverer) Start() (<-chan BleAdvReport, <-chan error, error) {
 	d.mtx.Lock()
 	defer d.mtx.Unlock()
@@ -141,6 +168,14 @@ func (d *Discoverer) Start() (<-chan BleAdvReport, <-chan error, error) {
 			}
 		}
 
+		if isScanConflict(err) {
+			if n := d.params.Bx.NumSesns(); n > 0 {
+				err = nmxutil.NewBleCapabilityError(fmt.Sprintf(
+					"BLE controller cannot scan while connected; "+
+						"open_sessions=%d: %s", n, err.Error()))
+			}
+		}
+
 		d.mtx.Lock()
 		defer d.mtx.Unlock()
 
@@ -0,0 +1,474 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package nmble
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	. "mynewt.apache.org/newtmgr/nmxact/bledefs"
+	"mynewt.apache.org/newtmgr/nmxact/sesn"
+)
+
+// The connection handle the fake host assigns to its only connection.
+const fakeConnHandle = 1
+
+// Attribute handles of the fake peer's plain NMP service.  Besides the NMP
+// characteristic, the service contains a second notifiable characteristic
+// for tests that subscribe on their own.
+const (
+	fakeNmpSvcStart  = 10
+	fakeNmpChrDef    = 11
+	fakeNmpChrVal    = 12
+	fakeNmpCccd      = 13
+	fakeUserChrDef   = 14
+	fakeUserChrVal   = 15
+	fakeUserCccd     = 16
+	fakeNmpSvcEnd    = 16
+	fakeDfltPeerAddr = "01:02:03:04:05:06"
+)
+
+// The name the fake peer advertises.
+const fakePeerName = "fake-peer"
+
+const fakeUserChrUuid = "8d53dc1d-1db7-4cd3-868b-8a527460aa84"
+
+// Identifies the fake peer's second notifiable characteristic.
+func fakeUserChrId() *BleChrId {
+	svcUuid, _ := ParseUuid(NmpPlainSvcUuid)
+	chrUuid, _ := ParseUuid(fakeUserChrUuid)
+
+	return &BleChrId{
+		SvcUuid: svcUuid,
+		ChrUuid: chrUuid,
+	}
+}
+
+// A stand-in for blehostd.  It answers the requests a session issues while
+// opening, using, and closing a connection to a single peer whose GATT
+// profile contains the plain NMP service.  Messages to the transport are
+// delivered in order from a single Goroutine, as blehostd would send them.
+type fakeHost struct {
+	bx   *BleXport
+	rxq  chan []byte
+	stop chan struct{}
+	wg   sync.WaitGroup
+
+	mtx sync.Mutex
+
+	// The ATT MTU reported by MTU exchange.
+	mtu uint16
+
+	// If set, security procedures are accepted but never complete.
+	secNeverDone bool
+
+	// Optional; overrides the default handling of a request.  Returns true
+	// if the request was handled.
+	hook func(base MsgBase, data []byte) bool
+
+	// Optional; produces the notifications sent in response to a write to
+	// the NMP characteristic.
+	nmpRsp func(req []byte) [][]byte
+
+	// The sequence number of the connect request; connection events carry
+	// it.
+	connSeq BleSeq
+
+	// Type of every request received, in order.
+	reqs []MsgType
+
+	// Payloads written to the NMP characteristic, in order.
+	nmpWrites [][]byte
+}
+
+func newFakeHost(bx *BleXport) *fakeHost {
+	h := &fakeHost{
+		bx:   bx,
+		rxq:  make(chan []byte, 256),
+		stop: make(chan struct{}),
+		mtu:  256,
+	}
+
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		for {
+			select {
+			case b := <-h.rxq:
+				h.bx.d.Dispatch(b)
+			case <-h.stop:
+				return
+			}
+		}
+	}()
+
+	return h
+}
+
+func (h *fakeHost) close() {
+	close(h.stop)
+	h.wg.Wait()
+}
+
+// Queues a message for delivery to the transport.
+func (h *fakeHost) send(msg interface{}) {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		panic(err)
+	}
+	h.rxq <- b
+}
+
+// Sends a notification from the NMP characteristic.
+func (h *fakeHost) notify(data []byte) {
+	h.notifyAttr(fakeNmpChrVal, data)
+}
+
+// Sends a notification from the characteristic with the specified value
+// handle.
+func (h *fakeHost) notifyAttr(valHandle int, data []byte) {
+	h.send(&BleNotifyRxEvt{
+		Op:         MSG_OP_EVT,
+		Type:       MSG_TYPE_NOTIFY_RX_EVT,
+		Seq:        BLE_SEQ_NONE,
+		ConnHandle: fakeConnHandle,
+		AttrHandle: valHandle,
+		Data:       BleBytes{Bytes: data},
+	})
+}
+
+// Terminates the connection from the peer's side.
+func (h *fakeHost) disconnect(reason int) {
+	h.mtx.Lock()
+	seq := h.connSeq
+	h.mtx.Unlock()
+
+	h.send(&BleDisconnectEvt{
+		Op:         MSG_OP_EVT,
+		Type:       MSG_TYPE_DISCONNECT_EVT,
+		Seq:        seq,
+		Reason:     reason,
+		ConnHandle: fakeConnHandle,
+	})
+}
+
+// Retrieves the number of requests of the specified type received so far.
+func (h *fakeHost) numReqs(typ MsgType) int {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	n := 0
+	for _, t := range h.reqs {
+		if t == typ {
+			n++
+		}
+	}
+	return n
+}
+
+func (h *fakeHost) writes() [][]byte {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	return append([][]byte(nil), h.nmpWrites...)
+}
+
+// Implements hostLink.
+func (h *fakeHost) TxToChild(data []byte) error {
+	base, err := decodeBleBase(data)
+	if err != nil {
+		return err
+	}
+
+	h.mtx.Lock()
+	h.reqs = append(h.reqs, base.Type)
+	hook := h.hook
+	h.mtx.Unlock()
+
+	if hook != nil && hook(base, data) {
+		return nil
+	}
+
+	h.handle(base, data)
+	return nil
+}
+
+func (h *fakeHost) rspStatus(base MsgBase, status int) {
+	// Every blehostd response has the same layout; the type in the header
+	// selects the concrete response type on decode.
+	h.send(&BleErrRsp{
+		Op:     MSG_OP_RSP,
+		Type:   base.Type,
+		Seq:    base.Seq,
+		Status: status,
+	})
+}
+
+func (h *fakeHost) done(base MsgBase, typ MsgType) {
+	h.send(&struct {
+		Op     MsgOp   `json:"op"`
+		Type   MsgType `json:"type"`
+		Seq    BleSeq  `json:"seq"`
+		Status int     `json:"status"`
+	}{MSG_OP_EVT, typ, base.Seq, ERR_CODE_EDONE})
+}
+
+func (h *fakeHost) handle(base MsgBase, data []byte) {
+	svcUuid, _ := ParseUuid(NmpPlainSvcUuid)
+	chrUuid, _ := ParseUuid(NmpPlainChrUuid)
+	userChrUuid, _ := ParseUuid(fakeUserChrUuid)
+
+	switch base.Type {
+	case MSG_TYPE_CONNECT:
+		h.mtx.Lock()
+		h.connSeq = base.Seq
+		h.mtx.Unlock()
+
+		h.rspStatus(base, 0)
+		h.send(&BleConnectEvt{
+			Op:         MSG_OP_EVT,
+			Type:       MSG_TYPE_CONNECT_EVT,
+			Seq:        base.Seq,
+			ConnHandle: fakeConnHandle,
+		})
+
+	case MSG_TYPE_SCAN:
+		// The peer advertises once; the scanner cancels the scan when it
+		// finds a match.
+		peer, _ := ParseBleAddr(fakeDfltPeerAddr)
+		name := fakePeerName
+
+		h.rspStatus(base, 0)
+		h.send(&BleScanEvt{
+			Op:        MSG_OP_EVT,
+			Type:      MSG_TYPE_SCAN_EVT,
+			Seq:       base.Seq,
+			EventType: BLE_ADV_EVENT_IND,
+			AddrType:  BLE_ADDR_TYPE_RANDOM,
+			Addr:      peer,
+			Rssi:      -40,
+			DataName:  &name,
+		})
+
+	case MSG_TYPE_CONN_FIND:
+		peer, _ := ParseBleAddr(fakeDfltPeerAddr)
+		h.send(&BleConnFindRsp{
+			Op:              MSG_OP_RSP,
+			Type:            MSG_TYPE_CONN_FIND,
+			Seq:             base.Seq,
+			ConnHandle:      fakeConnHandle,
+			PeerIdAddrType:  BLE_ADDR_TYPE_RANDOM,
+			PeerIdAddr:      peer,
+			PeerOtaAddrType: BLE_ADDR_TYPE_RANDOM,
+			PeerOtaAddr:     peer,
+		})
+
+	case MSG_TYPE_EXCHANGE_MTU:
+		h.mtx.Lock()
+		mtu := h.mtu
+		h.mtx.Unlock()
+
+		h.rspStatus(base, 0)
+		h.send(&BleMtuChangeEvt{
+			Op:         MSG_OP_EVT,
+			Type:       MSG_TYPE_MTU_CHANGE_EVT,
+			Seq:        base.Seq,
+			ConnHandle: fakeConnHandle,
+			Mtu:        mtu,
+		})
+
+	case MSG_TYPE_DISC_ALL_SVCS, MSG_TYPE_DISC_SVC_UUID:
+		// The peer has a single service: NMP.
+		h.rspStatus(base, 0)
+		h.send(&BleDiscSvcEvt{
+			Op:   MSG_OP_EVT,
+			Type: MSG_TYPE_DISC_SVC_EVT,
+			Seq:  base.Seq,
+			Svc: BleDiscSvc{
+				StartHandle: fakeNmpSvcStart,
+				EndHandle:   fakeNmpSvcEnd,
+				Uuid:        svcUuid,
+			},
+		})
+		h.done(base, MSG_TYPE_DISC_SVC_EVT)
+
+	case MSG_TYPE_DISC_ALL_CHRS:
+		h.rspStatus(base, 0)
+		h.send(&BleDiscChrEvt{
+			Op:   MSG_OP_EVT,
+			Type: MSG_TYPE_DISC_CHR_EVT,
+			Seq:  base.Seq,
+			Chr: BleDiscChr{
+				DefHandle: fakeNmpChrDef,
+				ValHandle: fakeNmpChrVal,
+				Properties: int(BLE_DISC_CHR_PROP_WRITE |
+					BLE_DISC_CHR_PROP_WRITE_NO_RSP |
+					BLE_DISC_CHR_PROP_NOTIFY),
+				Uuid: chrUuid,
+			},
+		})
+		h.send(&BleDiscChrEvt{
+			Op:   MSG_OP_EVT,
+			Type: MSG_TYPE_DISC_CHR_EVT,
+			Seq:  base.Seq,
+			Chr: BleDiscChr{
+				DefHandle:  fakeUserChrDef,
+				ValHandle:  fakeUserChrVal,
+				Properties: int(BLE_DISC_CHR_PROP_NOTIFY),
+				Uuid:       userChrUuid,
+			},
+		})
+		h.done(base, MSG_TYPE_DISC_CHR_EVT)
+
+	case MSG_TYPE_DISC_ALL_DSCS:
+		var req BleDiscAllDscsReq
+		if err := json.Unmarshal(data, &req); err != nil {
+			panic(err)
+		}
+
+		// Each characteristic's CCCD immediately follows its value.
+		var defHandle, cccd uint16 = fakeNmpChrDef, fakeNmpCccd
+		if req.StartHandle > fakeNmpCccd {
+			defHandle, cccd = fakeUserChrDef, fakeUserCccd
+		}
+
+		h.rspStatus(base, 0)
+		h.send(&BleDiscDscEvt{
+			Op:           MSG_OP_EVT,
+			Type:         MSG_TYPE_DISC_DSC_EVT,
+			Seq:          base.Seq,
+			ChrDefHandle: defHandle,
+			Dsc: BleDiscDsc{
+				Handle: cccd,
+				Uuid:   BleUuid{U16: CccdUuid},
+			},
+		})
+		h.done(base, MSG_TYPE_DISC_DSC_EVT)
+
+	case MSG_TYPE_WRITE, MSG_TYPE_WRITE_CMD:
+		var req BleWriteReq
+		if err := json.Unmarshal(data, &req); err != nil {
+			panic(err)
+		}
+
+		h.rspStatus(base, 0)
+		if base.Type == MSG_TYPE_WRITE {
+			h.send(&BleWriteAckEvt{
+				Op:   MSG_OP_EVT,
+				Type: MSG_TYPE_WRITE_ACK_EVT,
+				Seq:  base.Seq,
+			})
+		}
+
+		if req.AttrHandle == fakeNmpChrVal {
+			h.mtx.Lock()
+			h.nmpWrites = append(h.nmpWrites, req.Data.Bytes)
+			nmpRsp := h.nmpRsp
+			h.mtx.Unlock()
+
+			if nmpRsp != nil {
+				for _, n := range nmpRsp(req.Data.Bytes) {
+					h.notify(n)
+				}
+			}
+		}
+
+	case MSG_TYPE_SECURITY_INITIATE:
+		h.mtx.Lock()
+		never := h.secNeverDone
+		seq := h.connSeq
+		h.mtx.Unlock()
+
+		h.rspStatus(base, 0)
+		if !never {
+			h.send(&BleEncChangeEvt{
+				Op:         MSG_OP_EVT,
+				Type:       MSG_TYPE_ENC_CHANGE_EVT,
+				Seq:        seq,
+				ConnHandle: fakeConnHandle,
+			})
+		}
+
+	case MSG_TYPE_TERMINATE:
+		h.rspStatus(base, 0)
+		h.disconnect(ERR_CODE_HCI_REM_USER_CONN_TERM)
+
+	case MSG_TYPE_CONN_CANCEL:
+		h.rspStatus(base, ERR_CODE_EALREADY)
+
+	default:
+		h.rspStatus(base, 0)
+	}
+}
+
+// Creates a transport whose blehostd is a fake host.  The returned function
+// stops both.
+func newFakeXport(t *testing.T) (*BleXport, *fakeHost, func()) {
+	cfg := NewXportCfg()
+	cfg.BlehostdRspTimeout = 2 * time.Second
+
+	bx, err := NewBleXport(cfg)
+	if err != nil {
+		t.Fatalf("NewBleXport: %s", err.Error())
+	}
+
+	h := newFakeHost(bx)
+	bx.link = h
+	bx.stopChan = make(chan struct{})
+	if err := bx.tq.Start(10); err != nil {
+		t.Fatalf("starting transport task queue: %s", err.Error())
+	}
+
+	stop := func() {
+		bx.tq.Stop(fmt.Errorf("test complete"))
+		h.close()
+	}
+
+	return bx, h, stop
+}
+
+// Creates a session configuration that connects to the fake host's peer.
+func newFakeSesnCfg() sesn.SesnCfg {
+	cfg := sesn.NewSesnCfg()
+	cfg.MgmtProto = sesn.MGMT_PROTO_NMP
+	cfg.Ble.Central.ConnTries = 1
+	cfg.Ble.Central.ConnTimeout = 2 * time.Second
+	cfg.Ble.ShutdownTimeout = 2 * time.Second
+	cfg.Ble.SecurityTimeout = 2 * time.Second
+
+	addr, _ := ParseBleAddr(fakeDfltPeerAddr)
+	cfg.PeerSpec.Ble = BleDev{
+		AddrType: BLE_ADDR_TYPE_RANDOM,
+		Addr:     addr,
+	}
+
+	return cfg
+}
+
+func newFakeSesn(t *testing.T, bx *BleXport, cfg sesn.SesnCfg) *NakedSesn {
+	s, err := NewNakedSesn(bx, cfg)
+	if err != nil {
+		t.Fatalf("NewNakedSesn: %s", err.Error())
+	}
+	return s
+}
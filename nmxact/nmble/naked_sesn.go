@@ -20,7 +20,12 @@
 package nmble
 
 import (
+	"context"
 	"fmt"
+	"math/rand"
+	"runtime/debug"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -53,6 +58,184 @@ const (
 	NS_STATE_OPEN
 )
 
+// The number of received notifications that can be queued for dispatch on a
+// single characteristic before reception stalls.
+const NOTIFY_DISPATCH_QUEUE_DEPTH = 32
+
+// The number of notifications that can be queued for a WaitForNotification()
+// call before further ones are dropped.
+const NOTIFY_TAP_QUEUE_DEPTH = 16
+
+// Default capacity of each lane of a session's task queue.
+const NAKED_SESN_TQ_DEPTH = 10
+
+// Default durations of the security and ATT MTU exchange procedures.
+const NAKED_SESN_SECURITY_TMO = 15 * time.Second
+const NAKED_SESN_MTU_EXCHANGE_TMO = 5 * time.Second
+
+// Names of the metrics emitted to SesnCfg.MetricsSink.
+const (
+	METRIC_BLE_CONNECT       = "ble.connect"
+	METRIC_BLE_CONNECT_TIME  = "ble.connect_time"
+	METRIC_BLE_CONNECT_RETRY = "ble.connect_retry"
+	METRIC_BLE_DISCONNECT    = "ble.disconnect"
+	METRIC_BLE_ATT_MTU       = "ble.att_mtu"
+	METRIC_BLE_TX_BYTES      = "ble.tx_bytes"
+	METRIC_BLE_RX_BYTES      = "ble.rx_bytes"
+	METRIC_BLE_MGMT_LATENCY  = "ble.mgmt_latency"
+	METRIC_BLE_MGMT_ERROR    = "ble.mgmt_error"
+	METRIC_BLE_TX_QUOTA_USED = "ble.tx_quota_used"
+	METRIC_BLE_GOODPUT       = "ble.goodput"
+)
+
+// Minimum delay between consecutive attempts in OpenUntil().
+const OPEN_RETRY_DELAY = 250 * time.Millisecond
+
+// The maximum number of entries retained in a session's MTU history.
+const MTU_HISTORY_SIZE = 16
+
+// A single entry in a session's MTU history.
+type MtuChange struct {
+	Time  time.Time
+	Mtu   uint16
+	Cause MtuChangeCause
+}
+
+// A step in the procedure that establishes a session.
+type ConnectPhase int
+
+const (
+	CONNECT_PHASE_START ConnectPhase = iota
+	CONNECT_PHASE_SCAN
+	CONNECT_PHASE_CONNECT
+	CONNECT_PHASE_MTU
+	CONNECT_PHASE_DISCOVER
+	CONNECT_PHASE_SUBSCRIBE
+	CONNECT_PHASE_SECURE
+)
+
+var connectPhaseStringMap = map[ConnectPhase]string{
+	CONNECT_PHASE_START:     "start",
+	CONNECT_PHASE_SCAN:      "scan",
+	CONNECT_PHASE_CONNECT:   "connect",
+	CONNECT_PHASE_MTU:       "mtu",
+	CONNECT_PHASE_DISCOVER:  "discover",
+	CONNECT_PHASE_SUBSCRIBE: "subscribe",
+	CONNECT_PHASE_SECURE:    "secure",
+}
+
+func (p ConnectPhase) String() string {
+	s := connectPhaseStringMap[p]
+	if s == "" {
+		return "???"
+	}
+	return s
+}
+
+// Records when a connection phase completed.  The START entry records when
+// the connect attempt began.
+type ConnectPhaseTime struct {
+	Phase ConnectPhase
+	Time  time.Time
+}
+
+// Describes a failed connect attempt that is eligible for a retry.  The
+// session's retry callback receives errors of this type.
+type ConnectRetryError struct {
+	Phase ConnectPhase // The phase that failed.
+	Err   error
+}
+
+func (e *ConnectRetryError) Error() string {
+	return fmt.Sprintf("BLE connect failed during %s phase: %s",
+		e.Phase.String(), e.Err.Error())
+}
+
+// Returned when a session shut down without waiting for all of its
+// background Goroutines.  The session is closed; the Goroutines listed in
+// Stuck were still running (e.g., blocked in a user callback) and have been
+// abandoned.
+type ShutdownTimeoutError struct {
+	Timeout time.Duration
+	Stuck   []string
+}
+
+func (e *ShutdownTimeoutError) Error() string {
+	return fmt.Sprintf("BLE session shutdown timed out after %s; "+
+		"stuck goroutines: %s", e.Timeout, strings.Join(e.Stuck, ", "))
+}
+
+// Tracks a set of named Goroutines.  A session uses a fresh group for each
+// connection so that a Goroutine abandoned by a timed-out shutdown cannot
+// disturb the next connection's bookkeeping.
+type routineGroup struct {
+	wg     sync.WaitGroup
+	mtx    sync.Mutex
+	active map[string]int
+}
+
+func newRoutineGroup() *routineGroup {
+	return &routineGroup{
+		active: map[string]int{},
+	}
+}
+
+// Runs the specified function in a tracked Goroutine.
+func (g *routineGroup) Go(name string, fn func()) {
+	g.mtx.Lock()
+	g.active[name]++
+	g.mtx.Unlock()
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer func() {
+			g.mtx.Lock()
+			defer g.mtx.Unlock()
+
+			g.active[name]--
+			if g.active[name] <= 0 {
+				delete(g.active, name)
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// Waits for all tracked Goroutines to terminate.  A timeout of 0 means wait
+// indefinitely.  If the timeout expires first, the sorted names of the
+// Goroutines still running are returned; otherwise nil.
+func (g *routineGroup) Wait(timeout time.Duration) []string {
+	if timeout == 0 {
+		g.wg.Wait()
+		return nil
+	}
+
+	doneChan := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(doneChan)
+	}()
+
+	select {
+	case <-doneChan:
+		return nil
+	case <-time.After(timeout):
+	}
+
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	stuck := make([]string, 0, len(g.active))
+	for name := range g.active {
+		stuck = append(stuck, name)
+	}
+	sort.Strings(stuck)
+
+	return stuck
+}
+
 // Implements a BLE session that does not acquire the master resource on
 // connect.  The user of this type must acquire the resource manually.
 type NakedSesn struct {
@@ -62,11 +245,60 @@ type NakedSesn struct {
 	mgmtChrs BleMgmtChrs
 	txvr     *mgmt.Transceiver
 	tq       task.TaskQueue
+	metrics  nmxutil.MetricsSink
+	goodput  *nmxutil.GoodputMeter
 
-	wg sync.WaitGroup
+	// With more than one task queue worker, requests run concurrently.
+	// Request jobs hold this lock shared; jobs that change the session's
+	// lifecycle (close, pause, rediscover, shutdown) hold it exclusively,
+	// so they never run alongside a request.
+	jobMtx sync.RWMutex
+
+	// Background Goroutines of the current connection.  Replaced on each
+	// open attempt.
+	routines *routineGroup
 
 	stopChan chan struct{}
 
+	// Closed by AbortOpen() to cancel an in-progress open procedure.  Nil
+	// when the session is not being opened.
+	abortChan chan struct{}
+
+	// Closed when the session becomes fully open.  Notifications received
+	// during the open procedure are held until then.
+	openChan chan struct{}
+
+	// Closed when a fully-open session finishes shutting down.
+	closeChan  chan struct{}
+	closeCause error
+
+	// The connection handle the session is registered with the transport
+	// under.  The connection clears its own handle when it drops, before the
+	// session shuts down.
+	regHandle uint16
+
+	// Notification subscriptions; protected by mtx.  Cancelled on
+	// shutdown, except that SubscribeChr() subscriptions are only detached
+	// while the session is paused.
+	subs map[*Subscription]struct{}
+
+	// Set by Pause(); cleared by Resume() and Close().
+	paused bool
+
+	// Nil if the session has no transmit quota.
+	quota *nmxutil.ByteQuota
+
+	// The advertisement that selected the peer of the current connection;
+	// nil if the peer was specified by address.  Protected by mtx.
+	matchedAdv *BleAdvReport
+
+	// Most recent ATT MTU changes, oldest first.  Spans reconnects.
+	mtuHistory []MtuChange
+
+	// Phase completion times of the most recent connect attempt.  Only
+	// populated if timing is enabled.
+	timeline []ConnectPhaseTime
+
 	// Protects `enabled` and `opening`.
 	mtx sync.Mutex
 
@@ -79,21 +311,56 @@ type NakedSesn struct {
 
 func (s *NakedSesn) init() error {
 	s.conn = NewConn(s.bx)
+	s.conn.SetMtuChangeCb(s.recordMtu)
+	if s.cfg.Ble.LinkDegradedCb != nil {
+		s.conn.SetLinkDegradedCb(s.cfg.Ble.LinkDegradedWindow,
+			func(idle time.Duration) { s.cfg.Ble.LinkDegradedCb(s, idle) })
+	}
 	s.stopChan = make(chan struct{})
+	s.openChan = make(chan struct{})
+	s.routines = newRoutineGroup()
+	if s.subs == nil {
+		s.subs = map[*Subscription]struct{}{}
+	}
 
+	// A paused session retains its transceiver so that observe
+	// relationships survive until Resume().
 	if s.txvr != nil {
+		if s.paused {
+			return s.startTq()
+		}
 		s.txvr.Stop()
 	}
 
 	txvr, err := mgmt.NewTransceiver(s.cfg.TxFilterCb, s.cfg.RxFilterCb, true,
-		s.cfg.MgmtProto, 3)
+		s.cfg.MgmtProto, s.cfg.TxvrLogDepth)
 	if err != nil {
 		return err
 	}
 	s.txvr = txvr
+	s.txvr.SetUnsolicitedCb(s.cfg.UnsolicitedCb)
+	s.txvr.SetRxFragTimeout(s.cfg.RxFragTimeout)
+	s.txvr.SetFragGapCb(s.cfg.FragGapCb)
+	s.txvr.SetProtoMismatchCb(s.cfg.ProtoMismatchCb, s.cfg.ProtoStrict)
+	s.txvr.SetBufPool(s.bx.bufPool)
+
+	return s.startTq()
+}
+
+func (s *NakedSesn) startTq() error {
+	depth := s.cfg.Ble.TaskQueueDepth
+	if depth == 0 {
+		depth = NAKED_SESN_TQ_DEPTH
+	}
+	workers := s.cfg.Ble.TaskQueueWorkers
+	if workers == 0 {
+		workers = 1
+	}
 
 	s.tq.Stop(fmt.Errorf("Ensuring task is stopped"))
-	if err := s.tq.Start(10); err != nil {
+	s.tq.SetHooks(s.cfg.OnTaskStart, s.cfg.OnTaskEnd)
+	s.tq.SetWatchdog(s.cfg.TaskWatchdog, s.taskWedged)
+	if err := s.tq.StartWorkers(depth, workers); err != nil {
 		nmxutil.Assert(false)
 		return err
 	}
@@ -102,7 +369,11 @@ func (s *NakedSesn) init() error {
 }
 
 func NewNakedSesn(bx *BleXport, cfg sesn.SesnCfg) (*NakedSesn, error) {
-	mgmtChrs, err := BuildMgmtChrs(cfg.MgmtProto)
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	mgmtChrs, err := buildSesnChrs(cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -111,6 +382,16 @@ func NewNakedSesn(bx *BleXport, cfg sesn.SesnCfg) (*NakedSesn, error) {
 		cfg:      cfg,
 		bx:       bx,
 		mgmtChrs: mgmtChrs,
+		metrics:  cfg.MetricsSink,
+	}
+	if s.metrics == nil {
+		s.metrics = nmxutil.NopMetricsSink{}
+	}
+	if cfg.TxQuota != 0 {
+		s.quota = nmxutil.NewByteQuota(cfg.TxQuota)
+	}
+	if cfg.GoodputWindow != 0 {
+		s.goodput = nmxutil.NewGoodputMeter(cfg.GoodputWindow)
 	}
 
 	s.init()
@@ -118,8 +399,41 @@ func NewNakedSesn(bx *BleXport, cfg sesn.SesnCfg) (*NakedSesn, error) {
 	return s, nil
 }
 
-func (s *NakedSesn) runTask(fn func() error) error {
-	err := s.tq.Run(fn)
+func (s *NakedSesn) runTask(label string, fn func() error) error {
+	return s.runTaskPrio(task.PRIO_NORMAL, label, fn)
+}
+
+func (s *NakedSesn) runTaskPrio(prio task.Prio, label string,
+	fn func() error) error {
+
+	shared := func() error {
+		s.jobMtx.RLock()
+		defer s.jobMtx.RUnlock()
+
+		return fn()
+	}
+
+	return s.runTaskFn(prio, label, shared)
+}
+
+// Runs a job that must not run alongside any other session job.
+func (s *NakedSesn) runExclusive(label string, fn func() error) error {
+	return s.runTaskFn(task.PRIO_NORMAL, label, s.exclusive(fn))
+}
+
+func (s *NakedSesn) exclusive(fn func() error) func() error {
+	return func() error {
+		s.jobMtx.Lock()
+		defer s.jobMtx.Unlock()
+
+		return fn()
+	}
+}
+
+func (s *NakedSesn) runTaskFn(prio task.Prio, label string,
+	fn func() error) error {
+
+	err := s.tq.RunLabeled(prio, label, fn)
 	if err == task.InactiveError {
 		return nmxutil.NewXportError("attempt to use closed BLE session")
 	}
@@ -158,18 +472,36 @@ func (s *NakedSesn) shutdown(cause error) error {
 	s.conn.Stop()
 
 	if s.IsOpen() {
-		s.bx.RemoveSesn(s.conn.connHandle)
+		s.bx.RemoveSesn(s.regHandle)
+		s.regHandle = BLE_CONN_HANDLE_NONE
 	}
 
-	// Signal error to all listeners.
+	s.mtx.Lock()
+	paused := s.paused
+	s.mtx.Unlock()
+
+	// Signal error to all listeners.  A paused session keeps its
+	// transceiver for Resume().
 	s.txvr.ErrorAll(cause)
-	s.txvr.Stop()
+	if !paused {
+		s.txvr.Stop()
+	}
 
 	// Stop Goroutines associated with notification listeners.
+	s.cancelSubs(paused)
 	close(s.stopChan)
 
-	// Block until close completes.
-	s.wg.Wait()
+	// Block until close completes.  Goroutines that fail to terminate in
+	// time are abandoned so that teardown can proceed.
+	var warnErr error
+	if stuck := s.routines.Wait(s.cfg.Ble.ShutdownTimeout); stuck != nil {
+		log.Warnf("BLE session shutdown timed out; abandoning "+
+			"goroutines: %s", strings.Join(stuck, ", "))
+		warnErr = &ShutdownTimeoutError{
+			Timeout: s.cfg.Ble.ShutdownTimeout,
+			Stuck:   stuck,
+		}
+	}
 
 	// Call the on-close callback if the session was fully open.
 	s.mtx.Lock()
@@ -181,51 +513,196 @@ func (s *NakedSesn) shutdown(cause error) error {
 	}
 	s.mtx.Unlock()
 
-	if fullyOpen && s.cfg.OnCloseCb != nil {
-		s.cfg.OnCloseCb(s, cause)
+	if fullyOpen {
+		s.metrics.Count(METRIC_BLE_DISCONNECT, 1)
+
+		if s.cfg.OnCloseCb != nil && !nmxutil.IsSesnPaused(cause) {
+			s.callOnCloseCb(cause)
+		}
+
+		// Wake up anyone blocked in WaitClosed().
+		s.mtx.Lock()
+		s.closeCause = cause
+		close(s.closeChan)
+		s.closeChan = nil
+		s.mtx.Unlock()
 	}
 
-	return nil
+	return warnErr
+}
+
+// Executes the on-close callback.  A panic in the callback is logged and
+// suppressed so that it cannot interrupt the remainder of the shutdown
+// procedure.
+func (s *NakedSesn) callOnCloseCb(cause error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("BLE session on-close callback panicked: %v\n%s",
+				r, debug.Stack())
+		}
+	}()
+
+	s.cfg.OnCloseCb(s, cause)
 }
 
 func (s *NakedSesn) enqueueShutdown(cause error) chan error {
-	return s.tq.Enqueue(func() error { return s.shutdown(cause) })
+	return s.tq.EnqueueLabeled(task.PRIO_NORMAL, "shutdown",
+		s.exclusive(func() error { return s.shutdown(cause) }))
 }
 
-func (s *NakedSesn) initiateSecurity() error {
-	if err := s.conn.InitiateSecurity(); err != nil {
-		if serr := ToSecurityErr(err); serr != nil {
-			return serr
-		} else {
-			return err
+// Executed by the task queue watchdog.  The stuck job holds the queue (and
+// the job lock), so the session is torn down outside of both: the link is
+// broken directly and the shutdown procedure runs in its own Goroutine.
+func (s *NakedSesn) taskWedged(label string, elapsed time.Duration) {
+	if !s.cfg.TaskWatchdogAbort {
+		return
+	}
+
+	err := nmxutil.NewXportError(fmt.Sprintf(
+		"BLE session task \"%s\" exceeded watchdog threshold (%s)",
+		label, elapsed))
+
+	go func() {
+		s.txvr.ErrorAll(err)
+		s.conn.Abort(err)
+		s.shutdown(err)
+	}()
+}
+
+// Encrypts the connection if the configuration requires it.  Returns true if
+// the encryption procedure was performed.  With BLE_ENCRYPT_PREFER, a
+// rejected pairing is reported via SecurityDegradedCb and is not an error.
+func (s *NakedSesn) ensureSecurity() (bool, error) {
+	enc := s.cfg.Ble.EncryptWhen
+	if enc != BLE_ENCRYPT_ALWAYS && enc != BLE_ENCRYPT_PREFER {
+		return false, nil
+	}
+
+	if s.cfg.Ble.ForceInsecure {
+		log.Warnf("SECURITY DISABLED: SesnCfg.Ble.ForceInsecure is set; " +
+			"BLE connection is NOT encrypted (diagnostics only)")
+		return false, nil
+	}
+
+	tmo := s.cfg.Ble.SecurityTimeout
+	if tmo == 0 {
+		tmo = NAKED_SESN_SECURITY_TMO
+	}
+
+	err := s.conn.InitiateSecurity(tmo)
+	if err == nil {
+		return true, nil
+	}
+
+	if enc == BLE_ENCRYPT_PREFER && IsPairingRejected(err) {
+		log.Warnf("BLE pairing rejected by peer; connection is NOT "+
+			"encrypted (EncryptWhen=prefer): %s", err.Error())
+		if s.cfg.Ble.SecurityDegradedCb != nil {
+			s.cfg.Ble.SecurityDegradedCb(s, err)
 		}
+		return false, nil
+	}
+
+	if serr := ToSecurityErr(err); serr != nil {
+		return false, serr
 	}
+	return false, err
+}
+
+// Transitions the session to the opening state.  Fails if the session is
+// not closed.
+func (s *NakedSesn) beginOpen() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.state != NS_STATE_CLOSED {
+		return nmxutil.NewSesnAlreadyOpenError(
+			"Attempt to open an already-open BLE session")
+	}
+
+	s.state = NS_STATE_OPENING_ACTIVE
+	s.abortChan = make(chan struct{})
 	return nil
 }
 
-func (s *NakedSesn) Open() error {
-	initiate := func() error {
+// Completes an open procedure with the result of the final connect attempt.
+// `start` is the time the procedure began.
+func (s *NakedSesn) finishOpen(start time.Time, err error) error {
+	// Report the underlying failure rather than the retry wrapper.
+	if rerr, ok := err.(*ConnectRetryError); ok {
+		err = rerr.Err
+	}
+
+	if err != nil {
 		s.mtx.Lock()
-		defer s.mtx.Unlock()
+		s.state = NS_STATE_CLOSED
+		s.abortChan = nil
+		s.mtx.Unlock()
+		return err
+	}
 
-		if s.state != NS_STATE_CLOSED {
-			return nmxutil.NewSesnAlreadyOpenError(
-				"Attempt to open an already-open BLE session")
-		}
+	s.regHandle = s.conn.connHandle
+	s.bx.AddSesn(s.regHandle, s)
+	s.metrics.Count(METRIC_BLE_CONNECT, 1)
+	s.metrics.Timing(METRIC_BLE_CONNECT_TIME, time.Since(start))
 
-		s.state = NS_STATE_OPENING_ACTIVE
-		return nil
+	s.mtx.Lock()
+	s.state = NS_STATE_OPEN
+	s.abortChan = nil
+	s.closeChan = make(chan struct{})
+	close(s.openChan)
+	s.mtx.Unlock()
+
+	return nil
+}
+
+// Indicates whether AbortOpen() has been called during the current open
+// procedure.
+func (s *NakedSesn) openAborted() bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.abortChan == nil {
+		return false
 	}
 
-	if err := initiate(); err != nil {
+	select {
+	case <-s.abortChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// Fails the open procedure if AbortOpen() has been called.
+func (s *NakedSesn) checkAborted() error {
+	if s.openAborted() {
+		return openAbortedError()
+	}
+	return nil
+}
+
+// Records the completion of a connect phase and fails the attempt if
+// AbortOpen() was called in the meantime.
+func (s *NakedSesn) endPhase(phase ConnectPhase) error {
+	s.markPhase(phase)
+	return s.checkAborted()
+}
+
+func (s *NakedSesn) Open() error {
+	start := time.Now()
+	if err := s.beginOpen(); err != nil {
 		return err
 	}
 
+	policy := &s.cfg.Ble.Central.Retry
+	tries := policy.Attempts(s.cfg.Ble.Central.ConnTries)
+
 	var err error
-	for i := 0; i < s.cfg.Ble.Central.ConnTries; i++ {
+	for i := 0; i < tries; i++ {
 		var retry bool
 
-		retry, err = s.openOnce()
+		retry, err = s.openOnce(s.cfg.Ble.Central.ConnTimeout)
 		if err != nil {
 			s.shutdown(err)
 		}
@@ -233,27 +710,170 @@ func (s *NakedSesn) Open() error {
 		if !retry {
 			break
 		}
+
+		if s.openAborted() {
+			err = openAbortedError()
+			break
+		}
+
+		if i+1 >= tries {
+			break
+		}
+
+		s.metrics.Count(METRIC_BLE_CONNECT_RETRY, 1)
+		if s.cfg.Ble.Central.RetryCb != nil {
+			s.cfg.Ble.Central.RetryCb(i+1, err)
+		}
+
+		if delay := policy.Delay(i + 1); delay > 0 {
+			select {
+			case <-s.abortChan:
+			case <-time.After(delay):
+			}
+			if s.openAborted() {
+				err = openAbortedError()
+				break
+			}
+		}
 	}
 
-	if err != nil {
-		s.mtx.Lock()
-		s.state = NS_STATE_CLOSED
-		s.mtx.Unlock()
+	return s.finishOpen(start, err)
+}
+
+// OpenUntil repeatedly attempts to open the session until it succeeds or the
+// specified deadline passes.  Unlike Open(), the number of attempts is not
+// limited by ConnTries or the retry policy, and any failed attempt is
+// retried.  The policy's delays apply, with a minimum of OPEN_RETRY_DELAY.
+// Each attempt's connect timeout is limited to the time remaining.  The
+// procedure can be cancelled with AbortOpen().
+func (s *NakedSesn) OpenUntil(deadline time.Time) error {
+	start := time.Now()
+	if err := s.beginOpen(); err != nil {
 		return err
 	}
 
-	s.bx.AddSesn(s.conn.connHandle, s)
+	var err error
+	for attempt := 1; ; attempt++ {
+		tmo := deadline.Sub(time.Now())
+		if tmo <= 0 {
+			if err == nil {
+				err = nmxutil.NewXportError(
+					"BLE session open deadline expired")
+			}
+			break
+		}
+		if tmo > s.cfg.Ble.Central.ConnTimeout {
+			tmo = s.cfg.Ble.Central.ConnTimeout
+		}
+
+		_, err = s.openOnce(tmo)
+		if err == nil {
+			break
+		}
+		s.shutdown(err)
+
+		if s.openAborted() {
+			err = openAbortedError()
+			break
+		}
+
+		remaining := deadline.Sub(time.Now())
+		if remaining <= 0 {
+			break
+		}
+
+		log.Debugf("BLE session open attempt %d failed; retrying: %s",
+			attempt, err.Error())
+		s.metrics.Count(METRIC_BLE_CONNECT_RETRY, 1)
+		if s.cfg.Ble.Central.RetryCb != nil {
+			s.cfg.Ble.Central.RetryCb(attempt, err)
+		}
+
+		// Don't spin on failures that occur immediately.
+		delay := s.cfg.Ble.Central.Retry.Delay(attempt)
+		if delay < OPEN_RETRY_DELAY {
+			delay = OPEN_RETRY_DELAY
+		}
+		if remaining > delay {
+			remaining = delay
+		}
+		select {
+		case <-s.abortChan:
+		case <-time.After(remaining):
+		}
+		if s.openAborted() {
+			err = openAbortedError()
+			break
+		}
+	}
+
+	return s.finishOpen(start, err)
+}
 
+// AbortOpen cancels an in-progress Open() or OpenUntil().  The opening
+// Goroutine notices the request when the current connect step finishes (or
+// times out), tears the connection down, and makes no further attempts; the
+// open call returns an error.  AbortOpen itself only signals, so it never
+// touches session state another Goroutine is setting up.  This function has
+// no effect if the session is not being opened.
+func (s *NakedSesn) AbortOpen() {
 	s.mtx.Lock()
-	s.state = NS_STATE_OPEN
-	s.mtx.Unlock()
+	defer s.mtx.Unlock()
 
-	return nil
+	if s.abortChan == nil {
+		return
+	}
+	select {
+	case <-s.abortChan:
+	default:
+		close(s.abortChan)
+	}
+}
+
+func openAbortedError() error {
+	return nmxutil.NewSesnClosedError("BLE session open aborted")
 }
 
 func (s *NakedSesn) OpenConnected(
 	connHandle uint16, eventListener *Listener) error {
 
+	return s.openConnected(connHandle, eventListener, false, nil)
+}
+
+// OpenConnectedCtx is like OpenConnected(), but setting up the session is
+// bounded by the specified context.  The context is checked between setup
+// steps; a step already in progress runs to completion or to its own
+// timeout.  If setup fails, or the context is cancelled or expires first,
+// the session detaches from the connection without terminating it; the
+// connection remains available to its owner.  Once the session is open, the
+// context has no further effect, and closing the session terminates the
+// connection as usual.
+func (s *NakedSesn) OpenConnectedCtx(ctx context.Context,
+	connHandle uint16, eventListener *Listener) error {
+
+	return s.openConnected(connHandle, eventListener, true, ctx.Err)
+}
+
+// Adopts an existing connection.  If `detach` is set, a setup failure
+// releases the connection rather than terminating it.  `check`, if non-nil,
+// is executed between setup steps on the opening Goroutine; if it returns
+// an error, the open fails with that error.
+func (s *NakedSesn) openConnected(connHandle uint16,
+	eventListener *Listener, detach bool, check func() error) error {
+
+	if check == nil {
+		check = func() error { return nil }
+	}
+
+	// Aborts the setup if the check fails.
+	checkStep := func() error {
+		if err := check(); err != nil {
+			s.shutdown(err)
+			return err
+		}
+		return nil
+	}
+
 	initiate := func() error {
 		s.mtx.Lock()
 		defer s.mtx.Unlock()
@@ -270,20 +890,36 @@ func (s *NakedSesn) OpenConnected(
 	if err := initiate(); err != nil {
 		return err
 	}
+
+	opened := false
 	defer func() {
+		if opened {
+			return
+		}
+
 		s.mtx.Lock()
 		defer s.mtx.Unlock()
 
 		s.state = NS_STATE_CLOSED
 	}()
 
-	if err := s.init(); err != nil {
+	if err := check(); err != nil {
 		return err
 	}
 
+	if err := s.init(); err != nil {
+		return err
+	}
+	s.conn.setKeepLink(detach)
+
 	if err := s.conn.Inherit(connHandle, eventListener); err != nil {
 		return err
 	}
+	s.recordMtu(s.conn.AttMtu(), MTU_CHANGE_CONNECT)
+
+	if err := checkStep(); err != nil {
+		return err
+	}
 
 	// Listen for disconnect in the background.
 	s.disconnectListen()
@@ -294,34 +930,136 @@ func (s *NakedSesn) OpenConnected(
 	// Listen for authentication IO requests in the background.
 	s.smIoDemandListen()
 
-	if s.cfg.Ble.EncryptWhen == BLE_ENCRYPT_ALWAYS {
-		if err := s.initiateSecurity(); err != nil {
-			return err
-		}
+	s.keepalive()
+
+	if err := checkStep(); err != nil {
+		return err
+	}
+
+	if err := s.checkAttMtu(); err != nil {
+		s.shutdown(err)
+		return err
 	}
 
+	if err := checkStep(); err != nil {
+		return err
+	}
+
+	if _, err := s.ensureSecurity(); err != nil {
+		// Don't leave the peer connected with a half-established security
+		// state.  An adopted connection is released instead; its owner
+		// decides what to do with it.
+		s.shutdown(err)
+		return err
+	}
+
+	if err := checkStep(); err != nil {
+		return err
+	}
+
+	// The session now owns the connection.
+	s.conn.setKeepLink(false)
+
 	// Give a record of this open session to the transport.
+	s.regHandle = connHandle
 	s.bx.AddSesn(connHandle, s)
 
 	s.mtx.Lock()
 	s.state = NS_STATE_OPEN
+	s.closeChan = make(chan struct{})
+	close(s.openChan)
 	s.mtx.Unlock()
+	opened = true
+
+	return nil
+}
+
+// Verifies that the connection's ATT MTU is usable.  The default ATT MTU is
+// also the smallest the specification permits; anything less can't carry a
+// useful management payload.
+func (s *NakedSesn) checkAttMtu() error {
+	if mtu := s.conn.AttMtu(); mtu < BLE_ATT_MTU_DFLT {
+		return fmt.Errorf("Negotiated ATT MTU too small: %d; min=%d",
+			mtu, BLE_ATT_MTU_DFLT)
+	}
 
 	return nil
 }
 
 func (s *NakedSesn) failIfNotOpen() error {
 	if !s.IsOpen() {
+		if s.IsPaused() {
+			return nmxutil.NewSesnPausedError(
+				"Attempt to use paused session")
+		}
 		return nmxutil.NewSesnClosedError("Attempt to use closed session")
 	}
 	return nil
 }
 
+// Writes to a characteristic using the specified write type.  The default
+// write type defers to the session-wide WriteRsp setting.
+func (s *NakedSesn) writeChr(chr *Characteristic, b []byte, name string,
+	wt BleWriteType) error {
+
+	rsp := s.cfg.Ble.WriteRsp
+	switch wt {
+	case BLE_WRITE_TYPE_RSP:
+		rsp = true
+	case BLE_WRITE_TYPE_NO_RSP:
+		rsp = false
+	}
+
+	if limit := s.MtuOut(); len(b) > limit {
+		return nmxutil.NewMtuExceededError(len(b), limit)
+	}
+
+	// Charge the ATT header along with the value.
+	if err := s.quota.Consume(BLE_ATT_WRITE_HDR_SZ + len(b)); err != nil {
+		return err
+	}
+	if s.quota != nil {
+		s.metrics.Gauge(METRIC_BLE_TX_QUOTA_USED, float64(s.quota.Used()))
+	}
+
+	drop, err := s.cfg.FaultInjector.BeforeWrite()
+	if err != nil {
+		return err
+	}
+	if drop {
+		log.Debugf("Fault injector dropped %s write", name)
+		return nil
+	}
+
+	if rsp {
+		err = s.conn.WriteChr(chr, b, name)
+	} else {
+		err = s.conn.WriteChrNoRsp(chr, b, name)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.metrics.Count(METRIC_BLE_TX_BYTES, int64(len(b)))
+	return nil
+}
+
 func (s *NakedSesn) TxRxMgmt(m *nmp.NmpMsg,
 	timeout time.Duration) (nmp.NmpRsp, error) {
 
+	rsp, _, err := s.TxRxMgmtEx(m, timeout)
+	return rsp, err
+}
+
+// Like TxRxMgmt(), but also reports the number of ATT writes the request
+// produced and the number of bytes they carried.
+func (s *NakedSesn) TxRxMgmtEx(m *nmp.NmpMsg,
+	timeout time.Duration) (nmp.NmpRsp, sesn.TxStats, error) {
+
+	var stats sesn.TxStats
+
 	if err := s.failIfNotOpen(); err != nil {
-		return nil, err
+		return nil, stats, err
 	}
 
 	var rsp nmp.NmpRsp
@@ -333,18 +1071,72 @@ func (s *NakedSesn) TxRxMgmt(m *nmp.NmpMsg,
 		}
 
 		txRaw := func(b []byte) error {
-			if s.cfg.Ble.WriteRsp {
-				return s.conn.WriteChr(chr, b, "nmp")
-			} else {
-				return s.conn.WriteChrNoRsp(chr, b, "nmp")
-			}
+			return s.writeChr(chr, b, "nmp", s.cfg.Ble.MgmtWriteType)
+		}
+
+		rsp, stats, err = s.txvr.TxRxMgmtEx(txRaw, m, s.MtuOut(), timeout)
+		return err
+	}
+
+	start := time.Now()
+	label := fmt.Sprintf("nmp %d:%d", m.Hdr.Group, m.Hdr.Id)
+	if err := s.runTaskPrio(s.cfg.GroupPrios[m.Hdr.Group], label,
+		fn); err != nil {
+
+		s.metrics.Count(METRIC_BLE_MGMT_ERROR, 1)
+		return nil, stats, err
+	}
+	s.metrics.Timing(METRIC_BLE_MGMT_LATENCY, time.Since(start))
+
+	if s.goodput != nil {
+		s.goodput.Record(int(m.Hdr.Len) + int(rsp.Hdr().Len))
+		s.metrics.Gauge(METRIC_BLE_GOODPUT, s.goodput.Rate())
+	}
+
+	return rsp, stats, nil
+}
+
+// Sends a pre-encoded NMP request frame and returns the raw response packet.
+// The frame bypasses CBOR encoding entirely, which is useful for replaying
+// captured traffic.  The response is matched to the request by the sequence
+// number in the frame's header.  Only a single attempt is made.
+func (s *NakedSesn) TxRawNmp(frame []byte,
+	opt sesn.TxOptions) ([]byte, error) {
+
+	if err := s.failIfNotOpen(); err != nil {
+		return nil, err
+	}
+
+	hdr, err := nmp.DecodeNmpHdr(frame)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout, err := opt.AttemptTimeout()
+	if err != nil {
+		return nil, err
+	}
+
+	var rsp []byte
+
+	fn := func() error {
+		chr, err := s.getChr(s.mgmtChrs.NmpReqChr)
+		if err != nil {
+			return err
+		}
+
+		txRaw := func(b []byte) error {
+			return s.writeChr(chr, b, "nmp", s.cfg.Ble.MgmtWriteType)
 		}
 
-		rsp, err = s.txvr.TxRxMgmt(txRaw, m, s.MtuOut(), timeout)
+		rsp, err = s.txvr.TxRxRawNmp(txRaw, frame, s.MtuOut(), timeout)
 		return err
 	}
 
-	if err := s.runTask(fn); err != nil {
+	label := fmt.Sprintf("raw-nmp %d:%d", hdr.Group, hdr.Id)
+	if err := s.runTaskPrio(s.cfg.GroupPrios[hdr.Group], label,
+		fn); err != nil {
+
 		return nil, err
 	}
 
@@ -373,17 +1165,13 @@ func (s *NakedSesn) TxCoap(m coap.Message) error {
 		}
 
 		txRaw := func(b []byte) error {
-			if s.cfg.Ble.WriteRsp {
-				return s.conn.WriteChr(chr, b, "coap")
-			} else {
-				return s.conn.WriteChrNoRsp(chr, b, "coap")
-			}
+			return s.writeChr(chr, b, "coap", s.cfg.Ble.CoapWriteType)
 		}
 
 		return s.txvr.TxCoap(txRaw, m, s.MtuOut())
 	}
 
-	return s.runTask(fn)
+	return s.runTask("coap", fn)
 }
 
 func (s *NakedSesn) AbortRx(seq uint8) error {
@@ -391,23 +1179,326 @@ func (s *NakedSesn) AbortRx(seq uint8) error {
 		return err
 	}
 
-	fn := func() error {
-		s.txvr.AbortRx(seq)
-		return nil
+	// The transceiver is thread safe.  Don't go through the task queue; the
+	// request being aborted occupies it until it completes.
+	s.txvr.AbortRx(seq)
+	return nil
+}
+
+// Retrieves the requests that are awaiting a response on this session.
+func (s *NakedSesn) PendingRequests() []mgmt.RequestInfo {
+	return s.txvr.PendingRequests()
+}
+
+// Aborts the outstanding NMP request with the specified sequence number.
+// Unlike closing the session, this does not affect other requests.
+func (s *NakedSesn) CancelRequest(seq uint8) error {
+	if err := s.failIfNotOpen(); err != nil {
+		return err
+	}
+
+	return s.txvr.CancelRequest(seq)
+}
+
+// Retrieves the CoAP observe relationships this session has registered.
+// A relationship whose notifications have stopped arriving can be revived
+// with RefreshObservation().
+func (s *NakedSesn) Observations() []mgmt.ObserveInfo {
+	return s.txvr.Observations()
+}
+
+// Re-sends the registration for the observe relationship with the specified
+// token.  The peer replaces its existing registration, if any, and resumes
+// notifying.
+func (s *NakedSesn) RefreshObservation(token []byte) error {
+	if err := s.failIfNotOpen(); err != nil {
+		return err
+	}
+
+	m, err := s.txvr.ObserveRefreshReq(token)
+	if err != nil {
+		return err
 	}
-	return s.runTask(fn)
+
+	return s.TxCoap(m)
 }
 
 func (s *NakedSesn) Close() error {
+	if s.IsPaused() && !s.IsOpen() {
+		s.unpause(true)
+		return nil
+	}
+
 	if err := s.failIfNotOpen(); err != nil {
 		return err
 	}
 
 	fn := func() error {
+		// Make sure trailing write commands reach the peer before the link
+		// is dropped.
+		if s.conn.IsConnected() && s.conn.Unflushed() {
+			if err := s.conn.Flush(); err != nil {
+				log.Debugf("error flushing writes during close: %s",
+					err.Error())
+			}
+		}
+
+		// Tell the peer to stop sending notifications before disconnecting.
+		// This is only possible if the link is still up.
+		if s.cfg.Ble.UnsubscribeOnClose && s.conn.IsConnected() {
+			if err := s.conn.UnsubscribeAll(); err != nil {
+				log.Debugf("error unsubscribing during close: %s",
+					err.Error())
+			}
+		}
+
 		return s.shutdown(fmt.Errorf("BLE session manually closed"))
 	}
 
-	return s.runTask(fn)
+	return s.runExclusive("close", fn)
+}
+
+// Disconnects from the peer without discarding session state.  Requests in
+// progress fail with a SesnPausedError, which callers may treat as
+// retryable.  Subscriptions created with SubscribeChr() and CoAP observe
+// relationships are retained and restored by Resume().  The on-close
+// callback is not executed.  A paused session can be discarded with Close().
+func (s *NakedSesn) Pause() error {
+	if err := s.failIfNotOpen(); err != nil {
+		return err
+	}
+
+	s.mtx.Lock()
+	s.paused = true
+	s.mtx.Unlock()
+
+	fn := func() error {
+		if s.conn.IsConnected() && s.conn.Unflushed() {
+			if err := s.conn.Flush(); err != nil {
+				log.Debugf("error flushing writes during pause: %s",
+					err.Error())
+			}
+		}
+
+		return s.shutdown(nmxutil.NewSesnPausedError("BLE session paused"))
+	}
+
+	if err := s.runExclusive("pause", fn); err != nil && !nmxutil.IsSesnPaused(err) {
+		s.unpause(true)
+		return err
+	}
+
+	return nil
+}
+
+// Reconnects a paused session.  Once the session is open, retained
+// subscriptions are re-enabled on the peer and observe relationships are
+// re-registered.  A subscription or observation that cannot be restored is
+// dropped; the first such error is returned, but the session remains open.
+// If the session cannot be reopened, it remains paused and Resume() may be
+// retried.
+func (s *NakedSesn) Resume() error {
+	if !s.IsPaused() {
+		return nmxutil.NewSesnClosedError(
+			"Attempt to resume a session that is not paused")
+	}
+
+	if err := s.Open(); err != nil {
+		return err
+	}
+
+	s.unpause(false)
+
+	err := s.restoreSubs()
+	for _, oi := range s.txvr.Observations() {
+		if rerr := s.RefreshObservation(oi.Token); rerr != nil {
+			log.Debugf("error restoring observation of %s: %s",
+				oi.Path, rerr.Error())
+			if err == nil {
+				err = rerr
+			}
+		}
+	}
+
+	return err
+}
+
+// Clears the paused state.  If `discard` is set, the state retained for
+// Resume() is released.
+func (s *NakedSesn) unpause(discard bool) {
+	s.mtx.Lock()
+	s.paused = false
+	s.mtx.Unlock()
+
+	if discard {
+		s.cancelSubs(false)
+		s.txvr.Stop()
+	}
+}
+
+// Indicates whether the session has been paused and not yet resumed.
+func (s *NakedSesn) IsPaused() bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.paused
+}
+
+// Retrieves the number of bytes charged against the transmit quota since it
+// was last reset.  Always 0 if the session has no quota.
+func (s *NakedSesn) QuotaUsed() int64 {
+	return s.quota.Used()
+}
+
+// Retrieves the session's goodput: NMP payload bytes per second moved by
+// successful requests, averaged over SesnCfg.GoodputWindow.  Always 0 if
+// the measurement is disabled.
+func (s *NakedSesn) Goodput() float64 {
+	return s.goodput.Rate()
+}
+
+// Allows transmission to resume after the transmit quota is used up.
+func (s *NakedSesn) ResetQuota() {
+	s.quota.Reset()
+	if s.quota != nil {
+		s.metrics.Gauge(METRIC_BLE_TX_QUOTA_USED, 0)
+	}
+}
+
+// Blocks until all writes issued so far, including write commands (write
+// without response), have been delivered to the peer.  Close() does this
+// automatically.
+func (s *NakedSesn) Flush() error {
+	if err := s.failIfNotOpen(); err != nil {
+		return err
+	}
+
+	return s.conn.Flush()
+}
+
+// Blocks until the session has fully shut down: background goroutines have
+// exited and the on-close callback has returned.  Returns the cause of the
+// most recent close.  If the session is not open, this function returns
+// immediately.
+func (s *NakedSesn) WaitClosed() error {
+	s.mtx.Lock()
+	ch := s.closeChan
+	if s.state != NS_STATE_OPEN && !s.shuttingDown {
+		ch = nil
+	}
+	s.mtx.Unlock()
+
+	if ch != nil {
+		<-ch
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.closeCause
+}
+
+// Blocks until a notification or indication matching the predicate arrives
+// from the specified characteristic, and returns its payload.  A nil
+// predicate matches anything.  The peer must already be sending
+// notifications; this function doesn't write the characteristic's CCCD.
+// Notifications continue to reach any existing subscriber while this call
+// observes them.
+func (s *NakedSesn) WaitForNotification(chrId BleChrId,
+	match func(data []byte) bool, timeout time.Duration) ([]byte, error) {
+
+	if err := s.failIfNotOpen(); err != nil {
+		return nil, err
+	}
+
+	chr, err := s.getChr(&chrId)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mtx.Lock()
+	closeChan := s.closeChan
+	s.mtx.Unlock()
+
+	ch := s.conn.addNotifyTap(chr)
+	defer s.conn.removeNotifyTap(chr, ch)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case b := <-ch:
+			if match == nil || match(b) {
+				return b, nil
+			}
+
+		case <-timer.C:
+			return nil, nmxutil.NewRspTimeoutError(fmt.Sprintf(
+				"Timeout waiting for notification from %s",
+				chrId.String()))
+
+		case <-closeChan:
+			return nil, nmxutil.NewSesnClosedError(
+				"BLE session closed while waiting for notification")
+		}
+	}
+}
+
+// Adds an entry to the MTU history, discarding the oldest entry if the
+// history is full.
+func (s *NakedSesn) recordMtu(mtu uint16, cause MtuChangeCause) {
+	s.metrics.Gauge(METRIC_BLE_ATT_MTU, float64(mtu))
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if len(s.mtuHistory) >= MTU_HISTORY_SIZE {
+		s.mtuHistory = s.mtuHistory[1:]
+	}
+	s.mtuHistory = append(s.mtuHistory, MtuChange{
+		Time:  time.Now(),
+		Mtu:   mtu,
+		Cause: cause,
+	})
+}
+
+// Records the completion of a connection phase if timing is enabled.
+func (s *NakedSesn) markPhase(p ConnectPhase) {
+	if !s.cfg.Ble.EnableTiming {
+		return
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if p == CONNECT_PHASE_START {
+		s.timeline = nil
+	}
+	s.timeline = append(s.timeline, ConnectPhaseTime{
+		Phase: p,
+		Time:  time.Now(),
+	})
+}
+
+// Retrieves the phase completion times of the most recent connect attempt.
+// A phase that was skipped or never completed has no entry.  Empty unless the
+// session's EnableTiming setting is enabled.
+func (s *NakedSesn) ConnectTimeline() []ConnectPhaseTime {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return append([]ConnectPhaseTime(nil), s.timeline...)
+}
+
+// Retrieves the session's most recent ATT MTU changes, oldest first.  The
+// history is retained across reconnects and holds at most MTU_HISTORY_SIZE
+// entries.
+func (s *NakedSesn) MtuHistory() []MtuChange {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return append([]MtuChange(nil), s.mtuHistory...)
 }
 
 func (s *NakedSesn) IsOpen() bool {
@@ -418,17 +1509,32 @@ func (s *NakedSesn) IsOpen() bool {
 }
 
 func (s *NakedSesn) MtuIn() int {
-	return int(s.conn.AttMtu()) - NOTIFY_CMD_BASE_SZ
+	// Never report a size that can't carry any data, even if the host
+	// reports a nonsensical MTU.  Callers fragment by this value.
+	return util.IntMax(int(s.conn.AttMtu())-NOTIFY_CMD_BASE_SZ, 1)
 }
 
 func (s *NakedSesn) MtuOut() int {
-	return util.IntMin(s.MtuIn(), BLE_ATT_ATTR_MAX_LEN)
+	maxLen := BLE_ATT_ATTR_MAX_LEN
+	if s.cfg.Ble.MaxWriteLen != 0 {
+		maxLen = s.cfg.Ble.MaxWriteLen
+	}
+
+	return util.IntMin(s.MtuIn(), maxLen)
 }
 
 func (s *NakedSesn) CoapIsTcp() bool {
 	return true
 }
 
+func (s *NakedSesn) Capabilities() sesn.SesnCaps {
+	return sesn.SesnCaps{
+		Observe:    true,
+		Reconnect:  true,
+		MaxPayload: s.MtuOut(),
+	}
+}
+
 func (s *NakedSesn) MgmtProto() sesn.MgmtProto {
 	return s.cfg.MgmtProto
 }
@@ -438,14 +1544,88 @@ func (s *NakedSesn) ConnInfo() (BleConnDesc, error) {
 		return BleConnDesc{}, err
 	}
 
-	return s.conn.ConnInfo(), nil
+	desc := s.conn.ConnInfo()
+
+	s.mtx.Lock()
+	desc.MatchedAdv = s.matchedAdv
+	s.mtx.Unlock()
+
+	if desc.MatchedAdv != nil && s.cfg.PeerSpec.BleAdv != nil {
+		desc.MatchedCriteria = s.cfg.PeerSpec.BleAdv.String()
+	}
+
+	return desc, nil
+}
+
+func (s *NakedSesn) setMatchedAdv(adv *BleAdvReport) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.matchedAdv = adv
+}
+
+// Builds the predicate used to select the peer by scanning, or nil if the
+// peer is specified by address only.
+func (s *NakedSesn) peerPredicate() BleAdvPredicate {
+	match := s.cfg.PeerSpec.BleMatch
+	crit := s.cfg.PeerSpec.BleAdv
+
+	switch {
+	case crit == nil:
+		return match
+	case match == nil:
+		return crit.Predicate()
+	default:
+		return func(r BleAdvReport) bool {
+			return match(r) && crit.Match(r)
+		}
+	}
+}
+
+// Retrieves a copy of the GATT profile that was discovered when the session
+// was opened.  This is useful for diagnosing missing characteristics.
+func (s *NakedSesn) Profile() (*Profile, error) {
+	if err := s.failIfNotOpen(); err != nil {
+		return nil, err
+	}
+
+	p := s.conn.Profile().Copy()
+	return &p, nil
+}
+
+// Retrieves the properties the peer reports for the specified
+// characteristic (e.g., whether it supports notifications or indications).
+func (s *NakedSesn) ChrProperties(chrId BleChrId) (
+	BleDiscChrProperties, error) {
+
+	if err := s.failIfNotOpen(); err != nil {
+		return 0, err
+	}
+
+	chr := s.conn.Profile().FindChrByUuid(chrId)
+	if chr == nil {
+		return 0, fmt.Errorf("BLE peer doesn't support characteristic %s",
+			chrId.String())
+	}
+
+	return chr.Properties, nil
+}
+
+// Lists the management targets the peer exposes.  Any of these can be
+// selected for a subsequent session via SesnCfg.Ble.MgmtTarget.
+func (s *NakedSesn) MgmtTargets() ([]BleUuid, error) {
+	if err := s.failIfNotOpen(); err != nil {
+		return nil, err
+	}
+
+	return MgmtTargets(s.conn.Profile(), s.cfg.MgmtProto)
 }
 
 func (s *NakedSesn) SetOobKey(key []byte) {
 	s.smIo.Oob = key
 }
 
-func (s *NakedSesn) openOnce() (bool, error) {
+func (s *NakedSesn) openOnce(connTimeout time.Duration) (bool, error) {
 	s.mtx.Lock()
 	s.state = NS_STATE_OPENING_ACTIVE
 	s.mtx.Unlock()
@@ -453,57 +1633,215 @@ func (s *NakedSesn) openOnce() (bool, error) {
 	if err := s.init(); err != nil {
 		return false, err
 	}
+	if err := s.endPhase(CONNECT_PHASE_START); err != nil {
+		return false, err
+	}
 
 	// Listen for disconnect in the background.
 	s.disconnectListen()
 
+	peer := s.cfg.PeerSpec.Ble
+	s.setMatchedAdv(nil)
+	if pred := s.peerPredicate(); pred != nil {
+		var adv BleAdvReport
+		match := func(r BleAdvReport) bool {
+			if !pred(r) {
+				return false
+			}
+			adv = r
+			return true
+		}
+
+		dev, err := DiscoverDevice(s.bx, s.cfg.Ble.OwnAddrType,
+			connTimeout, match)
+		if err != nil {
+			return false, err
+		}
+		if dev == nil {
+			return false, nmxutil.NewScanTmoError(
+				"Failed to find matching BLE peer")
+		}
+
+		// The connection descriptor reports the address that matched.
+		log.Debugf("Matched BLE peer: %s", dev.String())
+		peer = *dev
+		s.setMatchedAdv(&adv)
+		if err := s.endPhase(CONNECT_PHASE_SCAN); err != nil {
+			return false, err
+		}
+	}
+
 	if err := s.conn.Connect(
 		s.cfg.Ble.OwnAddrType,
-		s.cfg.PeerSpec.Ble,
-		s.cfg.Ble.Central.ConnTimeout); err != nil {
+		peer,
+		connTimeout,
+		s.cfg.Ble.Central.SupervisionTimeout); err != nil {
 
 		// An ENOTCONN error code implies the "conn_find" request failed
 		// because the connection dropped immediately after being established.
 		// If this happened, retry the connect procedure.
 		bhdErr := nmxutil.ToBleHost(err)
-		retry := bhdErr != nil && bhdErr.Status == ERR_CODE_ENOTCONN
-		return retry, err
+		if bhdErr != nil && bhdErr.Status == ERR_CODE_ENOTCONN {
+			return true, &ConnectRetryError{CONNECT_PHASE_CONNECT, err}
+		}
+		return false, err
+	}
+	s.recordMtu(s.conn.AttMtu(), MTU_CHANGE_CONNECT)
+	if err := s.endPhase(CONNECT_PHASE_CONNECT); err != nil {
+		return false, err
 	}
 
-	if err := s.conn.ExchangeMtu(); err != nil {
+	tmo := s.cfg.Ble.MtuExchangeTimeout
+	if tmo == 0 {
+		tmo = NAKED_SESN_MTU_EXCHANGE_TMO
+	}
+
+	err := s.conn.ExchangeMtu(tmo)
+	if err != nil {
 		// An ENOTCONN error code implies the connection dropped before the
 		// first ACL data transmission.  If this happened, retry the connect
 		// procedure.
 		bhdErr := nmxutil.ToBleHost(err)
-		retry := bhdErr != nil && bhdErr.Status == ERR_CODE_ENOTCONN
-		return retry, err
+		if bhdErr != nil && bhdErr.Status == ERR_CODE_ENOTCONN {
+			return true, &ConnectRetryError{CONNECT_PHASE_MTU, err}
+		}
+		return false, err
 	}
 
-	if err := s.conn.DiscoverSvcs(); err != nil {
+	if err := s.checkAttMtu(); err != nil {
+		return false, err
+	}
+	if err := s.endPhase(CONNECT_PHASE_MTU); err != nil {
 		return false, err
 	}
 
-	if chr, _ := s.getChr(s.mgmtChrs.NmpRspChr); chr != nil {
-		if chr.SubscribeType() != 0 {
-			if err := s.conn.Subscribe(chr); err != nil {
-				return false, err
-			}
-		}
+	if err := s.conn.DiscoverSvcs(); err != nil {
+		return false, err
+	}
+	if err := s.endPhase(CONNECT_PHASE_DISCOVER); err != nil {
+		return false, err
 	}
 
-	// Listen for incoming notifications in the background.
+	// Listen for incoming notifications before subscribing.  Some peers
+	// send a notification as soon as the subscription is in place.
 	s.notifyListen()
 
+	if s.cfg.Ble.RediscoverOnSvcChg {
+		s.svcChgListen()
+	}
+
+	if err := s.subscribeRsp(); err != nil {
+		return false, err
+	}
+	if err := s.endPhase(CONNECT_PHASE_SUBSCRIBE); err != nil {
+		return false, err
+	}
+
 	// Listen for authentication IO requests in the background.
 	s.smIoDemandListen()
 
-	if s.cfg.Ble.EncryptWhen == BLE_ENCRYPT_ALWAYS {
-		if err := s.initiateSecurity(); err != nil {
-			return false, err
+	s.keepalive()
+
+	secured, err := s.ensureSecurity()
+	if err != nil {
+		return false, err
+	}
+	if secured {
+		s.markPhase(CONNECT_PHASE_SECURE)
+	}
+
+	return false, s.checkAborted()
+}
+
+// Subscribes to the NMP response characteristic and, if configured, the
+// service changed characteristic.  The subscriptions are pipelined.  Failure
+// to subscribe to the service changed characteristic is not fatal.
+func (s *NakedSesn) subscribeRsp() error {
+	var chrs []*Characteristic
+
+	rspChr, _ := s.getChr(s.mgmtChrs.NmpRspChr)
+	if rspChr != nil && rspChr.SubscribeType() != 0 {
+		chrs = append(chrs, rspChr)
+	}
+
+	var svcChgChr *Characteristic
+	if s.cfg.Ble.RediscoverOnSvcChg {
+		chr := s.conn.Profile().FindChrByUuid(*svcChgChrId)
+		if chr != nil && chr.SubscribeType() != 0 {
+			svcChgChr = chr
+			chrs = append(chrs, chr)
 		}
 	}
 
-	return false, nil
+	if len(chrs) == 0 {
+		return nil
+	}
+
+	errs := s.conn.SubscribeMulti(chrs)
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+
+		if chrs[i] == svcChgChr {
+			log.Debugf("error subscribing to service changed "+
+				"characteristic: %s", err.Error())
+		} else {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Re-runs GATT service discovery on an open session and resubscribes to the
+// NMP response characteristic and to the characteristics of subscriptions
+// created with SubscribeChr().  This is necessary if the peer's GATT table
+// changes while the session is open.
+func (s *NakedSesn) Rediscover() error {
+	if err := s.failIfNotOpen(); err != nil {
+		return err
+	}
+
+	fn := func() error {
+		if err := s.conn.Rediscover(); err != nil {
+			return err
+		}
+
+		if err := s.subscribeRsp(); err != nil {
+			return err
+		}
+
+		return s.resubscribeSubs()
+	}
+
+	return s.runExclusive("rediscover", fn)
+}
+
+var svcChgChrId = &BleChrId{
+	SvcUuid: BleUuid{U16: GattSvcUuid},
+	ChrUuid: BleUuid{U16: SvcChgChrUuid},
+}
+
+// Rediscovers the peer's services whenever a service changed indication is
+// received.  The subscription itself is performed by subscribeRsp().
+func (s *NakedSesn) svcChgListen() {
+	if s.conn.Profile().FindChrByUuid(*svcChgChrId) == nil {
+		return
+	}
+
+	routines := s.routines
+	s.notifyListenOnce(svcChgChrId, false, func(b []byte) {
+		// Rediscover in a separate Goroutine; the notification listener
+		// must not block while the profile is being replaced.  Shutdown
+		// waits for the Goroutine along with the connection's others.
+		routines.Go("rediscover", func() {
+			log.Debugf("GATT service changed; rediscovering")
+			if err := s.Rediscover(); err != nil {
+				log.Debugf("error rediscovering services: %s", err.Error())
+			}
+		})
+	})
 }
 
 func (s *NakedSesn) smRespondIo(dmnd SmIoDemand) error {
@@ -536,23 +1874,64 @@ func (s *NakedSesn) disconnectListen() {
 
 	// Terminates on:
 	// * Receive from connection disconnect-channel.
-	s.wg.Add(1)
-	go func() {
-		defer s.wg.Done()
-
+	s.routines.Go("disconnect-listener", func() {
 		// Block until disconnect.
 		err := <-discChan
 		s.enqueueShutdown(err)
-	}()
+	})
 }
 
-func (s *NakedSesn) smIoDemandListen() {
+// Calculates the delay before the next keepalive.  The configured interval
+// is randomized by up to +/- KeepaliveJitter of its value, so that the
+// keepalives of many sessions started together do not stay aligned.
+func (s *NakedSesn) keepaliveDelay() time.Duration {
+	d := s.cfg.Ble.KeepaliveItvl
+	if j := s.cfg.Ble.KeepaliveJitter; j != 0 {
+		d += time.Duration(float64(d) * j * (2*rand.Float64() - 1))
+	}
+	return d
+}
+
+// Periodically sends an echo request while the session is open.  Failures
+// are only logged; a lost link is detected by the disconnect listener.
+func (s *NakedSesn) keepalive() {
+	if s.cfg.Ble.KeepaliveItvl == 0 {
+		return
+	}
+
+	stopChan := s.stopChan
+	openChan := s.openChan
+
 	// Terminates on:
 	// * Receive from stop channel.
-	s.wg.Add(1)
-	go func() {
-		defer s.wg.Done()
+	s.routines.Go("keepalive", func() {
+		select {
+		case <-openChan:
+		case <-stopChan:
+			return
+		}
 
+		for {
+			select {
+			case <-time.After(s.keepaliveDelay()):
+			case <-stopChan:
+				return
+			}
+
+			r := nmp.NewEchoReq()
+			if _, err := s.TxRxMgmt(r.Msg(),
+				s.cfg.Ble.KeepaliveItvl); err != nil {
+
+				log.Debugf("BLE keepalive failed: %s", err.Error())
+			}
+		}
+	})
+}
+
+func (s *NakedSesn) smIoDemandListen() {
+	// Terminates on:
+	// * Receive from stop channel.
+	s.routines.Go("sm-io-listener", func() {
 		for {
 			select {
 			case dmnd, ok := <-s.conn.SmIoDemandChan():
@@ -566,7 +1945,7 @@ func (s *NakedSesn) smIoDemandListen() {
 				return
 			}
 		}
-	}()
+	})
 }
 
 func (s *NakedSesn) getChr(chrId *BleChrId) (*Characteristic, error) {
@@ -575,10 +1954,27 @@ func (s *NakedSesn) getChr(chrId *BleChrId) (*Characteristic, error) {
 			"characteristic")
 	}
 
-	chr := s.conn.Profile().FindChrByUuid(*chrId)
+	p := s.conn.Profile()
+	chr := p.FindChrByUuid(*chrId)
+	if props, ok := s.cfg.Ble.ChrProps[*chrId]; ok {
+		chr = nil
+		for _, c := range p.FindChrsById(*chrId) {
+			if c.Properties&props == props {
+				chr = c
+				break
+			}
+		}
+		if chr == nil {
+			return nil, fmt.Errorf("BLE peer doesn't support required "+
+				"characteristic: %s with properties 0x%02x", chrId.String(),
+				int(props))
+		}
+	}
 	if chr == nil {
+		log.Debugf("Discovered GATT profile:\n%s", p.String())
 		return nil, fmt.Errorf("BLE peer doesn't support required "+
-			"characteristic: %s", chrId.String())
+			"characteristic: %s (%d services discovered)",
+			chrId.String(), len(p.Services()))
 	}
 
 	return chr, nil
@@ -595,23 +1991,45 @@ func (s *NakedSesn) createNotifyListener(chrId *BleChrId) (
 	return s.conn.ListenForNotifications(chr)
 }
 
-func (s *NakedSesn) notifyListenOnce(chrId *BleChrId,
-	dispatchCb func(b []byte)) {
+func (s *NakedSesn) notifyListenOnce(chrId *BleChrId, cccd bool,
+	dispatchCb func(b []byte)) (*Subscription, error) {
+
+	sub := newSubscription(s, []*BleChrId{chrId}, cccd, dispatchCb)
+	if err := s.attachSub(sub); err != nil {
+		return nil, err
+	}
+	s.addSub(sub)
+
+	return sub, nil
+}
+
+// Listens for notifications on the subscription's characteristic over the
+// current connection and starts the Goroutines that deliver them.
+func (s *NakedSesn) attachSub(sub *Subscription) error {
+	chrId := sub.chrIds[0]
+	dispatchCb := sub.dispatchCb
 
 	nl, err := s.createNotifyListener(chrId)
 	if err != nil {
 		log.Debugf("error listening for notifications: %s", err.Error())
-		return
+		return err
 	}
 
-	stopChan := s.stopChan
+	stopChan := sub.attach([]*NotifyListener{nl})
+	openChan := s.openChan
+
+	// Notifications are received and dispatched by separate Goroutines.  The
+	// connection delivers notifications for all characteristics from a
+	// single Goroutine, so a slow dispatch callback (e.g., NMP reassembly)
+	// would otherwise delay notifications on other characteristics.
+	// Dispatch remains ordered within a characteristic.
+	dispatchChan := make(chan []byte, NOTIFY_DISPATCH_QUEUE_DEPTH)
 
 	// Terminates on:
 	// * Notify listener error.
 	// * Receive from stop channel.
-	s.wg.Add(1)
-	go func() {
-		defer s.wg.Done()
+	s.routines.Go("notify-rx "+chrId.String(), func() {
+		defer close(dispatchChan)
 
 		for {
 			select {
@@ -620,19 +2038,178 @@ func (s *NakedSesn) notifyListenOnce(chrId *BleChrId,
 
 			case n, ok := <-nl.NotifyChan:
 				if ok {
-					dispatchCb(n.Data)
+					select {
+					case dispatchChan <- n.Data:
+					case <-stopChan:
+						return
+					}
 				}
 
 			case <-stopChan:
 				return
 			}
 		}
-	}()
+	})
+
+	// Terminates on:
+	// * Receiver Goroutine terminates.
+	// * Receive from stop channel.
+	s.routines.Go("notify-dispatch "+chrId.String(), func() {
+		// Hold notifications that arrive while the session is still
+		// opening.  They remain queued in the dispatch channel.
+		select {
+		case <-openChan:
+		case <-stopChan:
+			return
+		}
+
+		for {
+			select {
+			case b, ok := <-dispatchChan:
+				if !ok || stopped(stopChan) {
+					return
+				}
+				if s.cfg.FaultInjector.DropRx() {
+					continue
+				}
+				s.metrics.Count(METRIC_BLE_RX_BYTES, int64(len(b)))
+				dispatchCb(b)
+
+			case <-stopChan:
+				return
+			}
+		}
+	})
+
+	return nil
+}
+
+// Indicates whether the specified stop channel has been closed.  A dispatcher
+// checks this before each callback so that notifications still queued when a
+// subscription is cancelled are discarded rather than delivered.
+func stopped(stopChan chan struct{}) bool {
+	select {
+	case <-stopChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// A received notification awaiting ordered dispatch.
+type orderedNotify struct {
+	data       []byte
+	dispatchCb func(b []byte)
+}
+
+// Receives notifications for both management response characteristics in a
+// single Goroutine and dispatches them from another.  Since the connection
+// delivers notifications from a single Goroutine, and each handoff blocks
+// until received, dispatch order matches delivery order.
+func (s *NakedSesn) notifyListenOrdered() {
+	// A nil channel is never ready, so a listener that could not be created
+	// is simply ignored.
+	var coapNotify, nmpNotify chan Notification
+	var coapErr, nmpErr chan error
+
+	var chrIds []*BleChrId
+	var nls []*NotifyListener
+
+	if nl, err := s.createNotifyListener(s.mgmtChrs.ResRspChr); err != nil {
+		log.Debugf("error listening for notifications: %s", err.Error())
+	} else {
+		coapNotify, coapErr = nl.NotifyChan, nl.ErrChan
+		chrIds = append(chrIds, s.mgmtChrs.ResRspChr)
+		nls = append(nls, nl)
+	}
+	if nl, err := s.createNotifyListener(s.mgmtChrs.NmpRspChr); err != nil {
+		log.Debugf("error listening for notifications: %s", err.Error())
+	} else {
+		nmpNotify, nmpErr = nl.NotifyChan, nl.ErrChan
+		chrIds = append(chrIds, s.mgmtChrs.NmpRspChr)
+		nls = append(nls, nl)
+	}
+
+	sub := newSubscription(s, chrIds, false, nil)
+	stopChan := sub.attach(nls)
+	s.addSub(sub)
+	openChan := s.openChan
+
+	dispatchChan := make(chan orderedNotify, NOTIFY_DISPATCH_QUEUE_DEPTH)
+
+	// Terminates on:
+	// * Notify listener error.
+	// * Receive from stop channel.
+	s.routines.Go("notify-rx ordered", func() {
+		defer close(dispatchChan)
+
+		for {
+			var on orderedNotify
+
+			select {
+			case <-coapErr:
+				return
+			case <-nmpErr:
+				return
+			case n, ok := <-coapNotify:
+				if !ok {
+					continue
+				}
+				on = orderedNotify{n.Data, s.txvr.DispatchCoap}
+			case n, ok := <-nmpNotify:
+				if !ok {
+					continue
+				}
+				on = orderedNotify{n.Data, s.txvr.DispatchNmpRsp}
+			case <-stopChan:
+				return
+			}
+
+			select {
+			case dispatchChan <- on:
+			case <-stopChan:
+				return
+			}
+		}
+	})
+
+	// Terminates on:
+	// * Receiver Goroutine terminates.
+	// * Receive from stop channel.
+	s.routines.Go("notify-dispatch ordered", func() {
+		select {
+		case <-openChan:
+		case <-stopChan:
+			return
+		}
+
+		for {
+			select {
+			case on, ok := <-dispatchChan:
+				if !ok || stopped(stopChan) {
+					return
+				}
+				if s.cfg.FaultInjector.DropRx() {
+					continue
+				}
+				s.metrics.Count(METRIC_BLE_RX_BYTES, int64(len(on.data)))
+				on.dispatchCb(on.data)
+
+			case <-stopChan:
+				return
+			}
+		}
+	})
 }
 
 func (s *NakedSesn) notifyListen() {
-	s.notifyListenOnce(s.mgmtChrs.ResRspChr, s.txvr.DispatchCoap)
-	s.notifyListenOnce(s.mgmtChrs.NmpRspChr, s.txvr.DispatchNmpRsp)
+	if s.cfg.Ble.OrderedDispatch {
+		s.notifyListenOrdered()
+		return
+	}
+
+	s.notifyListenOnce(s.mgmtChrs.ResRspChr, false, s.txvr.DispatchCoap)
+	s.notifyListenOnce(s.mgmtChrs.NmpRspChr, false, s.txvr.DispatchNmpRsp)
 }
 
 func (s *NakedSesn) RxAccept() (sesn.Sesn, *sesn.SesnCfg, error) {
@@ -0,0 +1,628 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package nmble
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "mynewt.apache.org/newtmgr/nmxact/bledefs"
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+	"mynewt.apache.org/newtmgr/nmxact/nmxutil"
+	"mynewt.apache.org/newtmgr/nmxact/sesn"
+)
+
+func TestNakedSesnOpenClose(t *testing.T) {
+	bx, h, stop := newFakeXport(t)
+	defer stop()
+
+	s := newFakeSesn(t, bx, newFakeSesnCfg())
+
+	if err := s.Open(); err != nil {
+		t.Fatalf("Open: %s", err.Error())
+	}
+	if !s.IsOpen() {
+		t.Fatalf("session not open after Open()")
+	}
+	if bx.FindSesn(fakeConnHandle) != s {
+		t.Fatalf("transport has no record of the open session")
+	}
+	if mtu := s.MtuOut(); mtu <= 0 {
+		t.Fatalf("unexpected MtuOut after open: %d", mtu)
+	}
+	if h.numReqs(MSG_TYPE_WRITE) != 1 {
+		t.Fatalf("expected one CCCD write; got %d",
+			h.numReqs(MSG_TYPE_WRITE))
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %s", err.Error())
+	}
+	if s.IsOpen() {
+		t.Fatalf("session open after Close()")
+	}
+	if bx.NumSesns() != 0 {
+		t.Fatalf("transport retains %d sessions after close",
+			bx.NumSesns())
+	}
+	if h.numReqs(MSG_TYPE_TERMINATE) != 1 {
+		t.Fatalf("expected one terminate request; got %d",
+			h.numReqs(MSG_TYPE_TERMINATE))
+	}
+
+	// A closed session can be reopened.
+	if err := s.Open(); err != nil {
+		t.Fatalf("reopen: %s", err.Error())
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("second Close: %s", err.Error())
+	}
+
+	err := s.Close()
+	if !nmxutil.IsSesnClosed(err) {
+		t.Fatalf("closing a closed session: expected closed error; got %v",
+			err)
+	}
+}
+
+func TestNakedSesnPeerDisconnect(t *testing.T) {
+	bx, h, stop := newFakeXport(t)
+	defer stop()
+
+	s := newFakeSesn(t, bx, newFakeSesnCfg())
+	if err := s.Open(); err != nil {
+		t.Fatalf("Open: %s", err.Error())
+	}
+
+	closed := make(chan error, 1)
+	go func() { closed <- s.WaitClosed() }()
+
+	h.disconnect(ERR_CODE_HCI_REM_USER_CONN_TERM)
+	err := <-closed
+
+	if !nmxutil.IsBleSesnDisconnect(err) {
+		t.Fatalf("expected disconnect error; got %v", err)
+	}
+	if s.IsOpen() {
+		t.Fatalf("session open after peer disconnected")
+	}
+	if bx.NumSesns() != 0 {
+		t.Fatalf("transport retains %d sessions after disconnect",
+			bx.NumSesns())
+	}
+}
+
+func TestNakedSesnSecurityTimeout(t *testing.T) {
+	bx, h, stop := newFakeXport(t)
+	defer stop()
+
+	h.secNeverDone = true
+
+	cfg := newFakeSesnCfg()
+	cfg.Ble.EncryptWhen = BLE_ENCRYPT_ALWAYS
+	cfg.Ble.SecurityTimeout = 200 * time.Millisecond
+
+	s := newFakeSesn(t, bx, cfg)
+
+	start := time.Now()
+	err := s.Open()
+	if !nmxutil.IsBleSecurityTmo(err) {
+		t.Fatalf("expected security timeout; got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > cfg.Ble.ShutdownTimeout {
+		t.Fatalf("open took too long to fail: %s", elapsed)
+	}
+
+	if s.IsOpen() {
+		t.Fatalf("session open after security timeout")
+	}
+
+	// The abandoned procedure must not read as a success.
+	if v, _ := s.conn.encBlocker.Wait(0, nil); v == nil {
+		t.Fatalf("security blocker released without an error")
+	}
+
+	if h.numReqs(MSG_TYPE_TERMINATE) != 1 {
+		t.Fatalf("expected one terminate request; got %d",
+			h.numReqs(MSG_TYPE_TERMINATE))
+	}
+	if bx.NumSesns() != 0 {
+		t.Fatalf("transport retains %d sessions after security timeout",
+			bx.NumSesns())
+	}
+}
+
+func TestNakedSesnOnCloseCbPanic(t *testing.T) {
+	bx, _, stop := newFakeXport(t)
+	defer stop()
+
+	called := make(chan error, 1)
+	cfg := newFakeSesnCfg()
+	cfg.OnCloseCb = func(s sesn.Sesn, err error) {
+		called <- err
+		panic("on-close callback failure")
+	}
+
+	s := newFakeSesn(t, bx, cfg)
+	if err := s.Open(); err != nil {
+		t.Fatalf("Open: %s", err.Error())
+	}
+
+	closed := make(chan error, 1)
+	go func() { closed <- s.WaitClosed() }()
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %s", err.Error())
+	}
+
+	select {
+	case <-called:
+	default:
+		t.Fatalf("on-close callback not called")
+	}
+
+	// The panic must not prevent the rest of the shutdown.
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("WaitClosed not released after callback panicked")
+	}
+	if s.IsOpen() {
+		t.Fatalf("session open after Close()")
+	}
+	if bx.NumSesns() != 0 {
+		t.Fatalf("transport retains %d sessions after close",
+			bx.NumSesns())
+	}
+
+	// The session remains usable.
+	if err := s.Open(); err != nil {
+		t.Fatalf("reopen: %s", err.Error())
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("second Close: %s", err.Error())
+	}
+}
+
+func TestNakedSesnDegenerateMtu(t *testing.T) {
+	bx, h, stop := newFakeXport(t)
+	defer stop()
+
+	h.mtu = 10
+
+	s := newFakeSesn(t, bx, newFakeSesnCfg())
+	if err := s.Open(); err == nil {
+		t.Fatalf("Open succeeded with ATT MTU %d", h.mtu)
+	}
+	if s.IsOpen() {
+		t.Fatalf("session open despite degenerate MTU")
+	}
+	if bx.NumSesns() != 0 {
+		t.Fatalf("transport retains %d sessions after failed open",
+			bx.NumSesns())
+	}
+	if mtu := s.MtuOut(); mtu < 1 {
+		t.Fatalf("MtuOut reports unusable size: %d", mtu)
+	}
+}
+
+// Verifies that reopening a session succeeds when the peer retained the
+// management subscription and rejects the redundant CCCD write.
+func TestNakedSesnCccdAlreadySubscribed(t *testing.T) {
+	bx, h, stop := newFakeXport(t)
+	defer stop()
+
+	s := newFakeSesn(t, bx, newFakeSesnCfg())
+	if err := s.Open(); err != nil {
+		t.Fatalf("Open: %s", err.Error())
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %s", err.Error())
+	}
+
+	h.mtx.Lock()
+	h.hook = func(base MsgBase, data []byte) bool {
+		var req BleWriteReq
+		if base.Type != MSG_TYPE_WRITE ||
+			json.Unmarshal(data, &req) != nil ||
+			req.AttrHandle != fakeNmpCccd {
+
+			return false
+		}
+
+		h.rspStatus(base, 0)
+		h.send(&BleWriteAckEvt{
+			Op:     MSG_OP_EVT,
+			Type:   MSG_TYPE_WRITE_ACK_EVT,
+			Seq:    base.Seq,
+			Status: ERR_CODE_ATT_BASE + ERR_CODE_ATT_PROC_IN_PROGRESS,
+		})
+		return true
+	}
+	h.mtx.Unlock()
+
+	if err := s.Open(); err != nil {
+		t.Fatalf("reopen with retained subscription: %s", err.Error())
+	}
+	if !s.conn.hasCccd(fakeNmpCccd) {
+		t.Fatalf("retained subscription not recorded")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("second Close: %s", err.Error())
+	}
+}
+
+// Verifies that the connection descriptor can be read while the session is
+// being opened by scanning.  Run with -race.
+func TestNakedSesnConnInfoDuringOpen(t *testing.T) {
+	bx, _, stop := newFakeXport(t)
+	defer stop()
+
+	cfg := newFakeSesnCfg()
+	cfg.PeerSpec.Ble = BleDev{}
+	cfg.PeerSpec.BleMatch = func(r BleAdvReport) bool {
+		return r.Fields.Name != nil && *r.Fields.Name == fakePeerName
+	}
+
+	s := newFakeSesn(t, bx, cfg)
+
+	stopChan := make(chan struct{})
+	doneChan := make(chan struct{})
+	go func() {
+		defer close(doneChan)
+		for {
+			select {
+			case <-stopChan:
+				return
+			default:
+				s.ConnInfo()
+			}
+		}
+	}()
+
+	for i := 0; i < 3; i++ {
+		if err := s.Open(); err != nil {
+			t.Fatalf("Open: %s", err.Error())
+		}
+
+		desc, err := s.ConnInfo()
+		if err != nil {
+			t.Fatalf("ConnInfo: %s", err.Error())
+		}
+		if desc.MatchedAdv == nil {
+			t.Fatalf("connection descriptor lacks matched advertisement")
+		}
+
+		if err := s.Close(); err != nil {
+			t.Fatalf("Close: %s", err.Error())
+		}
+	}
+
+	close(stopChan)
+	<-doneChan
+}
+
+// Verifies that AbortOpen() called from another Goroutine in the middle of
+// setup fails the open and tears the connection down.  Run with -race.
+func TestNakedSesnAbortOpen(t *testing.T) {
+	bx, h, stop := newFakeXport(t)
+	defer stop()
+
+	s := newFakeSesn(t, bx, newFakeSesnCfg())
+
+	aborted := make(chan struct{})
+	h.mtx.Lock()
+	h.hook = func(base MsgBase, data []byte) bool {
+		if base.Type == MSG_TYPE_EXCHANGE_MTU {
+			go func() {
+				s.AbortOpen()
+				close(aborted)
+			}()
+			<-aborted
+		}
+		return false
+	}
+	h.mtx.Unlock()
+
+	err := s.Open()
+	if !nmxutil.IsSesnClosed(err) {
+		t.Fatalf("expected aborted open; got %v", err)
+	}
+	if s.IsOpen() {
+		t.Fatalf("session open after AbortOpen()")
+	}
+	if h.numReqs(MSG_TYPE_TERMINATE) != 1 {
+		t.Fatalf("expected one terminate request; got %d",
+			h.numReqs(MSG_TYPE_TERMINATE))
+	}
+	if h.numReqs(MSG_TYPE_DISC_ALL_SVCS) != 0 {
+		t.Fatalf("setup continued after AbortOpen()")
+	}
+	if bx.NumSesns() != 0 {
+		t.Fatalf("transport retains %d sessions after aborted open",
+			bx.NumSesns())
+	}
+
+	// Aborting an open that isn't in progress has no effect.
+	h.mtx.Lock()
+	h.hook = nil
+	h.mtx.Unlock()
+	s.AbortOpen()
+
+	if err := s.Open(); err != nil {
+		t.Fatalf("Open after aborted open: %s", err.Error())
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %s", err.Error())
+	}
+}
+
+// Adopts the fake host's connection with OpenConnectedCtx().  The returned
+// function removes the connection's event listener.
+func fakeAdopt(t *testing.T, bx *BleXport, h *fakeHost,
+	ctx context.Context, s *NakedSesn) (error, func()) {
+
+	seq := NextSeq()
+	bl, err := bx.AddListener(SeqKey(seq))
+	if err != nil {
+		t.Fatalf("AddListener: %s", err.Error())
+	}
+
+	h.mtx.Lock()
+	h.connSeq = seq
+	h.mtx.Unlock()
+
+	err = s.OpenConnectedCtx(ctx, fakeConnHandle, bl)
+	return err, func() { bx.RemoveListener(bl) }
+}
+
+// Verifies that cancelling the context during OpenConnectedCtx() fails the
+// open and releases the connection without terminating it.  Run with -race.
+func TestNakedSesnOpenConnectedCtxCancel(t *testing.T) {
+	bx, h, stop := newFakeXport(t)
+	defer stop()
+
+	s := newFakeSesn(t, bx, newFakeSesnCfg())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h.mtx.Lock()
+	h.hook = func(base MsgBase, data []byte) bool {
+		if base.Type == MSG_TYPE_CONN_FIND {
+			cancel()
+		}
+		return false
+	}
+	h.mtx.Unlock()
+
+	err, unlisten := fakeAdopt(t, bx, h, ctx, s)
+	defer unlisten()
+
+	if err != context.Canceled {
+		t.Fatalf("expected context.Canceled; got %v", err)
+	}
+	if s.IsOpen() {
+		t.Fatalf("session open after cancelled OpenConnectedCtx()")
+	}
+	if h.numReqs(MSG_TYPE_TERMINATE) != 0 {
+		t.Fatalf("cancelled adoption terminated the connection")
+	}
+	if bx.NumSesns() != 0 {
+		t.Fatalf("transport retains %d sessions after cancelled open",
+			bx.NumSesns())
+	}
+
+	// Once open, the context no longer applies.
+	h.mtx.Lock()
+	h.hook = nil
+	h.mtx.Unlock()
+
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	err, unlisten2 := fakeAdopt(t, bx, h, ctx2, s)
+	defer unlisten2()
+	if err != nil {
+		t.Fatalf("OpenConnectedCtx: %s", err.Error())
+	}
+
+	cancel2()
+	if !s.IsOpen() {
+		t.Fatalf("cancelling the context closed an open session")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %s", err.Error())
+	}
+	if h.numReqs(MSG_TYPE_TERMINATE) != 1 {
+		t.Fatalf("expected one terminate request; got %d",
+			h.numReqs(MSG_TYPE_TERMINATE))
+	}
+}
+
+// Verifies that with several task queue workers, the fragments of concurrent
+// requests are not interleaved, and that a lifecycle job queued among them
+// still completes.  Run with -race.
+func TestNakedSesnConcurrentRequests(t *testing.T) {
+	bx, h, stop := newFakeXport(t)
+	defer stop()
+
+	const numReqs = 8
+
+	cfg := newFakeSesnCfg()
+	cfg.Ble.TaskQueueWorkers = 4
+	cfg.Ble.MaxWriteLen = 32
+
+	// Each request carries a payload made of a single repeated letter.
+	payloads := make([]string, numReqs)
+	for i := range payloads {
+		payloads[i] = strings.Repeat(string(rune('a'+i)), 100)
+	}
+
+	// Reassembles each request and echoes its letter in the response.  A
+	// request is only recognized if its fragments arrived contiguously.
+	var mtx sync.Mutex
+	var buf []byte
+	h.mtx.Lock()
+	h.nmpRsp = func(frag []byte) [][]byte {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		buf = append(buf, frag...)
+		hdr, err := nmp.DecodeNmpHdr(buf)
+		if err != nil || len(buf) < nmp.NMP_HDR_SIZE+int(hdr.Len) {
+			return nil
+		}
+		req := buf[:nmp.NMP_HDR_SIZE+int(hdr.Len)]
+		buf = buf[len(req):]
+
+		letter := ""
+		for _, p := range payloads {
+			if bytes.Contains(req, []byte(p)) {
+				letter = p[:1]
+			}
+		}
+
+		rsp, err := nmp.EncodeNmpPlain(&nmp.NmpMsg{
+			Hdr: nmp.NmpHdr{
+				Op:    nmp.NMP_OP_WRITE_RSP,
+				Group: nmp.NMP_GROUP_DEFAULT,
+				Id:    nmp.NMP_ID_DEF_ECHO,
+				Seq:   hdr.Seq,
+			},
+			Body: &nmp.EchoRsp{Payload: letter},
+		})
+		if err != nil {
+			panic(err)
+		}
+		return [][]byte{rsp}
+	}
+	h.mtx.Unlock()
+
+	s := newFakeSesn(t, bx, cfg)
+	if err := s.Open(); err != nil {
+		t.Fatalf("Open: %s", err.Error())
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, numReqs+1)
+	for i := 0; i < numReqs; i++ {
+		wg.Add(1)
+		go func(payload string) {
+			defer wg.Done()
+
+			r := nmp.NewEchoReq()
+			r.Payload = payload
+			rsp, err := s.TxRxMgmt(r.Msg(), 2*time.Second)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if got := rsp.(*nmp.EchoRsp).Payload; got != payload[:1] {
+				errs <- fmt.Errorf("request \"%s...\" garbled; peer saw \"%s\"",
+					payload[:1], got)
+			}
+		}(payloads[i])
+	}
+
+	// Rediscovery runs exclusively, between requests.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := s.Rediscover(); err != nil {
+			errs <- err
+		}
+	}()
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("%s", err.Error())
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %s", err.Error())
+	}
+}
+
+// Verifies that a session cannot be created without a peer.
+func TestNakedSesnEmptyPeerSpec(t *testing.T) {
+	bx, _, stop := newFakeXport(t)
+	defer stop()
+
+	cfg := newFakeSesnCfg()
+	cfg.PeerSpec = sesn.PeerSpec{}
+
+	_, err := NewNakedSesn(bx, cfg)
+	if err == nil || !strings.Contains(err.Error(), "SesnCfg.PeerSpec") {
+		t.Fatalf("expected invalid peer spec error; got %v", err)
+	}
+
+	cfg.PeerSpec.BleMatch = func(r BleAdvReport) bool { return true }
+	if _, err := NewNakedSesn(bx, cfg); err != nil {
+		t.Fatalf("NewNakedSesn with predicate: %s", err.Error())
+	}
+}
+
+// Verifies that the task watchdog closes a session whose job never returns.
+func TestNakedSesnTaskWatchdogAbort(t *testing.T) {
+	bx, h, stop := newFakeXport(t)
+	defer stop()
+
+	cfg := newFakeSesnCfg()
+	cfg.TaskWatchdog = 50 * time.Millisecond
+	cfg.TaskWatchdogAbort = true
+	cfg.Ble.TaskQueueWorkers = 2
+
+	s := newFakeSesn(t, bx, cfg)
+	if err := s.Open(); err != nil {
+		t.Fatalf("Open: %s", err.Error())
+	}
+
+	block := make(chan struct{})
+	defer close(block)
+	go s.runTask("stuck", func() error {
+		<-block
+		return nil
+	})
+
+	closed := make(chan error, 1)
+	go func() { closed <- s.WaitClosed() }()
+
+	select {
+	case err := <-closed:
+		if !nmxutil.IsXport(err) {
+			t.Fatalf("expected transport error; got %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("session not closed after watchdog fired")
+	}
+
+	if s.IsOpen() {
+		t.Fatalf("session open after watchdog fired")
+	}
+	if h.numReqs(MSG_TYPE_TERMINATE) == 0 {
+		t.Fatalf("link not terminated after watchdog fired")
+	}
+}
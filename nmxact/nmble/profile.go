@@ -20,6 +20,9 @@
 package nmble
 
 import (
+	"fmt"
+	"strings"
+
 	. "mynewt.apache.org/newtmgr/nmxact/bledefs"
 )
 
@@ -80,20 +83,108 @@ func (p *Profile) SetServices(svcs []Service) {
 
 	for _, s := range svcs {
 		for _, c := range s.Chrs {
-			p.chrs[BleChrId{s.Uuid, c.Uuid}] = c
+			// If the ID is not unique, the first characteristic wins.
+			id := BleChrId{s.Uuid, c.Uuid}
+			if p.chrs[id] == nil {
+				p.chrs[id] = c
+			}
 			p.attrs[uint16(c.ValHandle)] = c
 		}
 	}
 }
 
+// Retrieves the first characteristic with the specified ID, in discovery
+// order.  Use FindChrsById() if the peer may expose duplicates.
 func (p *Profile) FindChrByUuid(id BleChrId) *Characteristic {
 	return p.chrs[id]
 }
 
+// Retrieves every characteristic with the specified UUID, regardless of
+// service, in discovery order.
+func (p *Profile) FindChrsByUuid(uuid BleUuid) []*Characteristic {
+	var chrs []*Characteristic
+
+	for _, s := range p.svcs {
+		for _, c := range s.Chrs {
+			if c.Uuid == uuid {
+				chrs = append(chrs, c)
+			}
+		}
+	}
+
+	return chrs
+}
+
+// Retrieves every characteristic with the specified service and
+// characteristic UUIDs, in discovery order.  Nonstandard peers sometimes
+// expose more than one.
+func (p *Profile) FindChrsById(id BleChrId) []*Characteristic {
+	var chrs []*Characteristic
+
+	for _, s := range p.svcs {
+		if s.Uuid != id.SvcUuid {
+			continue
+		}
+		for _, c := range s.Chrs {
+			if c.Uuid == id.ChrUuid {
+				chrs = append(chrs, c)
+			}
+		}
+	}
+
+	return chrs
+}
+
 func (p *Profile) FindChrByHandle(handle uint16) *Characteristic {
 	return p.attrs[handle]
 }
 
+// Returns a deep copy of the profile.  Modifications to the copy do not
+// affect the original.
+func (p *Profile) Copy() Profile {
+	svcs := make([]Service, len(p.svcs))
+	for i, s := range p.svcs {
+		svcs[i] = s
+		svcs[i].Chrs = make([]*Characteristic, len(s.Chrs))
+		for j, c := range s.Chrs {
+			chr := *c
+			chr.Dscs = make([]*Descriptor, len(c.Dscs))
+			for k, d := range c.Dscs {
+				dsc := *d
+				chr.Dscs[k] = &dsc
+			}
+			svcs[i].Chrs[j] = &chr
+		}
+	}
+
+	cp := NewProfile()
+	cp.SetServices(svcs)
+	return cp
+}
+
+// Produces a human-readable dump of all discovered services,
+// characteristics, and descriptors.
+func (p *Profile) String() string {
+	var sb strings.Builder
+
+	for _, s := range p.svcs {
+		fmt.Fprintf(&sb, "service: uuid=%s start=%d end=%d\n",
+			s.Uuid.String(), s.StartHandle, s.EndHandle)
+
+		for _, c := range s.Chrs {
+			fmt.Fprintf(&sb, "    chr: uuid=%s def=%d val=%d props=0x%02x\n",
+				c.Uuid.String(), c.DefHandle, c.ValHandle, int(c.Properties))
+
+			for _, d := range c.Dscs {
+				fmt.Fprintf(&sb, "        dsc: uuid=%s handle=%d\n",
+					d.Uuid.String(), d.Handle)
+			}
+		}
+	}
+
+	return sb.String()
+}
+
 func FindDscByUuid(chr *Characteristic, uuid BleUuid) *Descriptor {
 	for _, d := range chr.Dscs {
 		if CompareUuids(uuid, d.Uuid) == 0 {
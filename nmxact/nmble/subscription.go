@@ -0,0 +1,293 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package nmble
+
+import (
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	. "mynewt.apache.org/newtmgr/nmxact/bledefs"
+)
+
+// A handle to the delivery of notifications from one or more
+// characteristics.  The session tracks every subscription it creates and
+// cancels them all when it closes.  Subscriptions created with SubscribeChr()
+// survive a Pause() / Resume() cycle.
+type Subscription struct {
+	s          *NakedSesn
+	chrIds     []*BleChrId
+	dispatchCb func(b []byte)
+
+	// Whether cancelling the subscription also disables the peer's CCCDs.
+	// Only set for subscriptions created with SubscribeChr(); immutable.
+	cccd bool
+
+	// Closed on cancel.
+	doneChan chan struct{}
+
+	// The listeners and stop channel of the current connection.  Nil while
+	// the subscription is detached (i.e., the session is paused).
+	nls      []*NotifyListener
+	stopChan chan struct{}
+
+	cancelled bool
+	err       error
+	mtx       sync.Mutex
+}
+
+func newSubscription(s *NakedSesn, chrIds []*BleChrId, cccd bool,
+	dispatchCb func(b []byte)) *Subscription {
+
+	return &Subscription{
+		s:          s,
+		chrIds:     chrIds,
+		dispatchCb: dispatchCb,
+		cccd:       cccd,
+		doneChan:   make(chan struct{}),
+	}
+}
+
+// Retrieves the characteristics whose notifications the subscription
+// delivers.
+func (sub *Subscription) ChrIds() []*BleChrId {
+	return sub.chrIds
+}
+
+// Retrieves a channel that is closed when the subscription is cancelled,
+// either explicitly or because the session closed.
+func (sub *Subscription) Done() <-chan struct{} {
+	return sub.doneChan
+}
+
+// Stops delivery of notifications.  For subscriptions created with
+// SubscribeChr(), notifications are also disabled on the peer if the session
+// is still connected.  Subsequent calls have no effect and return the result
+// of the first.
+func (sub *Subscription) Cancel() error {
+	return sub.cancel(true)
+}
+
+// Binds the subscription to the listeners of the current connection.
+// Returns the stop channel that the delivery Goroutines must honor.
+func (sub *Subscription) attach(nls []*NotifyListener) chan struct{} {
+	sub.mtx.Lock()
+	defer sub.mtx.Unlock()
+
+	sub.nls = nls
+	sub.stopChan = make(chan struct{})
+	return sub.stopChan
+}
+
+// Stops the delivery Goroutines and detaches the connection's listeners
+// without cancelling the subscription.
+func (sub *Subscription) detach() {
+	sub.mtx.Lock()
+	stopChan := sub.stopChan
+	sub.stopChan = nil
+	nls := sub.nls
+	sub.nls = nil
+	sub.mtx.Unlock()
+
+	// The connection delivers notifications while holding its lock.  Release
+	// any delivery in progress before stopping the receivers, or the
+	// connection would block forever and StopListening() with it.
+	for _, nl := range nls {
+		nl.stopRx()
+	}
+	if stopChan != nil {
+		close(stopChan)
+	}
+	for _, nl := range nls {
+		sub.s.conn.StopListening(nl)
+	}
+}
+
+func (sub *Subscription) isAttached() bool {
+	sub.mtx.Lock()
+	defer sub.mtx.Unlock()
+
+	return sub.stopChan != nil
+}
+
+func (sub *Subscription) cancel(unsubscribe bool) error {
+	sub.mtx.Lock()
+	if sub.cancelled {
+		sub.mtx.Unlock()
+		return sub.err
+	}
+	sub.cancelled = true
+	close(sub.doneChan)
+	sub.mtx.Unlock()
+
+	sub.s.removeSub(sub)
+	sub.detach()
+
+	var err error
+	if unsubscribe && sub.cccd && sub.s.conn.IsConnected() {
+		for _, chrId := range sub.chrIds {
+			chr, cerr := sub.s.getChr(chrId)
+			if cerr == nil {
+				cerr = sub.s.conn.Unsubscribe(chr)
+			}
+			if cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+	}
+
+	sub.mtx.Lock()
+	sub.err = err
+	sub.mtx.Unlock()
+
+	return err
+}
+
+// Starts tracking a subscription.
+func (s *NakedSesn) addSub(sub *Subscription) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.subs[sub] = struct{}{}
+}
+
+func (s *NakedSesn) removeSub(sub *Subscription) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	delete(s.subs, sub)
+}
+
+// Cancels every subscription without writing to the peer.  Called during
+// shutdown.  If `keepUser` is set, subscriptions created with SubscribeChr()
+// are only detached so that Resume() can reattach them.
+func (s *NakedSesn) cancelSubs(keepUser bool) {
+	for _, sub := range s.Subscriptions() {
+		if keepUser && sub.cccd {
+			sub.detach()
+		} else {
+			sub.cancel(false)
+		}
+	}
+}
+
+// Reattaches the subscriptions that were detached by Pause() and enables
+// them on the peer again.  A subscription that cannot be restored is
+// cancelled; the first such error is returned.
+func (s *NakedSesn) restoreSubs() error {
+	var firstErr error
+
+	for _, sub := range s.Subscriptions() {
+		if sub.isAttached() {
+			continue
+		}
+
+		err := s.attachSub(sub)
+		if err == nil {
+			var chr *Characteristic
+			chr, err = s.getChr(sub.chrIds[0])
+			if err == nil {
+				err = s.conn.Subscribe(chr)
+			}
+		}
+
+		if err != nil {
+			log.Debugf("error restoring subscription to %s: %s",
+				sub.chrIds[0].String(), err.Error())
+			sub.cancel(false)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return firstErr
+}
+
+// Enables the peer's CCCDs again for every attached subscription created
+// with SubscribeChr().  Called after rediscovery, which forgets the CCCDs
+// that were enabled.  A subscription that cannot be re-enabled is
+// cancelled; the first such error is returned.
+func (s *NakedSesn) resubscribeSubs() error {
+	var firstErr error
+
+	for _, sub := range s.Subscriptions() {
+		if !sub.cccd || !sub.isAttached() {
+			continue
+		}
+
+		chr, err := s.getChr(sub.chrIds[0])
+		if err == nil {
+			err = s.conn.Subscribe(chr)
+		}
+
+		if err != nil {
+			log.Debugf("error resubscribing to %s: %s",
+				sub.chrIds[0].String(), err.Error())
+			sub.cancel(false)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return firstErr
+}
+
+// Retrieves the subscriptions that are currently active.
+func (s *NakedSesn) Subscriptions() []*Subscription {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	subs := make([]*Subscription, 0, len(s.subs))
+	for sub := range s.subs {
+		subs = append(subs, sub)
+	}
+	return subs
+}
+
+// Enables notifications or indications on the specified characteristic and
+// executes the callback for each one received.  The callback runs in a
+// dedicated Goroutine; it must not block for long, or further notifications
+// on the characteristic are delayed.
+func (s *NakedSesn) SubscribeChr(chrId *BleChrId,
+	cb func(data []byte)) (*Subscription, error) {
+
+	if err := s.failIfNotOpen(); err != nil {
+		return nil, err
+	}
+
+	chr, err := s.getChr(chrId)
+	if err != nil {
+		return nil, err
+	}
+
+	sub, err := s.notifyListenOnce(chrId, true, cb)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.conn.Subscribe(chr); err != nil {
+		sub.cancel(false)
+		return nil, err
+	}
+
+	return sub, nil
+}
@@ -0,0 +1,173 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package nmble
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Retrieves the names of the session's running Goroutines that contain the
+// specified string.
+func activeRoutines(s *NakedSesn, substr string) []string {
+	g := s.routines
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	var names []string
+	for name := range g.active {
+		if strings.Contains(name, substr) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Verifies that a subscription can be cancelled while the connection is
+// blocked delivering a notification to it, and that cancelling stops the
+// subscription's Goroutines.
+func TestSubscriptionCancelWhileBacklogged(t *testing.T) {
+	bx, h, stop := newFakeXport(t)
+	defer stop()
+
+	s := newFakeSesn(t, bx, newFakeSesnCfg())
+	if err := s.Open(); err != nil {
+		t.Fatalf("Open: %s", err.Error())
+	}
+	defer s.Close()
+
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+	defer close(release)
+
+	chrId := fakeUserChrId()
+	sub, err := s.SubscribeChr(chrId, func(data []byte) {
+		select {
+		case entered <- struct{}{}:
+		default:
+		}
+		<-release
+	})
+	if err != nil {
+		t.Fatalf("SubscribeChr: %s", err.Error())
+	}
+
+	// Block the callback, fill the dispatch queue, and leave one
+	// notification in the hands of the receiver and one in the connection.
+	for i := 0; i < NOTIFY_DISPATCH_QUEUE_DEPTH+3; i++ {
+		h.notifyAttr(fakeUserChrVal, []byte{byte(i)})
+	}
+	select {
+	case <-entered:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("notification not delivered")
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	cancelled := make(chan error, 1)
+	go func() { cancelled <- sub.Cancel() }()
+
+	select {
+	case err := <-cancelled:
+		if err != nil {
+			t.Fatalf("Cancel: %s", err.Error())
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Cancel blocked behind a pending notification")
+	}
+
+	select {
+	case <-sub.Done():
+	default:
+		t.Fatalf("subscription not done after Cancel")
+	}
+
+	// The receiver exits right away; the dispatcher exits once the callback
+	// returns.
+	release <- struct{}{}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(activeRoutines(s, chrId.String())) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("subscription Goroutines still running: %v",
+				activeRoutines(s, chrId.String()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The connection is still usable.
+	if !s.IsOpen() {
+		t.Fatalf("session closed after cancelling a subscription")
+	}
+	h.notify([]byte{0})
+}
+
+// Verifies that rediscovery enables the CCCD of a SubscribeChr()
+// subscription again, and that the subscription keeps delivering
+// notifications.
+func TestSubscriptionRediscover(t *testing.T) {
+	bx, h, stop := newFakeXport(t)
+	defer stop()
+
+	s := newFakeSesn(t, bx, newFakeSesnCfg())
+	if err := s.Open(); err != nil {
+		t.Fatalf("Open: %s", err.Error())
+	}
+	defer s.Close()
+
+	cccdWrites := make(chan struct{}, 4)
+	h.mtx.Lock()
+	h.hook = func(base MsgBase, data []byte) bool {
+		var req BleWriteReq
+		if base.Type == MSG_TYPE_WRITE &&
+			json.Unmarshal(data, &req) == nil &&
+			req.AttrHandle == fakeUserCccd {
+
+			cccdWrites <- struct{}{}
+		}
+		return false
+	}
+	h.mtx.Unlock()
+
+	rxd := make(chan []byte, 1)
+	if _, err := s.SubscribeChr(fakeUserChrId(), func(data []byte) {
+		rxd <- data
+	}); err != nil {
+		t.Fatalf("SubscribeChr: %s", err.Error())
+	}
+	<-cccdWrites
+
+	if err := s.Rediscover(); err != nil {
+		t.Fatalf("Rediscover: %s", err.Error())
+	}
+	select {
+	case <-cccdWrites:
+	default:
+		t.Fatalf("CCCD not enabled again after rediscovery")
+	}
+
+	h.notifyAttr(fakeUserChrVal, []byte{1})
+	select {
+	case <-rxd:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("notification not delivered after rediscovery")
+	}
+}
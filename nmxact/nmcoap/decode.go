@@ -0,0 +1,115 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package nmcoap
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/runtimeco/go-coap"
+	"github.com/ugorji/go/codec"
+)
+
+// Converts a CoAP payload into a Go value.
+type PayloadDecoder func(payload []byte) (interface{}, error)
+
+var decoderMtx sync.Mutex
+var decoderMap = map[coap.MediaType]PayloadDecoder{}
+
+// Registers a decoder for payloads of the specified content format.  A
+// previously registered decoder for the format is replaced.  A nil decoder
+// removes the registration.
+func RegisterDecoder(format coap.MediaType, dec PayloadDecoder) {
+	decoderMtx.Lock()
+	defer decoderMtx.Unlock()
+
+	if dec == nil {
+		delete(decoderMap, format)
+	} else {
+		decoderMap[format] = dec
+	}
+}
+
+func lookupDecoder(format coap.MediaType) PayloadDecoder {
+	decoderMtx.Lock()
+	defer decoderMtx.Unlock()
+
+	return decoderMap[format]
+}
+
+// Builds a decoder that unmarshals a CBOR payload into a fresh value created
+// by the specified factory.  The factory must return a pointer.
+func CborDecoder(factory func() interface{}) PayloadDecoder {
+	return func(payload []byte) (interface{}, error) {
+		v := factory()
+		err := codec.NewDecoderBytes(payload, new(codec.CborHandle)).
+			Decode(v)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid CBOR payload: %s", err.Error())
+		}
+		return v, nil
+	}
+}
+
+// Builds a decoder that unmarshals a JSON payload into a fresh value created
+// by the specified factory.  The factory must return a pointer.
+func JsonDecoder(factory func() interface{}) PayloadDecoder {
+	return func(payload []byte) (interface{}, error) {
+		v := factory()
+		err := codec.NewDecoderBytes(payload, new(codec.JsonHandle)).
+			Decode(v)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid JSON payload: %s", err.Error())
+		}
+		return v, nil
+	}
+}
+
+// Retrieves the value of a message's Content-Format option.  ok is false if
+// the option is absent.
+func ContentFormat(m coap.Message) (format coap.MediaType, ok bool) {
+	switch v := m.Option(coap.ContentFormat).(type) {
+	case coap.MediaType:
+		return v, true
+	case uint32:
+		return coap.MediaType(v), true
+	case int:
+		return coap.MediaType(v), true
+	default:
+		return 0, false
+	}
+}
+
+// Decodes a message's payload with the decoder registered for its content
+// format.  If the message has no content format, or no decoder is registered
+// for it, the raw payload bytes are returned.
+func DecodePayload(m coap.Message) (interface{}, error) {
+	format, ok := ContentFormat(m)
+	if !ok {
+		return m.Payload(), nil
+	}
+
+	dec := lookupDecoder(format)
+	if dec == nil {
+		return m.Payload(), nil
+	}
+
+	return dec(m.Payload())
+}
@@ -36,6 +36,9 @@ type Dispatcher struct {
 	rxer      Receiver
 	logDepth  int
 	mtx       sync.Mutex
+
+	// Optional; executed for each complete incoming message.
+	rxCb func(msg coap.Message)
 }
 
 func NewDispatcher(isTcp bool, logDepth int) *Dispatcher {
@@ -113,6 +116,10 @@ func (d *Dispatcher) Dispatch(data []byte) bool {
 	d.mtx.Lock()
 	defer d.mtx.Unlock()
 
+	if d.rxCb != nil {
+		d.rxCb(msg)
+	}
+
 	mc := CriteriaFromMsg(msg)
 	lner := d.matchListener(mc)
 	if lner == nil {
@@ -124,6 +131,15 @@ func (d *Dispatcher) Dispatch(data []byte) bool {
 	return true
 }
 
+// Registers a callback that is executed for each complete incoming message,
+// whether or not a listener matches it.  The callback must not block.
+func (d *Dispatcher) SetRxCb(cb func(msg coap.Message)) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.rxCb = cb
+}
+
 func (d *Dispatcher) ProcessCoapReq(data []byte) (coap.Message, error) {
 	m := d.rxer.Rx(data)
 	if m == nil {
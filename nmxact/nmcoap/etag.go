@@ -0,0 +1,96 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package nmcoap
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/runtimeco/go-coap"
+)
+
+type etagEntry struct {
+	etag []byte
+	rsp  coap.Message
+}
+
+// Remembers the most recent ETag-bearing response for each resource.  Used
+// to make conditional GET requests: a cached ETag is sent with the request,
+// and a 2.03 (Valid) reply indicates the cached response is still current
+// (RFC 7252, section 5.10.6).  Safe for concurrent use.
+type EtagCache struct {
+	entries map[string]etagEntry
+	mtx     sync.Mutex
+}
+
+func NewEtagCache() *EtagCache {
+	return &EtagCache{
+		entries: map[string]etagEntry{},
+	}
+}
+
+func etagKey(uri string) string {
+	return strings.TrimPrefix(uri, "/")
+}
+
+// Retrieves the ETag option of the specified message, or nil if it has
+// none.
+func Etag(m coap.Message) []byte {
+	if b, ok := m.Option(coap.ETag).([]byte); ok && len(b) > 0 {
+		return b
+	}
+
+	return nil
+}
+
+// Retrieves the cached ETag and response for the specified resource.
+func (c *EtagCache) Lookup(uri string) ([]byte, coap.Message, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	e, ok := c.entries[etagKey(uri)]
+	return e.etag, e.rsp, ok
+}
+
+// Records a response to a GET of the specified resource.  Responses without
+// an ETag evict any cached entry, since they cannot be validated later.
+func (c *EtagCache) Store(uri string, rsp coap.Message) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	etag := Etag(rsp)
+	if etag == nil {
+		delete(c.entries, etagKey(uri))
+		return
+	}
+
+	c.entries[etagKey(uri)] = etagEntry{
+		etag: etag,
+		rsp:  rsp,
+	}
+}
+
+// Discards the cached entry for the specified resource.
+func (c *EtagCache) Remove(uri string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	delete(c.entries, etagKey(uri))
+}
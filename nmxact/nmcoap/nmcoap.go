@@ -38,14 +38,27 @@ const (
 	OBSERVE_STOP
 )
 
+// The application/cbor content format (RFC 7049).  go-coap does not define
+// this media type.
+const MEDIA_TYPE_CBOR coap.MediaType = 60
+
 type MsgFilter func(msg coap.Message) (coap.Message, error)
 
+// An arbitrary CoAP option to attach to an outgoing message.
+type MsgOption struct {
+	Id  coap.OptionID
+	Val interface{}
+}
+
 type MsgParams struct {
 	Code    coap.COAPCode
 	Uri     string
 	Observe ObserveCode
 	Token   []byte
 	Payload []byte
+
+	// Additional options (e.g., Content-Format) to attach to the message.
+	Options []MsgOption
 }
 
 var messageIdMtx sync.Mutex
@@ -117,6 +130,10 @@ func CreateMsg(isTcp bool, mp MsgParams) (coap.Message, error) {
 	if mp.Token == nil {
 		mp.Token = nmxutil.NextToken()
 	}
+	if len(mp.Token) > nmxutil.COAP_TOKEN_LEN_MAX {
+		return nil, fmt.Errorf("CoAP token too long: %d bytes; max=%d",
+			len(mp.Token), nmxutil.COAP_TOKEN_LEN_MAX)
+	}
 
 	p := coap.MessageParams{
 		Type:    coap.Confirmable,
@@ -137,5 +154,9 @@ func CreateMsg(isTcp bool, mp MsgParams) (coap.Message, error) {
 		m.SetObserve(mp.Observe.Spec())
 	}
 
+	for _, o := range mp.Options {
+		m.AddOption(o.Id, o.Val)
+	}
+
 	return m, nil
 }
@@ -27,12 +27,17 @@ const (
 )
 
 const (
-	NMP_ERR_OK       = 0
-	NMP_ERR_EUNKNOWN = 1
-	NMP_ERR_ENOMEM   = 2
-	NMP_ERR_EINVAL   = 3
-	NMP_ERR_ETIMEOUT = 4
-	NMP_ERR_ENOENT   = 5
+	NMP_ERR_OK        = 0
+	NMP_ERR_EUNKNOWN  = 1
+	NMP_ERR_ENOMEM    = 2
+	NMP_ERR_EINVAL    = 3
+	NMP_ERR_ETIMEOUT  = 4
+	NMP_ERR_ENOENT    = 5
+	NMP_ERR_EBADSTATE = 6
+	NMP_ERR_EMSGSIZE  = 7
+	NMP_ERR_ENOTSUP   = 8
+	NMP_ERR_ECORRUPT  = 9
+	NMP_ERR_EPERUSER  = 256
 )
 
 // First 64 groups are reserved for system level newtmgr commands.
@@ -35,6 +35,10 @@ type Listener struct {
 	ErrChan chan error
 	tmoChan chan time.Time
 	timer   *time.Timer
+
+	// Only set for raw listeners.  Receives the undecoded response packet
+	// instead of RspChan.
+	RawChan chan []byte
 }
 
 func NewListener() *Listener {
@@ -61,6 +65,9 @@ func (nl *Listener) Close() {
 	close(nl.RspChan)
 	close(nl.ErrChan)
 	close(nl.tmoChan)
+	if nl.RawChan != nil {
+		close(nl.RawChan)
+	}
 }
 
 // The dispatcher is the owner of the listeners it points to.  Only the
@@ -68,6 +75,8 @@ func (nl *Listener) Close() {
 type Dispatcher struct {
 	seqListenerMap map[uint8]*Listener
 	reassembler    *Reassembler
+	protoChecker   *ProtoChecker
+	unsolicitedCb  func(r NmpRsp)
 	logDepth       int
 	mtx            sync.Mutex
 }
@@ -80,8 +89,8 @@ func NewDispatcher(logDepth int) *Dispatcher {
 	}
 }
 
-func (d *Dispatcher) AddListener(seq uint8) (*Listener, error) {
-	nmxutil.LogAddNmpListener(d.logDepth, seq)
+func (d *Dispatcher) addListener(seq uint8, raw bool) (*Listener, error) {
+	nmxutil.LogAddNmpListener(d.logDepth+1, seq)
 
 	d.mtx.Lock()
 	defer d.mtx.Unlock()
@@ -91,10 +100,47 @@ func (d *Dispatcher) AddListener(seq uint8) (*Listener, error) {
 	}
 
 	nl := NewListener()
+	if raw {
+		nl.RawChan = make(chan []byte, 1)
+	}
 	d.seqListenerMap[seq] = nl
 	return nl, nil
 }
 
+func (d *Dispatcher) AddListener(seq uint8) (*Listener, error) {
+	return d.addListener(seq, false)
+}
+
+// Adds a listener that receives the raw, reassembled response packet via its
+// RawChan rather than a decoded response.
+func (d *Dispatcher) AddRawListener(seq uint8) (*Listener, error) {
+	return d.addListener(seq, true)
+}
+
+// Delivers a reassembled packet to a raw listener, if one is registered for
+// the packet's sequence number.  Returns true if the packet was delivered.
+func (d *Dispatcher) dispatchRaw(pkt []byte) bool {
+	hdr, err := DecodeNmpHdr(pkt)
+	if err != nil {
+		return false
+	}
+
+	if hdr.Op != NMP_OP_READ_RSP && hdr.Op != NMP_OP_WRITE_RSP {
+		return false
+	}
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	nl := d.seqListenerMap[hdr.Seq]
+	if nl == nil || nl.RawChan == nil {
+		return false
+	}
+
+	nl.RawChan <- pkt
+	return true
+}
+
 func (d *Dispatcher) RemoveListener(seq uint8) *Listener {
 	nmxutil.LogRemoveNmpListener(d.logDepth, seq)
 
@@ -125,24 +171,70 @@ func decodeRsp(pkt []byte) (NmpRsp, error) {
 	return DecodeRspBody(hdr, body)
 }
 
+// Sets the callback to execute when a response arrives that has no matching
+// listener (e.g., a message initiated by the peer).  A nil callback causes
+// such responses to be dropped.  The callback runs in the Goroutine that
+// dispatches responses, so it must not block waiting for another response.
+func (d *Dispatcher) SetUnsolicitedCb(cb func(r NmpRsp)) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.unsolicitedCb = cb
+}
+
 // Returns true if the response was dispatched.
 func (d *Dispatcher) DispatchRsp(r NmpRsp) bool {
 	d.mtx.Lock()
-	defer d.mtx.Unlock()
 
 	log.Debugf("Received nmp rsp: %+v", r)
 
 	nl := d.seqListenerMap[r.Hdr().Seq]
 	if nl == nil {
-		log.Debugf("No listener for incoming NMP message")
-		return false
+		cb := d.unsolicitedCb
+		d.mtx.Unlock()
+
+		if cb == nil {
+			log.Debugf("No listener for incoming NMP message")
+			return false
+		}
+
+		// Execute the callback without the lock held so that it can add
+		// listeners.
+		log.Debugf("Dispatching unsolicited NMP message")
+		cb(r)
+		return true
 	}
 
 	nl.RspChan <- r
+	d.mtx.Unlock()
 
 	return true
 }
 
+// Configures the callback executed when response reassembly detects a lost
+// fragment.  This must be called before any responses are received.
+func (d *Dispatcher) SetFragGapCb(cb FragGapFn) {
+	d.reassembler.SetGapCb(cb)
+}
+
+// Configures the callback executed for each response fragment received.
+// This must be called before any responses are received.
+func (d *Dispatcher) SetFragCb(cb FragFn) {
+	d.reassembler.SetFragCb(cb)
+}
+
+// Configures the pool that response reassembly buffers are drawn from.  This
+// must be called before any responses are received.
+func (d *Dispatcher) SetBufPool(pool *nmxutil.BufPool) {
+	d.reassembler.SetBufPool(pool)
+}
+
+// Configures the checker that inspects the protocol version of incoming
+// responses.  This must be called before any responses are received.
+func (d *Dispatcher) SetProtoChecker(pc *ProtoChecker) {
+	d.protoChecker = pc
+}
+
 // Returns true if the response was dispatched.
 func (d *Dispatcher) Dispatch(data []byte) bool {
 	pkt := d.reassembler.RxFrag(data)
@@ -150,7 +242,23 @@ func (d *Dispatcher) Dispatch(data []byte) bool {
 		return false
 	}
 
+	if hdr, err := DecodeNmpHdr(pkt); err == nil && d.protoChecker != nil {
+		if err := d.protoChecker.Check(hdr); err != nil {
+			// Fail the request explicitly rather than letting it time out.
+			d.reassembler.Release(pkt)
+			return d.ErrorOne(hdr.Seq, err) == nil
+		}
+		pkt[0] = hdr.Op
+	}
+
+	if d.dispatchRaw(pkt) {
+		// The raw listener now owns the packet; don't recycle it.
+		return true
+	}
+
+	// The decoded response copies everything it needs out of the packet.
 	rsp, err := decodeRsp(pkt)
+	d.reassembler.Release(pkt)
 	if err != nil {
 		log.Debugf("Failure decoding NMP rsp: %s\npacket=\n%s", err.Error(),
 			hex.Dump(data))
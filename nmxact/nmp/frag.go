@@ -21,17 +21,59 @@ package nmp
 
 import (
 	log "github.com/sirupsen/logrus"
+
+	"mynewt.apache.org/newtmgr/nmxact/nmxutil"
 )
 
+// Executed when reassembly detects that a fragment was lost.  `seq` is the
+// sequence number of the packet being reassembled; `expected` is its body
+// length according to its header, and `received` is the number of body
+// bytes that arrived before the inconsistency was detected.
+type FragGapFn func(seq uint8, expected int, received int)
+
+// Executed when a fragment is added to a packet being reassembled.  `seq` is
+// the sequence number of that packet.
+type FragFn func(seq uint8)
+
 type Reassembler struct {
-	cur []byte
+	cur    []byte
+	gapCb  FragGapFn
+	fragCb FragFn
+
+	// Optional; supplies the buffers that packets are reassembled into.
+	pool *nmxutil.BufPool
 }
 
 func NewReassembler() *Reassembler {
 	return &Reassembler{}
 }
 
+// Configures the callback executed when a fragment gap is detected.
+func (r *Reassembler) SetGapCb(cb FragGapFn) {
+	r.gapCb = cb
+}
+
+// Configures the callback executed for each fragment received.
+func (r *Reassembler) SetFragCb(cb FragFn) {
+	r.fragCb = cb
+}
+
+// Configures the pool that reassembly buffers are drawn from.  Packets
+// returned by RxFrag() should then be handed back via Release() once they
+// are no longer referenced.
+func (r *Reassembler) SetBufPool(pool *nmxutil.BufPool) {
+	r.pool = pool
+}
+
+// Returns a packet produced by RxFrag() to the buffer pool, if any.
+func (r *Reassembler) Release(pkt []byte) {
+	r.pool.Put(pkt)
+}
+
 func (r *Reassembler) RxFrag(frag []byte) []byte {
+	if r.cur == nil {
+		r.cur = r.pool.Get()
+	}
 	r.cur = append(r.cur, frag...)
 
 	hdr, err := DecodeNmpHdr(r.cur)
@@ -42,13 +84,23 @@ func (r *Reassembler) RxFrag(frag []byte) []byte {
 
 	actualLen := len(r.cur) - NMP_HDR_SIZE
 	if actualLen > int(hdr.Len) {
-		// More data than expected.  Discard packet.
+		// More data than expected.  Discard packet.  If the packet spans
+		// several fragments, a fragment was likely lost and the start of
+		// the next packet was appended in its place.
 		log.Debugf("received invalid nmp packet; hdr.len=%d actualLen=%d",
 			hdr.Len, actualLen)
+		if r.gapCb != nil && len(r.cur) > len(frag) {
+			r.gapCb(hdr.Seq, int(hdr.Len), len(r.cur)-len(frag)-NMP_HDR_SIZE)
+		}
+		r.pool.Put(r.cur)
 		r.cur = nil
 		return nil
 	}
 
+	if r.fragCb != nil {
+		r.fragCb(hdr.Seq)
+	}
+
 	if actualLen < int(hdr.Len) {
 		// More fragments to come.
 		return nil
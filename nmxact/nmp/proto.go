@@ -0,0 +1,101 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package nmp
+
+import (
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"mynewt.apache.org/newtmgr/nmxact/nmxutil"
+)
+
+// Version of the NMP header format that this library speaks.  Devices
+// running a newer management stack encode their protocol version in bits 3
+// and 4 of the header's op byte.
+const NMP_PROTO_VER = 0
+
+const (
+	NMP_HDR_OP_MASK   = 0x07
+	NMP_HDR_VER_SHIFT = 3
+	NMP_HDR_VER_MASK  = 0x03
+)
+
+// Retrieves the protocol version encoded in the header.
+func (hdr *NmpHdr) Version() int {
+	return int(hdr.Op>>NMP_HDR_VER_SHIFT) & NMP_HDR_VER_MASK
+}
+
+// Executed when a response carries a protocol version other than the one
+// this library expects.
+type ProtoMismatchFn func(detected int, expected int)
+
+// Inspects the protocol version of incoming responses.  A nil
+// *ProtoChecker accepts everything unchanged.
+type ProtoChecker struct {
+	cb     ProtoMismatchFn
+	strict bool
+	warned bool
+	mtx    sync.Mutex
+}
+
+// Creates a protocol checker.  If `strict` is true, responses with a
+// mismatched version are rejected; otherwise they are decoded as if they
+// used NMP_PROTO_VER.
+func NewProtoChecker(cb ProtoMismatchFn, strict bool) *ProtoChecker {
+	return &ProtoChecker{
+		cb:     cb,
+		strict: strict,
+	}
+}
+
+// Checks the version of a received header.  The mismatch callback is only
+// executed for the first mismatched response.  In lenient mode, the version
+// bits are cleared from the header so that it can be decoded normally.
+func (pc *ProtoChecker) Check(hdr *NmpHdr) error {
+	if pc == nil {
+		return nil
+	}
+
+	ver := hdr.Version()
+	if ver == NMP_PROTO_VER {
+		return nil
+	}
+
+	pc.mtx.Lock()
+	first := !pc.warned
+	pc.warned = true
+	pc.mtx.Unlock()
+
+	if first {
+		log.Warnf("NMP protocol version mismatch; detected=%d expected=%d",
+			ver, NMP_PROTO_VER)
+		if pc.cb != nil {
+			pc.cb(ver, NMP_PROTO_VER)
+		}
+	}
+
+	if pc.strict {
+		return nmxutil.NewProtoMismatchError(ver, NMP_PROTO_VER)
+	}
+
+	hdr.Op &= NMP_HDR_OP_MASK
+	return nil
+}
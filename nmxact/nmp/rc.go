@@ -0,0 +1,106 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package nmp
+
+import (
+	"fmt"
+	"reflect"
+)
+
+var NmpErrStringMap = map[int]string{
+	NMP_ERR_OK:        "ok",
+	NMP_ERR_EUNKNOWN:  "eunknown",
+	NMP_ERR_ENOMEM:    "enomem",
+	NMP_ERR_EINVAL:    "einval",
+	NMP_ERR_ETIMEOUT:  "etimeout",
+	NMP_ERR_ENOENT:    "enoent",
+	NMP_ERR_EBADSTATE: "ebadstate",
+	NMP_ERR_EMSGSIZE:  "emsgsize",
+	NMP_ERR_ENOTSUP:   "enotsup",
+	NMP_ERR_ECORRUPT:  "ecorrupt",
+}
+
+func NmpErrToString(rc int) string {
+	s := NmpErrStringMap[rc]
+	if s == "" {
+		if rc >= NMP_ERR_EPERUSER {
+			return fmt.Sprintf("eperuser+%d", rc-NMP_ERR_EPERUSER)
+		}
+		return "???"
+	}
+
+	return s
+}
+
+// Indicates that the device rejected a request with a nonzero return code.
+type RcError struct {
+	Rc    int
+	Group uint16
+	Id    uint8
+}
+
+func (e *RcError) Error() string {
+	return fmt.Sprintf("NMP request failed; group=%d id=%d rc=%d (%s)",
+		e.Group, e.Id, e.Rc, NmpErrToString(e.Rc))
+}
+
+func IsRcError(err error) bool {
+	_, ok := err.(*RcError)
+	return ok
+}
+
+// Retrieves the return code of the specified response.  The second return
+// value is false if the response type has no return code.
+func RspRc(rsp NmpRsp) (int, bool) {
+	v := reflect.ValueOf(rsp)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return 0, false
+	}
+
+	f := v.FieldByName("Rc")
+	if !f.IsValid() || f.Kind() != reflect.Int {
+		return 0, false
+	}
+
+	return int(f.Int()), true
+}
+
+// CheckRc returns an RcError if the response carries a nonzero return code,
+// or nil otherwise.  Responses without a return code are considered
+// successful.
+func CheckRc(rsp NmpRsp) error {
+	rc, ok := RspRc(rsp)
+	if !ok || rc == NMP_ERR_OK {
+		return nil
+	}
+
+	e := &RcError{
+		Rc: rc,
+	}
+	if hdr := rsp.Hdr(); hdr != nil {
+		e.Group = hdr.Group
+		e.Id = hdr.Id
+	}
+
+	return e
+}
@@ -0,0 +1,101 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package nmserial
+
+import (
+	"sort"
+	"strings"
+)
+
+// Describes a serial device that is available on the host.  The USB fields
+// are only populated if the device is USB-attached and the OS exposes the
+// information; otherwise they are zero / empty.
+type PortInfo struct {
+	// Path to pass as XportCfg.DevPath (e.g., "/dev/ttyACM0").
+	DevPath string
+
+	Vid          uint16
+	Pid          uint16
+	Manufacturer string
+	Description  string
+	SerialNum    string
+}
+
+// Identifies a USB device.  A Pid of 0 matches any product from the vendor.
+type UsbId struct {
+	Vid  uint16
+	Pid  uint16
+	Desc string
+}
+
+// USB identifiers commonly presented by Mynewt devices: the Mynewt USB stack
+// default, and the debug probes / USB-serial bridges found on supported
+// boards.
+var MynewtUsbIds = []UsbId{
+	{0xc0ca, 0xc01a, "Apache Mynewt USB CDC"},
+	{0x1366, 0, "SEGGER J-Link"},
+	{0x0d28, 0x0204, "ARM DAPLink"},
+	{0x1915, 0, "Nordic Semiconductor"},
+	{0x0403, 0, "FTDI USB-serial"},
+	{0x10c4, 0xea60, "Silicon Labs CP210x"},
+}
+
+func (id UsbId) Matches(p PortInfo) bool {
+	return id.Vid == p.Vid && (id.Pid == 0 || id.Pid == p.Pid)
+}
+
+// Indicates whether the port matches any of the specified USB identifiers.
+func (p PortInfo) MatchesAny(ids []UsbId) bool {
+	for _, id := range ids {
+		if id.Matches(p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// EnumeratePorts lists the serial devices currently available on the host,
+// sorted by path.  USB metadata is reported where the OS provides it.
+func EnumeratePorts() ([]PortInfo, error) {
+	ports, err := enumeratePorts()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(ports, func(i, j int) bool {
+		return strings.Compare(ports[i].DevPath, ports[j].DevPath) < 0
+	})
+
+	return ports, nil
+}
+
+// Retains only the ports that match one of the specified USB identifiers.
+// Pass MynewtUsbIds to find likely Mynewt devices.
+func FilterPorts(ports []PortInfo, ids []UsbId) []PortInfo {
+	var filtered []PortInfo
+	for _, p := range ports {
+		if p.MatchesAny(ids) {
+			filtered = append(filtered, p)
+		}
+	}
+
+	return filtered
+}
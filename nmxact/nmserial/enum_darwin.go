@@ -0,0 +1,46 @@
+//go:build darwin
+// +build darwin
+
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package nmserial
+
+import (
+	"path/filepath"
+)
+
+// USB metadata is only available through IOKit, so just the device paths are
+// reported.  The call-out ("cu") devices are listed because they don't block
+// waiting for carrier detect.
+func enumeratePorts() ([]PortInfo, error) {
+	paths, err := filepath.Glob("/dev/cu.*")
+	if err != nil {
+		return nil, err
+	}
+
+	var ports []PortInfo
+	for _, path := range paths {
+		ports = append(ports, PortInfo{
+			DevPath: path,
+		})
+	}
+
+	return ports, nil
+}
@@ -0,0 +1,103 @@
+//go:build linux
+// +build linux
+
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package nmserial
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const sysClassTty = "/sys/class/tty"
+
+// Reads a single-line sysfs attribute.  Returns "" if it can't be read.
+func readSysAttr(dir string, name string) string {
+	b, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// Walks up from a tty's device directory to the enclosing USB device, if
+// any.  Returns "" if the tty is not USB-attached.
+func usbDevDir(devDir string) string {
+	for dir := devDir; dir != "/" && dir != "."; dir = filepath.Dir(dir) {
+		if readSysAttr(dir, "idVendor") != "" {
+			return dir
+		}
+	}
+	return ""
+}
+
+func enumeratePorts() ([]PortInfo, error) {
+	entries, err := ioutil.ReadDir(sysClassTty)
+	if err != nil {
+		return nil, err
+	}
+
+	var ports []PortInfo
+	for _, e := range entries {
+		ttyDir := filepath.Join(sysClassTty, e.Name())
+
+		// Virtual terminals have no backing device.
+		devDir, err := filepath.EvalSymlinks(filepath.Join(ttyDir, "device"))
+		if err != nil {
+			continue
+		}
+
+		// Legacy on-board UARTs (ttyS*) are registered whether or not the
+		// hardware is present; skip them.
+		subsys, _ := filepath.EvalSymlinks(filepath.Join(devDir, "subsystem"))
+		if filepath.Base(subsys) == "platform" {
+			continue
+		}
+
+		devPath := filepath.Join("/dev", e.Name())
+		if _, err := os.Stat(devPath); err != nil {
+			continue
+		}
+
+		p := PortInfo{
+			DevPath: devPath,
+		}
+
+		if usbDir := usbDevDir(devDir); usbDir != "" {
+			vid, _ := strconv.ParseUint(readSysAttr(usbDir, "idVendor"), 16, 16)
+			pid, _ := strconv.ParseUint(readSysAttr(usbDir, "idProduct"), 16,
+				16)
+
+			p.Vid = uint16(vid)
+			p.Pid = uint16(pid)
+			p.Manufacturer = readSysAttr(usbDir, "manufacturer")
+			p.Description = readSysAttr(usbDir, "product")
+			p.SerialNum = readSysAttr(usbDir, "serial")
+		}
+
+		ports = append(ports, p)
+	}
+
+	return ports, nil
+}
@@ -58,11 +58,15 @@ func NewSerialSesn(sx *SerialXport, cfg sesn.SesnCfg) (*SerialSesn, error) {
 	}
 
 	txvr, err := mgmt.NewTransceiver(cfg.TxFilterCb, cfg.RxFilterCb, false,
-		cfg.MgmtProto, 3)
+		cfg.MgmtProto, cfg.TxvrLogDepth)
 	if err != nil {
 		return nil, err
 	}
 	s.txvr = txvr
+	s.txvr.SetUnsolicitedCb(cfg.UnsolicitedCb)
+	s.txvr.SetRxFragTimeout(cfg.RxFragTimeout)
+	s.txvr.SetFragGapCb(cfg.FragGapCb)
+	s.txvr.SetProtoMismatchCb(cfg.ProtoMismatchCb, cfg.ProtoStrict)
 
 	return s, nil
 }
@@ -77,12 +81,16 @@ func (s *SerialSesn) Open() error {
 	}
 
 	txvr, err := mgmt.NewTransceiver(s.cfg.TxFilterCb, s.cfg.RxFilterCb, false,
-		s.cfg.MgmtProto, 3)
+		s.cfg.MgmtProto, s.cfg.TxvrLogDepth)
 	if err != nil {
 		s.m.Unlock()
 		return err
 	}
 	s.txvr = txvr
+	s.txvr.SetUnsolicitedCb(s.cfg.UnsolicitedCb)
+	s.txvr.SetRxFragTimeout(s.cfg.RxFragTimeout)
+	s.txvr.SetFragGapCb(s.cfg.FragGapCb)
+	s.txvr.SetProtoMismatchCb(s.cfg.ProtoMismatchCb, s.cfg.ProtoStrict)
 	s.errChan = make(chan error)
 	s.msgChan = make(chan []byte, 16)
 	s.connChan = make(chan *SerialSesn, 4)
@@ -245,6 +253,14 @@ func (s *SerialSesn) CoapIsTcp() bool {
 	return false
 }
 
+func (s *SerialSesn) Capabilities() sesn.SesnCaps {
+	return sesn.SesnCaps{
+		Observe:    true,
+		Reconnect:  false,
+		MaxPayload: s.MtuOut(),
+	}
+}
+
 func (s *SerialSesn) RxAccept() (sesn.Sesn, *sesn.SesnCfg, error) {
 	if !s.isOpen {
 		return nil, nil, nmxutil.NewSesnClosedError(
@@ -285,7 +301,11 @@ func (s *SerialSesn) RxCoap(opt sesn.TxOptions) (coap.Message, error) {
 	if s.sx.reqSesn != s {
 		return nil, fmt.Errorf("Invalid operation")
 	}
-	waitTmoChan := time.After(opt.Timeout)
+	timeout, err := opt.AttemptTimeout()
+	if err != nil {
+		return nil, err
+	}
+	waitTmoChan := time.After(timeout)
 	s.wg.Add(1)
 	defer s.wg.Done()
 	for {
@@ -27,6 +27,7 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/joaojeronimo/go-crc16"
@@ -55,6 +56,10 @@ func NewXportCfg() *XportCfg {
 }
 
 type SerialXport struct {
+	// Number of received frames discarded due to a bad CRC or length.
+	// Accessed atomically; kept first for 64-bit alignment.
+	corruptFrames uint64
+
 	cfg     *XportCfg
 	port    *serial.Port
 	scanner *bufio.Scanner
@@ -299,6 +304,22 @@ func (sx *SerialXport) Tx(bytes []byte) error {
 	return nil
 }
 
+// Drops the packet being reassembled.  A corrupt packet is never delivered
+// as a response; the waiting request times out instead.
+func (sx *SerialXport) discardFrame(reason string, line []byte) {
+	atomic.AddUint64(&sx.corruptFrames, 1)
+	sx.pkt = nil
+
+	log.Warnf("Discarding corrupt serial frame: %s", reason)
+	log.Debugf("Corrupt frame hex dump:\n%s", hex.Dump(line))
+}
+
+// Retrieves the number of received frames that were discarded because they
+// failed CRC or length validation.
+func (sx *SerialXport) CorruptFrames() uint64 {
+	return atomic.LoadUint64(&sx.corruptFrames)
+}
+
 // Blocking receive.
 func (sx *SerialXport) Rx() ([]byte, error) {
 	for sx.scanner.Scan() {
@@ -321,9 +342,9 @@ func (sx *SerialXport) Rx() ([]byte, error) {
 
 		data, err := base64.StdEncoding.DecodeString(base64Data)
 		if err != nil {
-			return nil, fmt.Errorf("Couldn't decode base64 string:"+
-				" %s\nPacket hex dump:\n%s",
-				base64Data, hex.Dump(line))
+			sx.discardFrame(fmt.Sprintf("invalid base64: %s", err.Error()),
+				line)
+			continue
 		}
 
 		if line[0] == 6 && line[1] == 9 {
@@ -331,7 +352,14 @@ func (sx *SerialXport) Rx() ([]byte, error) {
 				continue
 			}
 
+			// The length includes the two-byte CRC.
 			pktLen := binary.BigEndian.Uint16(data[0:2])
+			if pktLen < 2 {
+				sx.discardFrame(fmt.Sprintf("invalid length: %d", pktLen),
+					line)
+				continue
+			}
+
 			sx.pkt, err = NewPacket(pktLen)
 			if err != nil {
 				return nil, err
@@ -345,8 +373,16 @@ func (sx *SerialXport) Rx() ([]byte, error) {
 
 		full := sx.pkt.AddBytes(data)
 		if full {
+			if len(sx.pkt.GetBytes()) != int(sx.pkt.expectedLen) {
+				sx.discardFrame(fmt.Sprintf("length mismatch; "+
+					"expected=%d actual=%d",
+					sx.pkt.expectedLen, len(sx.pkt.GetBytes())), line)
+				continue
+			}
+
 			if crc16.Crc16(sx.pkt.GetBytes()) != 0 {
-				return nil, fmt.Errorf("CRC error")
+				sx.discardFrame("CRC error", line)
+				continue
 			}
 
 			/*
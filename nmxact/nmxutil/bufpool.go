@@ -0,0 +1,70 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package nmxutil
+
+import (
+	"sync"
+)
+
+// A pool of byte buffers shared by the packet reassemblers of several
+// sessions.  Buffers are zeroed when they are returned, so the contents of
+// one packet are never visible to the next user of the buffer.  Buffers that
+// grew beyond the pool's maximum size are dropped rather than retained.  A
+// nil *BufPool is valid: Get() returns nil and Put() does nothing.
+type BufPool struct {
+	maxSz int
+	pool  sync.Pool
+}
+
+// Creates a buffer pool that retains buffers of up to `maxSz` bytes.
+func NewBufPool(maxSz int) *BufPool {
+	return &BufPool{
+		maxSz: maxSz,
+	}
+}
+
+// Retrieves an empty buffer from the pool.  The returned buffer has a length
+// of zero; its capacity depends on its previous use.
+func (p *BufPool) Get() []byte {
+	if p == nil {
+		return nil
+	}
+
+	if b, ok := p.pool.Get().(*[]byte); ok {
+		return (*b)[:0]
+	}
+
+	return make([]byte, 0, 256)
+}
+
+// Returns a buffer to the pool.  The caller must not use the buffer
+// afterwards.
+func (p *BufPool) Put(b []byte) {
+	if p == nil || b == nil || cap(b) > p.maxSz {
+		return
+	}
+
+	b = b[:cap(b)]
+	for i := range b {
+		b[i] = 0
+	}
+	b = b[:0]
+	p.pool.Put(&b)
+}
@@ -0,0 +1,106 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package nmxutil
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Simulates an unreliable link for testing timeout and retry handling.  A
+// session configured with a fault injector consults it before each outgoing
+// write and each incoming packet.  Sessions are created without one; faults
+// are only injected when SesnCfg.FaultInjector is explicitly set.
+type FaultInjector struct {
+	// Delay applied to each outgoing write.
+	WriteDelay time.Duration
+
+	// Fraction (0 to 1) of outgoing writes that are silently discarded.
+	WriteDropRate float64
+
+	// Fraction (0 to 1) of outgoing writes that fail with WriteErr.  If
+	// WriteErr is nil, a generic error is used.
+	WriteErrRate float64
+	WriteErr     error
+
+	// Fraction (0 to 1) of incoming packets (e.g., BLE notifications) that
+	// are silently discarded.
+	RxDropRate float64
+
+	rng *rand.Rand
+	mtx sync.Mutex
+}
+
+// Creates a fault injector whose random decisions are derived from the
+// specified seed.  Using a fixed seed makes the sequence of injected faults
+// reproducible.
+func NewFaultInjector(seed int64) *FaultInjector {
+	return &FaultInjector{
+		rng: rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (fi *FaultInjector) roll(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+
+	fi.mtx.Lock()
+	defer fi.mtx.Unlock()
+
+	if fi.rng == nil {
+		fi.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return fi.rng.Float64() < rate
+}
+
+// Called before an outgoing write.  Applies the configured delay, then
+// indicates whether the write should be discarded (drop) or failed (err).
+// A nil injector injects nothing.
+func (fi *FaultInjector) BeforeWrite() (drop bool, err error) {
+	if fi == nil {
+		return false, nil
+	}
+
+	if fi.WriteDelay > 0 {
+		time.Sleep(fi.WriteDelay)
+	}
+
+	if fi.roll(fi.WriteErrRate) {
+		if fi.WriteErr != nil {
+			return false, fi.WriteErr
+		}
+		return false, fmt.Errorf("Injected write failure")
+	}
+
+	return fi.roll(fi.WriteDropRate), nil
+}
+
+// Indicates whether an incoming packet should be discarded.  A nil injector
+// never discards.
+func (fi *FaultInjector) DropRx() bool {
+	if fi == nil {
+		return false
+	}
+
+	return fi.roll(fi.RxDropRate)
+}
@@ -0,0 +1,121 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package nmxutil
+
+import (
+	"sync"
+	"time"
+)
+
+// Receives counters, gauges, and timers emitted by sessions.  This allows
+// the library to be wired into an external monitoring system (e.g.,
+// Prometheus or statsd).  Implementations must be safe for concurrent use,
+// and should not block.
+type MetricsSink interface {
+	// Adds `delta` to the named counter.
+	Count(name string, delta int64)
+
+	// Sets the named gauge to `value`.
+	Gauge(name string, value float64)
+
+	// Records a single observation of the named timer.
+	Timing(name string, d time.Duration)
+}
+
+// A MetricsSink that discards everything.
+type NopMetricsSink struct{}
+
+func (NopMetricsSink) Count(name string, delta int64)      {}
+func (NopMetricsSink) Gauge(name string, value float64)    {}
+func (NopMetricsSink) Timing(name string, d time.Duration) {}
+
+type goodputSample struct {
+	when  time.Time
+	bytes int
+}
+
+// Measures application-level throughput over a sliding window.  Callers
+// record only useful payload bytes, once per completed transfer, so
+// retransmissions and framing are excluded.  A nil *GoodputMeter records
+// nothing and always reports a rate of 0.
+type GoodputMeter struct {
+	window  time.Duration
+	samples []goodputSample
+	total   int
+	mtx     sync.Mutex
+}
+
+func NewGoodputMeter(window time.Duration) *GoodputMeter {
+	return &GoodputMeter{
+		window: window,
+	}
+}
+
+// Discards samples older than the window.  Must be called with the mutex
+// held.
+func (g *GoodputMeter) expire(now time.Time) {
+	i := 0
+	for i < len(g.samples) && now.Sub(g.samples[i].when) > g.window {
+		g.total -= g.samples[i].bytes
+		i++
+	}
+	g.samples = g.samples[i:]
+}
+
+// Records the completion of a transfer carrying `bytes` bytes of payload.
+func (g *GoodputMeter) Record(bytes int) {
+	if g == nil {
+		return
+	}
+
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	now := time.Now()
+	g.expire(now)
+	g.samples = append(g.samples, goodputSample{now, bytes})
+	g.total += bytes
+}
+
+// Retrieves the goodput, in bytes per second, averaged over the window.
+func (g *GoodputMeter) Rate() float64 {
+	if g == nil || g.window <= 0 {
+		return 0
+	}
+
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	g.expire(time.Now())
+	return float64(g.total) / g.window.Seconds()
+}
+
+// Discards all recorded samples.
+func (g *GoodputMeter) Reset() {
+	if g == nil {
+		return
+	}
+
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	g.samples = nil
+	g.total = 0
+}
@@ -109,6 +109,102 @@ func IsSesnClosed(err error) bool {
 	return ok
 }
 
+// Indicates that a session was paused (see nmble.NakedSesn.Pause()).  The
+// failed operation can be retried once the session is resumed.
+type SesnPausedError struct {
+	Text string
+}
+
+func NewSesnPausedError(text string) *SesnPausedError {
+	return &SesnPausedError{
+		Text: text,
+	}
+}
+
+func (e *SesnPausedError) Error() string {
+	return e.Text
+}
+
+func IsSesnPaused(err error) bool {
+	_, ok := err.(*SesnPausedError)
+	return ok
+}
+
+// Indicates that a session's transmit quota (sesn.SesnCfg.TxQuota) has been
+// used up.
+type QuotaExceededError struct {
+	Text string
+}
+
+func NewQuotaExceededError(text string) *QuotaExceededError {
+	return &QuotaExceededError{
+		Text: text,
+	}
+}
+
+func (e *QuotaExceededError) Error() string {
+	return e.Text
+}
+
+func IsQuotaExceeded(err error) bool {
+	_, ok := err.(*QuotaExceededError)
+	return ok
+}
+
+// Indicates that a write was larger than the link currently allows.  This
+// happens if the MTU shrinks between the time a request is sized and the
+// time it is sent.
+type MtuExceededError struct {
+	Attempted int
+	Limit     int
+
+	// Set if earlier fragments of the same packet were already written.
+	// The peer has received part of the packet, so it can't simply be
+	// re-chunked and resent.
+	Partial bool
+}
+
+func NewMtuExceededError(attempted int, limit int) *MtuExceededError {
+	return &MtuExceededError{
+		Attempted: attempted,
+		Limit:     limit,
+	}
+}
+
+func (e *MtuExceededError) Error() string {
+	return fmt.Sprintf("Write exceeds MTU; size=%d max-size=%d",
+		e.Attempted, e.Limit)
+}
+
+func IsMtuExceeded(err error) bool {
+	_, ok := err.(*MtuExceededError)
+	return ok
+}
+
+// Indicates that a response used a management protocol version other than
+// the one this library speaks.
+type ProtoMismatchError struct {
+	Detected int
+	Expected int
+}
+
+func NewProtoMismatchError(detected int, expected int) *ProtoMismatchError {
+	return &ProtoMismatchError{
+		Detected: detected,
+		Expected: expected,
+	}
+}
+
+func (e *ProtoMismatchError) Error() string {
+	return fmt.Sprintf("Management protocol version mismatch; "+
+		"detected=%d expected=%d", e.Detected, e.Expected)
+}
+
+func IsProtoMismatch(err error) bool {
+	_, ok := err.(*ProtoMismatchError)
+	return ok
+}
+
 type ScanTmoError struct {
 	Text string
 }
@@ -128,6 +224,67 @@ func IsScanTmo(err error) bool {
 	return ok
 }
 
+// Indicates that a BLE pairing procedure did not complete in time.
+type BleSecurityTmoError struct {
+	Text string
+}
+
+func NewBleSecurityTmoError(text string) *BleSecurityTmoError {
+	return &BleSecurityTmoError{
+		Text: text,
+	}
+}
+
+func (e *BleSecurityTmoError) Error() string {
+	return e.Text
+}
+
+func IsBleSecurityTmo(err error) bool {
+	_, ok := err.(*BleSecurityTmoError)
+	return ok
+}
+
+// Indicates that the peer never answered an ATT MTU exchange.
+type BleMtuExchangeTmoError struct {
+	Text string
+}
+
+func NewBleMtuExchangeTmoError(text string) *BleMtuExchangeTmoError {
+	return &BleMtuExchangeTmoError{
+		Text: text,
+	}
+}
+
+func (e *BleMtuExchangeTmoError) Error() string {
+	return e.Text
+}
+
+func IsBleMtuExchangeTmo(err error) bool {
+	_, ok := err.(*BleMtuExchangeTmoError)
+	return ok
+}
+
+// Indicates that the BLE controller can't perform the requested procedure
+// alongside its current activity (e.g., scanning while connected).
+type BleCapabilityError struct {
+	Text string
+}
+
+func NewBleCapabilityError(text string) *BleCapabilityError {
+	return &BleCapabilityError{
+		Text: text,
+	}
+}
+
+func (e *BleCapabilityError) Error() string {
+	return e.Text
+}
+
+func IsBleCapability(err error) bool {
+	_, ok := err.(*BleCapabilityError)
+	return ok
+}
+
 // Represents a low-level transport error.
 type XportError struct {
 	Text string
@@ -20,6 +20,7 @@
 package nmxutil
 
 import (
+	"encoding/binary"
 	"fmt"
 	"math"
 	"math/rand"
@@ -38,13 +39,27 @@ import (
 
 const DURATION_FOREVER time.Duration = math.MaxInt64
 
+// Length, in bytes, of tokens generated by NextReqToken() by default.
+const REQ_TOKEN_LEN = 4
+
+// Limits on CoAP token length (RFC 7252, 3).
+const COAP_TOKEN_LEN_MIN = 1
+const COAP_TOKEN_LEN_MAX = 8
+
+// Number of recently issued request tokens that a new token is checked
+// against, and the number of times a colliding token is regenerated.
+const REQ_TOKEN_HISTORY = 64
+const REQ_TOKEN_TRIES = 8
+
 var Debug bool
 var OmpRes string = "/omgr"
 
-var nextNmpSeq uint8
-var nmpSeqBeenRead bool
+var nmpSeqAllocator SeqAllocator
 var nextOicSeq uint8
 var oicSeqBeenRead bool
+var reqTokenGen TokenGenerator
+var recentReqTokens [REQ_TOKEN_HISTORY]string
+var recentReqTokenIdx int
 var seqMutex sync.Mutex
 
 var logFormatter = log.TextFormatter{
@@ -71,19 +86,50 @@ func Assert(cond bool) {
 	}
 }
 
+// Allocates NMP sequence numbers.  Calls are serialized, so implementations
+// do not need to be thread safe.
+type SeqAllocator interface {
+	NextSeq() uint8
+}
+
+// Allocates sequence numbers in increasing order, wrapping after 255.  This
+// is the default allocator; it starts at a random value.
+type MonotonicSeqAllocator struct {
+	next uint8
+}
+
+func NewMonotonicSeqAllocator(first uint8) *MonotonicSeqAllocator {
+	return &MonotonicSeqAllocator{
+		next: first,
+	}
+}
+
+func (a *MonotonicSeqAllocator) NextSeq() uint8 {
+	val := a.next
+	a.next++
+
+	return val
+}
+
+// Replaces the allocator used for all subsequent NMP requests.  This is
+// useful for producing deterministic wire traces.  Passing nil restores the
+// default allocator.
+func SetNmpSeqAllocator(a SeqAllocator) {
+	seqMutex.Lock()
+	defer seqMutex.Unlock()
+
+	nmpSeqAllocator = a
+}
+
 func NextNmpSeq() uint8 {
 	seqMutex.Lock()
 	defer seqMutex.Unlock()
 
-	if !nmpSeqBeenRead {
-		nextNmpSeq = uint8(rand.Uint32())
-		nmpSeqBeenRead = true
+	if nmpSeqAllocator == nil {
+		nmpSeqAllocator = NewMonotonicSeqAllocator(uint8(rand.Uint32()))
 	}
 
-	val := nextNmpSeq
-	nextNmpSeq++
-
-	return val
+	return nmpSeqAllocator.NextSeq()
 }
 
 func SeqToToken(seq uint8) []byte {
@@ -105,6 +151,117 @@ func NextToken() []byte {
 	return token
 }
 
+// Generates tokens for CoAP resource requests.  Calls are serialized, so
+// implementations do not need to be thread safe.  Each token must be
+// between COAP_TOKEN_LEN_MIN and COAP_TOKEN_LEN_MAX bytes long.
+type TokenGenerator interface {
+	NextToken() []byte
+}
+
+// Generates fixed-length tokens from an incrementing big-endian counter.
+// This is the default generator; it starts at a random value.
+type CounterTokenGenerator struct {
+	len  int
+	next uint64
+}
+
+func NewCounterTokenGenerator(length int,
+	first uint64) (*CounterTokenGenerator, error) {
+
+	if length < COAP_TOKEN_LEN_MIN || length > COAP_TOKEN_LEN_MAX {
+		return nil, fmt.Errorf("invalid CoAP token length: %d; must be "+
+			"in the range [%d, %d]", length, COAP_TOKEN_LEN_MIN,
+			COAP_TOKEN_LEN_MAX)
+	}
+
+	return &CounterTokenGenerator{
+		len:  length,
+		next: first,
+	}, nil
+}
+
+func (g *CounterTokenGenerator) NextToken() []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], g.next)
+	g.next++
+
+	token := make([]byte, g.len)
+	copy(token, b[8-g.len:])
+	return token
+}
+
+// Replaces the generator used for all subsequent CoAP request tokens.
+// Passing nil restores the default generator.
+func SetReqTokenGenerator(g TokenGenerator) {
+	seqMutex.Lock()
+	defer seqMutex.Unlock()
+
+	reqTokenGen = g
+}
+
+// Configures the default generator to produce tokens of the specified
+// length.  Short tokens wrap quickly; a one-byte token space is exhausted
+// by 256 requests.
+func SetReqTokenLen(length int) error {
+	g, err := NewCounterTokenGenerator(length, rand.Uint64())
+	if err != nil {
+		return err
+	}
+
+	SetReqTokenGenerator(g)
+	return nil
+}
+
+func reqTokenRecent(key string) bool {
+	for _, t := range recentReqTokens {
+		if t == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Generates a token for a CoAP resource request.  The default tokens are
+// longer than the single-byte tokens derived from NMP sequence numbers, so
+// the two never collide.  A token that matches one of the last
+// REQ_TOKEN_HISTORY tokens issued is regenerated, so a custom generator
+// with a small token space cannot hand out a token that is likely still in
+// use.  A generator that produces an invalid token is replaced with the
+// default.
+func NextReqToken() []byte {
+	seqMutex.Lock()
+	defer seqMutex.Unlock()
+
+	if reqTokenGen == nil {
+		reqTokenGen, _ = NewCounterTokenGenerator(REQ_TOKEN_LEN,
+			uint64(rand.Uint32()))
+	}
+
+	var token []byte
+	for i := 0; i < REQ_TOKEN_TRIES; i++ {
+		token = reqTokenGen.NextToken()
+		if len(token) < COAP_TOKEN_LEN_MIN ||
+			len(token) > COAP_TOKEN_LEN_MAX {
+
+			log.Warnf("CoAP token generator produced invalid token "+
+				"(len=%d); reverting to default generator", len(token))
+			reqTokenGen, _ = NewCounterTokenGenerator(REQ_TOKEN_LEN,
+				uint64(rand.Uint32()))
+			token = reqTokenGen.NextToken()
+		}
+
+		if !reqTokenRecent(string(token)) {
+			break
+		}
+		log.Debugf("discarding recently used CoAP token: %x", token)
+	}
+
+	recentReqTokens[recentReqTokenIdx] = string(token)
+	recentReqTokenIdx = (recentReqTokenIdx + 1) % REQ_TOKEN_HISTORY
+
+	return token
+}
+
 func DecodeCborMap(cbor []byte) (map[string]interface{}, error) {
 	m := map[string]interface{}{}
 
@@ -155,7 +312,14 @@ func StopAndDrainTimer(timer *time.Timer) {
 	}
 }
 
-func Fragment(b []byte, mtu int) [][]byte {
+// Splits a packet into chunks of at most mtu bytes.  A non-positive MTU is
+// rejected; no number of such chunks could carry the packet.
+func Fragment(b []byte, mtu int) ([][]byte, error) {
+	if mtu <= 0 {
+		return nil, fmt.Errorf("Cannot fragment packet; invalid MTU: %d",
+			mtu)
+	}
+
 	frags := [][]byte{}
 
 	for off := 0; off < len(b); off += mtu {
@@ -167,7 +331,7 @@ func Fragment(b []byte, mtu int) [][]byte {
 		frags = append(frags, frag)
 	}
 
-	return frags
+	return frags, nil
 }
 
 var nextId uint32
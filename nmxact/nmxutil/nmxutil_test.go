@@ -0,0 +1,46 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package nmxutil
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFragment(t *testing.T) {
+	b := []byte("0123456789")
+
+	frags, err := Fragment(b, 4)
+	if err != nil {
+		t.Fatalf("Fragment: %s", err.Error())
+	}
+	if len(frags) != 3 {
+		t.Fatalf("unexpected fragment count: %d", len(frags))
+	}
+	if !bytes.Equal(bytes.Join(frags, nil), b) {
+		t.Fatalf("fragments do not reassemble to the original packet")
+	}
+
+	for _, mtu := range []int{0, -1} {
+		if _, err := Fragment(b, mtu); err == nil {
+			t.Fatalf("Fragment accepted MTU %d", mtu)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package nmxutil
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Limits the number of bytes a session may transmit.  Once the limit is
+// reached, further writes fail with a QuotaExceededError until the quota is
+// reset.  A nil quota imposes no limit.
+type ByteQuota struct {
+	limit int64
+	used  int64
+	mtx   sync.Mutex
+}
+
+func NewByteQuota(limit int64) *ByteQuota {
+	return &ByteQuota{
+		limit: limit,
+	}
+}
+
+// Charges the specified number of bytes against the quota.  If the write
+// would exceed the limit, nothing is charged and an error is returned.
+func (q *ByteQuota) Consume(n int) error {
+	if q == nil {
+		return nil
+	}
+
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if q.used+int64(n) > q.limit {
+		return NewQuotaExceededError(fmt.Sprintf(
+			"Transmit quota exceeded; limit=%d used=%d write=%d",
+			q.limit, q.used, n))
+	}
+
+	q.used += int64(n)
+	return nil
+}
+
+// Retrieves the number of bytes charged since the quota was last reset.
+func (q *ByteQuota) Used() int64 {
+	if q == nil {
+		return 0
+	}
+
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	return q.used
+}
+
+func (q *ByteQuota) Limit() int64 {
+	if q == nil {
+		return 0
+	}
+
+	return q.limit
+}
+
+// Clears the number of bytes charged, allowing transmission to resume.
+func (q *ByteQuota) Reset() {
+	if q == nil {
+		return
+	}
+
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	q.used = 0
+}
@@ -43,6 +43,7 @@ type Dispatcher struct {
 	coapd          *nmcoap.Dispatcher
 	wg             sync.WaitGroup
 	rxFilter       nmcoap.MsgFilter
+	protoChecker   *nmp.ProtoChecker
 	stopped        bool
 	logDepth       int
 	mtx            sync.Mutex
@@ -97,7 +98,7 @@ func (d *Dispatcher) addOmpListener(seq uint8) (*Listener, error) {
 		for {
 			select {
 			case m := <-ompl.coapl.RspChan:
-				rsp, err := DecodeOmp(m, d.rxFilter)
+				rsp, err := DecodeOmp(m, d.rxFilter, d.protoChecker)
 				if err != nil {
 					ompl.nmpl.ErrChan <- err
 				} else if rsp != nil {
@@ -140,6 +141,10 @@ func (d *Dispatcher) Dispatch(data []byte) bool {
 	return d.coapd.Dispatch(data)
 }
 
+func (d *Dispatcher) SetCoapRxCb(cb func(msg coap.Message)) {
+	d.coapd.SetRxCb(cb)
+}
+
 func (d *Dispatcher) ProcessCoapReq(data []byte) (coap.Message, error) {
 	return d.coapd.ProcessCoapReq(data)
 }
@@ -199,6 +204,12 @@ func (d *Dispatcher) ErrorAll(err error) {
 	d.coapd.ErrorAll(err)
 }
 
+// Configures the checker that inspects the protocol version of incoming
+// responses.  This must be called before any requests are sent.
+func (d *Dispatcher) SetProtoChecker(pc *nmp.ProtoChecker) {
+	d.protoChecker = pc
+}
+
 func (d *Dispatcher) SetRxFilter(rxFilter nmcoap.MsgFilter) {
 	d.rxFilter = rxFilter
 }
@@ -44,7 +44,9 @@ type OicMsg struct {
  * codec.  So we need to decode the whole response, and then re-encode the
  * newtmgr response part.
  */
-func DecodeOmp(m coap.Message, rxFilterCb nmcoap.MsgFilter) (nmp.NmpRsp, error) {
+func DecodeOmp(m coap.Message, rxFilterCb nmcoap.MsgFilter,
+	pc *nmp.ProtoChecker) (nmp.NmpRsp, error) {
+
 	// Ignore non-responses.
 	if m.Code() == coap.GET || m.Code() == coap.PUT || m.Code() == coap.POST ||
 		m.Code() == coap.DELETE {
@@ -81,6 +83,9 @@ func DecodeOmp(m coap.Message, rxFilterCb nmcoap.MsgFilter) (nmp.NmpRsp, error)
 	if err != nil {
 		return nil, err
 	}
+	if err := pc.Check(hdr); err != nil {
+		return nil, err
+	}
 
 	rsp, err := nmp.DecodeRspBody(hdr, m.Payload())
 	if err != nil {
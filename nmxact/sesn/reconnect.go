@@ -0,0 +1,122 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package sesn
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Governs how a session retries a failed connect.  The delay before retry n
+// (1-based) is InitialDelay * Multiplier^(n-1), capped at MaxDelay, and then
+// randomized by up to +/- Jitter of its value.  The zero value retries
+// immediately, with the number of attempts determined elsewhere (e.g.,
+// SesnCfgBleCentral.ConnTries).
+type ReconnectPolicy struct {
+	InitialDelay time.Duration
+	MaxDelay     time.Duration // 0 means no cap.
+	Multiplier   float64       // 0 is treated as 1 (constant delay).
+	Jitter       float64       // Fraction of the delay; 0 to 1.
+
+	// Total number of connect attempts, including the first.  0 defers to
+	// the scalar setting of the session type (e.g., ConnTries).
+	MaxAttempts int
+}
+
+// Retries quickly and persistently; suitable for interactive use with a
+// nearby device.
+func AggressiveReconnect() ReconnectPolicy {
+	return ReconnectPolicy{
+		InitialDelay: 100 * time.Millisecond,
+		MaxDelay:     time.Second,
+		Multiplier:   1.5,
+		Jitter:       0.1,
+		MaxAttempts:  10,
+	}
+}
+
+// Backs off quickly to long delays; suitable for unattended use where the
+// device may be out of range for a while.
+func ConservativeReconnect() ReconnectPolicy {
+	return ReconnectPolicy{
+		InitialDelay: time.Second,
+		MaxDelay:     30 * time.Second,
+		Multiplier:   2,
+		Jitter:       0.25,
+		MaxAttempts:  8,
+	}
+}
+
+func (p *ReconnectPolicy) Validate() error {
+	if p.InitialDelay < 0 {
+		return fmt.Errorf("InitialDelay: %s; must not be negative",
+			p.InitialDelay)
+	}
+	if p.MaxDelay < 0 {
+		return fmt.Errorf("MaxDelay: %s; must not be negative", p.MaxDelay)
+	}
+	if p.Multiplier != 0 && p.Multiplier < 1 {
+		return fmt.Errorf("Multiplier: %f; must be 0 or at least 1",
+			p.Multiplier)
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return fmt.Errorf("Jitter: %f; must be between 0 and 1", p.Jitter)
+	}
+	if p.MaxAttempts < 0 {
+		return fmt.Errorf("MaxAttempts: %d; must not be negative",
+			p.MaxAttempts)
+	}
+
+	return nil
+}
+
+// Determines the total number of connect attempts permitted.  dflt is used
+// if the policy doesn't specify a limit.
+func (p *ReconnectPolicy) Attempts(dflt int) int {
+	if p.MaxAttempts != 0 {
+		return p.MaxAttempts
+	}
+	return dflt
+}
+
+// Calculates the delay to apply before the specified retry (1-based).
+func (p *ReconnectPolicy) Delay(retry int) time.Duration {
+	if p.InitialDelay == 0 || retry < 1 {
+		return 0
+	}
+
+	mult := p.Multiplier
+	if mult == 0 {
+		mult = 1
+	}
+
+	d := float64(p.InitialDelay) * math.Pow(mult, float64(retry-1))
+	if p.MaxDelay != 0 && d > float64(p.MaxDelay) {
+		d = float64(p.MaxDelay)
+	}
+
+	if p.Jitter != 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+
+	return time.Duration(d)
+}
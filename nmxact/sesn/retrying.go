@@ -0,0 +1,173 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package sesn
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+	"mynewt.apache.org/newtmgr/nmxact/nmxutil"
+)
+
+// Indicates whether a management request can be resent without changing
+// its effect on the device.
+type IdempotentFn func(m *nmp.NmpMsg) bool
+
+// Treats read requests (e.g., stat read, image state read, config read) as
+// idempotent and everything else (e.g., upload, reset, config write) as not.
+func DfltIdempotent(m *nmp.NmpMsg) bool {
+	return m.Hdr.Op == nmp.NMP_OP_READ
+}
+
+// Treats response timeouts and transient BLE host errors as worth retrying.
+// Errors indicating that the session is unusable (e.g., closed), or that
+// the request can never succeed as is (e.g., MTU exceeded), are not.
+func DfltRetryable(err error) bool {
+	return nmxutil.IsRspTimeout(err) || nmxutil.IsBleHost(err)
+}
+
+// Wraps a session, transparently retrying idempotent management requests
+// that fail with a transient error.  All attempts of a request, and the
+// delays between them, share the request's timeout.  Requests that are not
+// idempotent are sent exactly once.  All other operations pass through to the
+// wrapped session.  Only the Sesn interface is exposed; optional interfaces of the
+// wrapped session (e.g., TxStatsSesn) are not.
+type RetryingSesn struct {
+	Sesn
+
+	// Number of retries after the first attempt.
+	Retries int
+
+	// Delay before each retry.  Only the delay fields are used; the number
+	// of retries is determined by Retries.
+	Backoff ReconnectPolicy
+
+	// Optional; overrides DfltIdempotent.
+	Idempotent IdempotentFn
+
+	// Optional; overrides DfltRetryable.
+	Retryable func(err error) bool
+
+	// Requests in progress, indexed by sequence number; closed by AbortRx().
+	// Protected by mtx.
+	abortChs map[uint8]chan struct{}
+	mtx      sync.Mutex
+}
+
+func NewRetryingSesn(s Sesn, retries int) *RetryingSesn {
+	return &RetryingSesn{
+		Sesn:    s,
+		Retries: retries,
+		Backoff: ReconnectPolicy{
+			InitialDelay: 100 * time.Millisecond,
+			MaxDelay:     2 * time.Second,
+			Multiplier:   2,
+			Jitter:       0.1,
+		},
+	}
+}
+
+func (s *RetryingSesn) TxRxMgmt(m *nmp.NmpMsg,
+	timeout time.Duration) (nmp.NmpRsp, error) {
+
+	idempotent := s.Idempotent
+	if idempotent == nil {
+		idempotent = DfltIdempotent
+	}
+	retryable := s.Retryable
+	if retryable == nil {
+		retryable = DfltRetryable
+	}
+
+	if !idempotent(m) {
+		return s.Sesn.TxRxMgmt(m, timeout)
+	}
+
+	abortCh := s.addAbortCh(m.Hdr.Seq)
+	defer s.removeAbortCh(m.Hdr.Seq, abortCh)
+
+	start := time.Now()
+	attemptTmo := timeout
+	for retry := 1; ; retry++ {
+		rsp, err := s.Sesn.TxRxMgmt(m, attemptTmo)
+		if err == nil || retry > s.Retries || !retryable(err) {
+			return rsp, err
+		}
+
+		// Don't retry if the attempt would not start before the request's
+		// time is up.
+		d := s.Backoff.Delay(retry)
+		if time.Since(start)+d >= timeout {
+			return rsp, err
+		}
+
+		log.Debugf("Idempotent NMP request %d:%d failed (%s); retry %d "+
+			"in %s", m.Hdr.Group, m.Hdr.Id, err.Error(), retry, d)
+
+		select {
+		case <-abortCh:
+			return nil, fmt.Errorf("rx aborted")
+		case <-time.After(d):
+		}
+
+		attemptTmo = timeout - time.Since(start)
+		if attemptTmo <= 0 {
+			return rsp, err
+		}
+	}
+}
+
+// Stops a receive operation in progress, including a retry that is waiting
+// for its delay to elapse.
+func (s *RetryingSesn) AbortRx(nmpSeq uint8) error {
+	s.mtx.Lock()
+	if ch := s.abortChs[nmpSeq]; ch != nil {
+		close(ch)
+		delete(s.abortChs, nmpSeq)
+	}
+	s.mtx.Unlock()
+
+	return s.Sesn.AbortRx(nmpSeq)
+}
+
+func (s *RetryingSesn) addAbortCh(seq uint8) chan struct{} {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.abortChs == nil {
+		s.abortChs = map[uint8]chan struct{}{}
+	}
+	ch := make(chan struct{})
+	s.abortChs[seq] = ch
+	return ch
+}
+
+func (s *RetryingSesn) removeAbortCh(seq uint8, ch chan struct{}) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.abortChs[seq] == ch {
+		delete(s.abortChs, seq)
+	}
+}
@@ -0,0 +1,186 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package sesn
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+	"mynewt.apache.org/newtmgr/nmxact/nmxutil"
+)
+
+// A session whose first `fails` requests fail with `err`.  Only the methods
+// used by RetryingSesn are implemented.
+type failingSesn struct {
+	Sesn
+
+	fails int
+	err   error
+
+	mtx       sync.Mutex
+	attempts  int
+	timeouts  []time.Duration
+	abortSeqs []uint8
+}
+
+func (s *failingSesn) TxRxMgmt(m *nmp.NmpMsg,
+	timeout time.Duration) (nmp.NmpRsp, error) {
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.attempts++
+	s.timeouts = append(s.timeouts, timeout)
+	if s.attempts <= s.fails {
+		return nil, s.err
+	}
+	return &nmp.EchoRsp{}, nil
+}
+
+func (s *failingSesn) AbortRx(nmpSeq uint8) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.abortSeqs = append(s.abortSeqs, nmpSeq)
+	return nil
+}
+
+func (s *failingSesn) numAttempts() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.attempts
+}
+
+func newRetryingTestSesn(fs *failingSesn) *RetryingSesn {
+	s := NewRetryingSesn(fs, 3)
+	s.Backoff = ReconnectPolicy{InitialDelay: 10 * time.Millisecond}
+	return s
+}
+
+func testMsg(op uint8) *nmp.NmpMsg {
+	return &nmp.NmpMsg{
+		Hdr: nmp.NmpHdr{
+			Op:    op,
+			Group: nmp.NMP_GROUP_DEFAULT,
+			Id:    nmp.NMP_ID_DEF_ECHO,
+			Seq:   7,
+		},
+	}
+}
+
+func TestRetryingSesnIdempotent(t *testing.T) {
+	fs := &failingSesn{fails: 2, err: nmxutil.NewBleHostError(1, "busy")}
+	s := newRetryingTestSesn(fs)
+
+	if _, err := s.TxRxMgmt(testMsg(nmp.NMP_OP_READ), time.Second); err != nil {
+		t.Fatalf("TxRxMgmt: %s", err.Error())
+	}
+	if fs.attempts != 3 {
+		t.Fatalf("expected 3 attempts; got %d", fs.attempts)
+	}
+
+	// Each retry only gets the time left over from the previous attempts.
+	for i, tmo := range fs.timeouts {
+		if tmo > time.Second || (i > 0 && tmo >= fs.timeouts[i-1]) {
+			t.Fatalf("attempt %d timeout not reduced: %v", i+1, fs.timeouts)
+		}
+	}
+}
+
+func TestRetryingSesnNonIdempotent(t *testing.T) {
+	fs := &failingSesn{fails: 1, err: nmxutil.NewBleHostError(1, "busy")}
+	s := newRetryingTestSesn(fs)
+
+	if _, err := s.TxRxMgmt(testMsg(nmp.NMP_OP_WRITE), time.Second); err == nil {
+		t.Fatalf("non-idempotent request succeeded despite failure")
+	}
+	if fs.attempts != 1 {
+		t.Fatalf("non-idempotent request sent %d times", fs.attempts)
+	}
+}
+
+func TestRetryingSesnMtuExceeded(t *testing.T) {
+	fs := &failingSesn{fails: 1, err: nmxutil.NewMtuExceededError(300, 200)}
+	s := newRetryingTestSesn(fs)
+
+	_, err := s.TxRxMgmt(testMsg(nmp.NMP_OP_READ), time.Second)
+	if !nmxutil.IsMtuExceeded(err) {
+		t.Fatalf("expected MTU exceeded error; got %v", err)
+	}
+	if fs.attempts != 1 {
+		t.Fatalf("MTU exceeded request sent %d times", fs.attempts)
+	}
+}
+
+// Verifies that retries stop once the next one could not start before the
+// request's timeout.
+func TestRetryingSesnBudget(t *testing.T) {
+	fs := &failingSesn{fails: 100, err: nmxutil.NewBleHostError(1, "busy")}
+	s := newRetryingTestSesn(fs)
+	s.Retries = 100
+	s.Backoff = ReconnectPolicy{InitialDelay: 70 * time.Millisecond}
+
+	const timeout = 200 * time.Millisecond
+	start := time.Now()
+	if _, err := s.TxRxMgmt(testMsg(nmp.NMP_OP_READ), timeout); err == nil {
+		t.Fatalf("request succeeded despite failures")
+	}
+
+	if elapsed := time.Since(start); elapsed >= timeout {
+		t.Fatalf("retries ran past the timeout: %s", elapsed)
+	}
+	if fs.attempts != 3 {
+		t.Fatalf("expected 3 attempts; got %d", fs.attempts)
+	}
+}
+
+func TestRetryingSesnAbortDuringBackoff(t *testing.T) {
+	fs := &failingSesn{fails: 100, err: nmxutil.NewBleHostError(1, "busy")}
+	s := newRetryingTestSesn(fs)
+	s.Backoff = ReconnectPolicy{InitialDelay: 10 * time.Second}
+
+	m := testMsg(nmp.NMP_OP_READ)
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := s.TxRxMgmt(m, time.Minute)
+		errCh <- err
+	}()
+
+	for fs.numAttempts() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	s.AbortRx(m.Hdr.Seq)
+
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Fatalf("aborted request succeeded")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("abort did not interrupt the retry delay")
+	}
+
+	if fs.numAttempts() != 1 {
+		t.Fatalf("request resent after abort")
+	}
+}
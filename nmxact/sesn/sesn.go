@@ -26,6 +26,7 @@ import (
 
 	"mynewt.apache.org/newtmgr/nmxact/nmcoap"
 	"mynewt.apache.org/newtmgr/nmxact/nmp"
+	"mynewt.apache.org/newtmgr/nmxact/nmxutil"
 )
 
 var DfltTxOptions = TxOptions{
@@ -38,20 +39,143 @@ type NotifyCb func(msg coap.Message, err error)
 type TxOptions struct {
 	Timeout time.Duration
 	Tries   int
+
+	// Optional; the absolute time by which the entire operation must
+	// complete.  When several steps share a single deadline, each attempt's
+	// timeout is clamped to the time remaining.  Zero means no deadline.
+	Deadline time.Time
+
+	// Optional; controls retransmission of CoAP requests that are answered
+	// with a transient error code.  Nil means no such retries.
+	CoapRetry *CoapRetryPolicy
+}
+
+// Specifies which CoAP response codes cause a request to be retried, and how
+// long to wait between attempts.  The delay starts at Backoff and doubles
+// after each retry, up to MaxBackoff.  If the response carries a Max-Age
+// option, it is used as the delay instead (RFC 7252, 5.9.3.4).
+type CoapRetryPolicy struct {
+	Codes      []coap.COAPCode
+	MaxRetries int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// Retries on 5.00 (Internal Server Error) and 5.03 (Service Unavailable).
+func NewCoapRetryPolicy() *CoapRetryPolicy {
+	return &CoapRetryPolicy{
+		Codes: []coap.COAPCode{
+			coap.InternalServerError,
+			coap.ServiceUnavailable,
+		},
+		MaxRetries: 3,
+		Backoff:    250 * time.Millisecond,
+		MaxBackoff: 4 * time.Second,
+	}
+}
+
+func (p *CoapRetryPolicy) shouldRetry(code coap.COAPCode) bool {
+	for _, c := range p.Codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Calculates how long to wait before the specified retry (0-based).
+func (p *CoapRetryPolicy) delay(rsp coap.Message, retry int) time.Duration {
+	switch maxAge := rsp.Option(coap.MaxAge).(type) {
+	case uint32:
+		return time.Duration(maxAge) * time.Second
+	case int:
+		return time.Duration(maxAge) * time.Second
+	}
+
+	d := p.Backoff
+	for i := 0; i < retry; i++ {
+		d *= 2
+		if p.MaxBackoff != 0 && d >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+
+	return d
 }
 
 func NewTxOptions() TxOptions {
 	return DfltTxOptions
 }
 
+// Calculates the timeout to use for a single attempt, taking the deadline
+// into account.  A return value of 0 means no timeout.  An RspTimeoutError is
+// returned if the deadline has already passed.
+func (opt *TxOptions) AttemptTimeout() (time.Duration, error) {
+	if opt.Deadline.IsZero() {
+		return opt.Timeout, nil
+	}
+
+	rem := time.Until(opt.Deadline)
+	if rem <= 0 {
+		return 0, nmxutil.NewRspTimeoutError("Transaction deadline exceeded")
+	}
+
+	if opt.Timeout == 0 || rem < opt.Timeout {
+		return rem, nil
+	}
+
+	return opt.Timeout, nil
+}
+
 func (opt *TxOptions) AfterTimeout() <-chan time.Time {
-	if opt.Timeout == 0 {
+	timeout, err := opt.AttemptTimeout()
+	if err != nil {
+		// Deadline already passed; expire immediately.
+		return time.After(0)
+	}
+
+	if timeout == 0 {
 		return nil
 	} else {
-		return time.After(opt.Timeout)
+		return time.After(timeout)
 	}
 }
 
+// Describes the features a session supports.  Callers use this to adapt
+// their behavior to the transport without resorting to type assertions.
+type SesnCaps struct {
+	// Unsolicited CoAP notifications (observe) can be received.
+	Observe bool
+
+	// CoAP block-wise transfers (RFC 7959) are supported.
+	Blockwise bool
+
+	// The session can be reopened after the peer is lost.  Only meaningful
+	// for connection-oriented transports.
+	Reconnect bool
+
+	// Maximum data payload of a single outgoing packet.
+	MaxPayload int
+}
+
+// Describes how a request was transmitted.
+type TxStats struct {
+	// Number of transport writes (i.e., fragments).
+	Frags int
+
+	// Total bytes written, including NMP / OMP framing.
+	Bytes int
+}
+
+// Implemented by sessions that can report transmit statistics for management
+// requests.
+type TxStatsSesn interface {
+	// Like Sesn.TxRxMgmt(), but also reports how the request was
+	// transmitted.
+	TxRxMgmtEx(m *nmp.NmpMsg,
+		timeout time.Duration) (nmp.NmpRsp, TxStats, error)
+}
+
 // Represents a communication session with a specific peer.  The particulars
 // vary according to protocol and transport. Several Sesn instances can use the
 // same Xport.
@@ -87,6 +211,9 @@ type Sesn interface {
 	// Indicates whether the session uses the TCP form of CoAP.
 	CoapIsTcp() bool
 
+	// Describes the features supported by the session's transport.
+	Capabilities() SesnCaps
+
 	// Stops a receive operation in progress.  This must be called from a
 	// separate thread, as sesn receive operations are blocking.
 	AbortRx(nmpSeq uint8) error
@@ -20,13 +20,23 @@
 package sesn
 
 import (
+	"fmt"
 	"time"
 
 	"mynewt.apache.org/newtmgr/nmxact/bledefs"
 	"mynewt.apache.org/newtmgr/nmxact/lora"
 	"mynewt.apache.org/newtmgr/nmxact/nmcoap"
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+	"mynewt.apache.org/newtmgr/nmxact/nmxutil"
+	"mynewt.apache.org/newtmgr/nmxact/task"
 )
 
+// Default value of SesnCfg.TxvrLogDepth.
+const TXVR_LOG_DEPTH_DFLT = 3
+
+// Default value of SesnCfg.GoodputWindow.
+const GOODPUT_WINDOW_DFLT = 10 * time.Second
+
 type MgmtProto int
 
 const (
@@ -46,15 +56,46 @@ func (r MgmtProto) String() string {
 }
 
 type OnCloseFn func(s Sesn, err error)
+type LinkDegradedFn func(s Sesn, idle time.Duration)
+type SecurityDegradedFn func(s Sesn, err error)
+type OpenRetryFn func(attempt int, cause error)
 
 type PeerSpec struct {
 	Ble bledefs.BleDev
 	Udp string
+
+	// Optional; if set, the session scans for its peer rather than
+	// connecting to Ble directly.  The first advertiser that satisfies the
+	// predicate is connected to.  This is useful for devices that present
+	// several addresses (see bledefs.BleDevListPredicate).
+	BleMatch bledefs.BleAdvPredicate
+
+	// Optional; like BleMatch, but selects the peer by the contents of its
+	// advertisement (service data or manufacturer data).  If both are set,
+	// an advertiser must satisfy both.
+	BleAdv *bledefs.BleAdvCriteria
 }
 
 type SesnCfgBleCentral struct {
+	// The number of connect attempts and the duration of each.  Both are
+	// required; see SesnCfg.Validate().
 	ConnTries   int
 	ConnTimeout time.Duration
+
+	// Delays between connect attempts.  If the policy sets MaxAttempts, it
+	// takes precedence over ConnTries.
+	Retry ReconnectPolicy
+
+	// Optional; executed before each connect retry.  `attempt` is the
+	// 1-based number of the attempt that failed, and `cause` describes the
+	// failure.
+	RetryCb OpenRetryFn
+
+	// Optional; the connection supervision timeout to request.  Must be
+	// at most 32 s, in 10 ms steps, and must exceed twice the maximum
+	// connection interval (50 ms), so the smallest accepted value is
+	// 110 ms.  0 selects the host default (5.12 s).  The connection descriptor reports the value in effect.
+	SupervisionTimeout time.Duration
 	// XXX: Missing fields.
 }
 
@@ -65,6 +106,111 @@ type SesnCfgBle struct {
 	CloseTimeout time.Duration
 	WriteRsp     bool
 
+	// Per-role overrides of WriteRsp.  These apply to writes to the
+	// management request characteristic and the CoAP resource request
+	// characteristic respectively.
+	MgmtWriteType bledefs.BleWriteType
+	CoapWriteType bledefs.BleWriteType
+
+	// Disambiguates characteristics on peers that expose more than one with
+	// the same ID.  If several match, the session uses the first that has
+	// all of the specified properties.  IDs without an entry resolve to the
+	// first match.
+	ChrProps map[bledefs.BleChrId]bledefs.BleDiscChrProperties
+
+	// Selects the standard characteristic pair that carries CoAP resource
+	// requests and responses.  Defaults to BLE_RES_SEC_PUBLIC.
+	ResSecLevel bledefs.BleResSecLevel
+
+	// Optional; for peers with a custom GATT layout, these override the
+	// pair selected by ResSecLevel.  Both must be specified together.
+	ResReqChr *bledefs.BleChrId
+	ResRspChr *bledefs.BleChrId
+
+	// Optional; selects the management target on peers that expose more
+	// than one (e.g., one per core of a multi-core SoC).  Each target is a
+	// separate instance of the management service, identified by its
+	// service UUID; the characteristic UUIDs are the standard ones.  Nil
+	// selects the standard service.  See NakedSesn.MgmtTargets().
+	MgmtTarget *bledefs.BleUuid
+
+	// How long to wait for the pairing / encryption procedure to complete.
+	// 0 means use the default (15 s).
+	SecurityTimeout time.Duration
+
+	// DIAGNOSTICS ONLY; never set this in production.  Skips the
+	// encryption procedure that EncryptWhen=BLE_ENCRYPT_ALWAYS would
+	// perform on connect, so that a device can be reached before pairing
+	// is set up.  A warning is logged each time security is skipped.  This
+	// only affects the host side: the device still rejects unencrypted
+	// access to characteristics that require encryption.
+	ForceInsecure bool
+
+	// Optional; executed when EncryptWhen=BLE_ENCRYPT_PREFER and the peer
+	// rejects pairing, just before the session proceeds unencrypted.  The
+	// error describes the rejection.  A warning is logged regardless.
+	SecurityDegradedCb SecurityDegradedFn
+
+	// How long a closing session waits for its background Goroutines (e.g.,
+	// notification dispatch running a user callback) to terminate.  On
+	// expiry, the stuck Goroutines are logged and abandoned.  0 means wait
+	// indefinitely.
+	ShutdownTimeout time.Duration
+
+	// How long to wait for the peer to answer the ATT MTU exchange.  A
+	// timeout is reported as a BleMtuExchangeTmoError.  0 means use the
+	// default (5 s).
+	MtuExchangeTimeout time.Duration
+
+	// Optional; overrides BLE_ATT_ATTR_MAX_LEN as the upper bound on the
+	// size of a single outgoing write.  Writes are still limited by the
+	// ATT MTU, as long-write procedures are not supported by the host.  0
+	// means use the default.
+	MaxWriteLen int
+
+	// Whether to automatically rediscover the peer's services when it sends
+	// a GATT service changed indication.
+	RediscoverOnSvcChg bool
+
+	// Whether to disable the session's subscriptions on the peer before a
+	// graceful close.  This spares a bonded peer from notifying a host that
+	// has gone away, at the cost of extra latency during close.
+	UnsubscribeOnClose bool
+
+	// Whether to dispatch notifications from all characteristics through a
+	// single Goroutine, strictly in the order the host delivered them.  By
+	// default each characteristic is dispatched independently, so the
+	// relative order of NMP and CoAP responses is not defined.  Ordered
+	// dispatch makes this deterministic (e.g., for tests), but a slow
+	// dispatch on one characteristic delays all others, which may reduce
+	// throughput.
+	OrderedDispatch bool
+
+	// Optional; executed when a request has gone unanswered by the peer for
+	// longer than LinkDegradedWindow.  This is an early warning that the
+	// connection may be about to drop.
+	LinkDegradedCb     LinkDegradedFn
+	LinkDegradedWindow time.Duration
+
+	// Whether to record the time at which each phase of connection
+	// establishment completes.  See NakedSesn.ConnectTimeline().
+	EnableTiming bool
+
+	// Capacity of each lane of the session's task queue, and the number of
+	// jobs the queue may run concurrently.  More than one worker allows
+	// requests to be pipelined; closing, pausing, and rediscovery still run
+	// alone.  0 means use the default.
+	TaskQueueDepth   int
+	TaskQueueWorkers int
+
+	// If nonzero, an echo request is sent at this interval while the
+	// session is open, keeping the link busy (e.g., to prevent the peer
+	// from dropping an idle connection).  Each interval is randomized by up
+	// to +/- KeepaliveJitter (0 to 1) of its value, so that many sessions
+	// opened together do not transmit in lockstep.
+	KeepaliveItvl   time.Duration
+	KeepaliveJitter float64
+
 	// Central configuration.
 	Central SesnCfgBleCentral
 }
@@ -82,6 +228,12 @@ type SesnCfg struct {
 	PeerSpec  PeerSpec
 	OnCloseCb OnCloseFn
 
+	// Task queue priority of NMP requests, keyed by NMP group.  Requests in
+	// a high priority group are allowed to run ahead of queued normal
+	// priority requests (e.g., a stat read can be serviced between image
+	// upload chunks).  Groups not listed here have normal priority.
+	GroupPrios map[uint16]task.Prio
+
 	// Transport-specific configuration.
 	Ble  SesnCfgBle
 	Lora SesnCfgLora
@@ -89,6 +241,82 @@ type SesnCfg struct {
 	// Callbacks
 	TxFilterCb nmcoap.MsgFilter
 	RxFilterCb nmcoap.MsgFilter
+
+	// Optional; executed when an NMP response arrives that doesn't
+	// correspond to any outstanding request (e.g., an asynchronous event
+	// pushed by the device).  If nil, such messages are dropped.  Only
+	// supported by plain NMP sessions.  The callback runs in its own
+	// Goroutine, one message at a time, and may send requests on the
+	// session.
+	UnsolicitedCb func(r nmp.NmpRsp)
+
+	// If nonzero, a management request fails early when its response
+	// starts to arrive and then no further fragments are received for this
+	// long.  This distinguishes a stalled response from one that is merely
+	// slow.  The request's overall timeout still applies.
+	RxFragTimeout time.Duration
+
+	// Optional; executed when reassembly of an NMP response detects that a
+	// fragment was lost, i.e., the fragments received are inconsistent with
+	// the length in the response header.  The affected request still fails
+	// by timing out; this callback reports the loss as soon as it is
+	// detected.  Only applies to plain NMP.
+	FragGapCb nmp.FragGapFn
+
+	// Optional; executed when the first response with an unexpected
+	// management protocol version (see nmp.NMP_PROTO_VER) arrives.  There
+	// is no version handshake, so a mismatch is detected from the device's
+	// first response rather than during open.  If ProtoStrict is set, such
+	// responses fail their requests with an nmxutil.ProtoMismatchError;
+	// otherwise they are decoded as if they used the expected version.
+	ProtoMismatchCb nmp.ProtoMismatchFn
+	ProtoStrict     bool
+
+	// Number of stack frames skipped when the transceiver's dispatchers log
+	// the addition and removal of response listeners (see
+	// nmxutil.ListenLog).  This selects which caller the debug log
+	// attributes each listener to; it does not create workers, and has no
+	// effect on dispatch order or memory use.  Increase it if the session
+	// is wrapped by additional layers that obscure the caller of interest.
+	// Defaults to TXVR_LOG_DEPTH_DFLT.
+	TxvrLogDepth int
+
+	// Optional; receives the session's metrics (connects, retries, bytes
+	// transferred, request latencies, etc.).  If nil, metrics are discarded.
+	MetricsSink nmxutil.MetricsSink
+
+	// Length of the sliding window over which the session's goodput is
+	// averaged.  Goodput counts only the NMP payload of requests that
+	// completed successfully, plus their responses; headers, fragmentation
+	// overhead, and failed attempts are excluded.  Zero disables the
+	// measurement.  Currently only used by BLE sessions.  Defaults to
+	// GOODPUT_WINDOW_DFLT.
+	GoodputWindow time.Duration
+
+	// Optional; simulates a lossy or slow link.  For testing only.
+	FaultInjector *nmxutil.FaultInjector
+
+	// Optional; if nonzero, the maximum number of bytes the session may
+	// transmit.  Framing is included: the count covers everything handed
+	// to the transport, plus per-write link-layer headers where the
+	// session knows them (e.g., the ATT write header).  Once the quota is
+	// used up, writes fail with an nmxutil.QuotaExceededError until the
+	// session's ResetQuota() is called.  The quota spans reconnects.
+	// Currently used by BLE and UDP sessions.
+	TxQuota int64
+
+	// Optional; executed when a job on the session's task queue starts and
+	// finishes.  Jobs are labeled by operation (e.g., "nmp 1:0" for a
+	// request in group 1 with ID 0).  Currently only used by BLE sessions.
+	OnTaskStart task.StartFn
+	OnTaskEnd   task.EndFn
+
+	// Optional; if nonzero, a warning is logged when a single task-queue
+	// job runs for longer than this.  If TaskWatchdogAbort is also set, the
+	// session is closed, failing the stuck operation if it is waiting for a
+	// response.  Currently only used by BLE sessions.
+	TaskWatchdog      time.Duration
+	TaskWatchdogAbort bool
 }
 
 func NewSesnCfg() SesnCfg {
@@ -97,9 +325,15 @@ func NewSesnCfg() SesnCfg {
 		// future, there will need to be some global default, or something that
 		// gets read from blehostd.
 		Ble: SesnCfgBle{
-			OwnAddrType:  bledefs.BLE_ADDR_TYPE_RANDOM,
-			CloseTimeout: 30 * time.Second,
-			WriteRsp:     false,
+			OwnAddrType:        bledefs.BLE_ADDR_TYPE_RANDOM,
+			CloseTimeout:       30 * time.Second,
+			WriteRsp:           false,
+			SecurityTimeout:    15 * time.Second,
+			MtuExchangeTimeout: 5 * time.Second,
+			ShutdownTimeout:    time.Minute,
+			LinkDegradedWindow: time.Second,
+			TaskQueueDepth:     10,
+			TaskQueueWorkers:   1,
 
 			Central: SesnCfgBleCentral{
 				ConnTries:   5,
@@ -110,5 +344,206 @@ func NewSesnCfg() SesnCfg {
 			ConfirmedTx: false,
 			Port:        lora.COAP_LORA_PORT,
 		},
+		TxvrLogDepth:  TXVR_LOG_DEPTH_DFLT,
+		GoodputWindow: GOODPUT_WINDOW_DFLT,
+	}
+}
+
+// Checks the configuration for invalid or conflicting settings.  The returned
+// error names the offending field.  A configuration produced by NewSesnCfg()
+// is valid once its peer is specified.  In a configuration built by hand,
+// numeric fields may be left at 0 (each field documents what 0 selects),
+// except for Ble.Central.ConnTries, Ble.Central.ConnTimeout, and, if
+// LinkDegradedCb is set, Ble.LinkDegradedWindow, which must be positive.
+func (c *SesnCfg) Validate() error {
+	if _, ok := mgmtProtoMap[c.MgmtProto]; !ok {
+		return fmt.Errorf("invalid SesnCfg.MgmtProto: %d", c.MgmtProto)
+	}
+
+	for group, prio := range c.GroupPrios {
+		if prio != task.PRIO_NORMAL && prio != task.PRIO_HIGH {
+			return fmt.Errorf("invalid SesnCfg.GroupPrios[%d]: %d", group, prio)
+		}
+	}
+
+	if c.TaskWatchdog < 0 {
+		return fmt.Errorf("invalid SesnCfg.TaskWatchdog: %s; "+
+			"must not be negative", c.TaskWatchdog)
+	}
+
+	if c.TxQuota < 0 {
+		return fmt.Errorf("invalid SesnCfg.TxQuota: %d; "+
+			"must not be negative", c.TxQuota)
+	}
+
+	if c.TxvrLogDepth < 0 {
+		return fmt.Errorf("invalid SesnCfg.TxvrLogDepth: %d; "+
+			"must not be negative", c.TxvrLogDepth)
+	}
+
+	if c.GoodputWindow < 0 {
+		return fmt.Errorf("invalid SesnCfg.GoodputWindow: %s; "+
+			"must not be negative", c.GoodputWindow)
 	}
+
+	if c.RxFragTimeout < 0 {
+		return fmt.Errorf("invalid SesnCfg.RxFragTimeout: %s; "+
+			"must not be negative", c.RxFragTimeout)
+	}
+
+	if _, ok := bledefs.BleAddrTypeStringMap[c.PeerSpec.Ble.AddrType]; !ok {
+		return fmt.Errorf("invalid SesnCfg.PeerSpec.Ble.AddrType: %d",
+			c.PeerSpec.Ble.AddrType)
+	}
+
+	if c.PeerSpec.Ble.Addr == (bledefs.BleAddr{}) &&
+		c.PeerSpec.BleMatch == nil && c.PeerSpec.BleAdv == nil {
+
+		return fmt.Errorf("invalid SesnCfg.PeerSpec: no peer specified; " +
+			"must set Ble.Addr, BleMatch, or BleAdv")
+	}
+
+	if a := c.PeerSpec.BleAdv; a != nil {
+		if a.SvcDataUuid == nil && len(a.MfgData) == 0 {
+			return fmt.Errorf("invalid SesnCfg.PeerSpec.BleAdv: no " +
+				"criteria specified")
+		}
+		if a.SvcDataUuid == nil && len(a.SvcData) > 0 {
+			return fmt.Errorf("invalid SesnCfg.PeerSpec.BleAdv.SvcData: " +
+				"must be accompanied by SvcDataUuid")
+		}
+	}
+
+	if _, ok := bledefs.BleAddrTypeStringMap[c.Ble.OwnAddrType]; !ok {
+		return fmt.Errorf("invalid SesnCfg.Ble.OwnAddrType: %d",
+			c.Ble.OwnAddrType)
+	}
+
+	switch c.Ble.EncryptWhen {
+	case bledefs.BLE_ENCRYPT_NEVER, bledefs.BLE_ENCRYPT_AS_REQD,
+		bledefs.BLE_ENCRYPT_ALWAYS, bledefs.BLE_ENCRYPT_PREFER:
+	default:
+		return fmt.Errorf("invalid SesnCfg.Ble.EncryptWhen: %d",
+			c.Ble.EncryptWhen)
+	}
+
+	for _, wt := range []struct {
+		name string
+		val  bledefs.BleWriteType
+	}{
+		{"MgmtWriteType", c.Ble.MgmtWriteType},
+		{"CoapWriteType", c.Ble.CoapWriteType},
+	} {
+		switch wt.val {
+		case bledefs.BLE_WRITE_TYPE_DFLT, bledefs.BLE_WRITE_TYPE_RSP,
+			bledefs.BLE_WRITE_TYPE_NO_RSP:
+		default:
+			return fmt.Errorf("invalid SesnCfg.Ble.%s: %d", wt.name, wt.val)
+		}
+	}
+
+	if c.Ble.CloseTimeout < 0 {
+		return fmt.Errorf("invalid SesnCfg.Ble.CloseTimeout: %s; "+
+			"must not be negative", c.Ble.CloseTimeout)
+	}
+
+	if c.Ble.MaxWriteLen < 0 {
+		return fmt.Errorf("invalid SesnCfg.Ble.MaxWriteLen: %d; "+
+			"must not be negative", c.Ble.MaxWriteLen)
+	}
+
+	if c.Ble.TaskQueueDepth < 0 {
+		return fmt.Errorf("invalid SesnCfg.Ble.TaskQueueDepth: %d; "+
+			"must not be negative", c.Ble.TaskQueueDepth)
+	}
+
+	if c.Ble.KeepaliveItvl < 0 {
+		return fmt.Errorf("invalid SesnCfg.Ble.KeepaliveItvl: %s; "+
+			"must not be negative", c.Ble.KeepaliveItvl)
+	}
+	if c.Ble.KeepaliveJitter < 0 || c.Ble.KeepaliveJitter > 1 {
+		return fmt.Errorf("invalid SesnCfg.Ble.KeepaliveJitter: %f; "+
+			"must be between 0 and 1", c.Ble.KeepaliveJitter)
+	}
+
+	if c.Ble.TaskQueueWorkers < 0 {
+		return fmt.Errorf("invalid SesnCfg.Ble.TaskQueueWorkers: %d; "+
+			"must not be negative", c.Ble.TaskQueueWorkers)
+	}
+
+	switch c.Ble.ResSecLevel {
+	case bledefs.BLE_RES_SEC_PUBLIC, bledefs.BLE_RES_SEC_UNAUTH,
+		bledefs.BLE_RES_SEC_SECURE:
+	default:
+		return fmt.Errorf("invalid SesnCfg.Ble.ResSecLevel: %d",
+			c.Ble.ResSecLevel)
+	}
+
+	if (c.Ble.ResReqChr == nil) != (c.Ble.ResRspChr == nil) {
+		return fmt.Errorf("invalid SesnCfg.Ble.ResReqChr / ResRspChr; " +
+			"must be specified together")
+	}
+
+	if c.Ble.SecurityTimeout < 0 {
+		return fmt.Errorf("invalid SesnCfg.Ble.SecurityTimeout: %s; "+
+			"must not be negative", c.Ble.SecurityTimeout)
+	}
+
+	if c.Ble.ShutdownTimeout < 0 {
+		return fmt.Errorf("invalid SesnCfg.Ble.ShutdownTimeout: %s; "+
+			"must not be negative", c.Ble.ShutdownTimeout)
+	}
+
+	if c.Ble.MtuExchangeTimeout < 0 {
+		return fmt.Errorf("invalid SesnCfg.Ble.MtuExchangeTimeout: %s; "+
+			"must not be negative", c.Ble.MtuExchangeTimeout)
+	}
+
+	if c.Ble.LinkDegradedCb != nil && c.Ble.LinkDegradedWindow <= 0 {
+		return fmt.Errorf("invalid SesnCfg.Ble.LinkDegradedWindow: %s; "+
+			"must be positive when LinkDegradedCb is set",
+			c.Ble.LinkDegradedWindow)
+	}
+
+	if err := c.Ble.Central.Retry.Validate(); err != nil {
+		return fmt.Errorf("invalid SesnCfg.Ble.Central.Retry.%s",
+			err.Error())
+	}
+
+	if c.Ble.Central.ConnTries < 1 {
+		return fmt.Errorf("invalid SesnCfg.Ble.Central.ConnTries: %d; "+
+			"must be at least 1", c.Ble.Central.ConnTries)
+	}
+
+	if c.Ble.Central.ConnTimeout <= 0 {
+		return fmt.Errorf("invalid SesnCfg.Ble.Central.ConnTimeout: %s; "+
+			"must be positive", c.Ble.Central.ConnTimeout)
+	}
+
+	// The timeout must also exceed a floor set by the connection parameters
+	// that every connect procedure requests.
+	if st := c.Ble.Central.SupervisionTimeout; st != 0 {
+		if st < bledefs.BLE_SUPERVISION_TMO_MIN ||
+			st > bledefs.BLE_SUPERVISION_TMO_MAX {
+
+			return fmt.Errorf("invalid SesnCfg.Ble.Central."+
+				"SupervisionTimeout: %s; must be 0 or between %s and %s",
+				st, bledefs.BLE_SUPERVISION_TMO_MIN,
+				bledefs.BLE_SUPERVISION_TMO_MAX)
+		}
+		if st%bledefs.BLE_SUPERVISION_TMO_UNIT != 0 {
+			return fmt.Errorf("invalid SesnCfg.Ble.Central."+
+				"SupervisionTimeout: %s; must be a multiple of %s",
+				st, bledefs.BLE_SUPERVISION_TMO_UNIT)
+		}
+
+		floor := bledefs.SupervisionTmoFloor(bledefs.BLE_CONN_ITVL_MAX_DFLT,
+			bledefs.BLE_CONN_LATENCY_DFLT)
+		if st <= floor {
+			return fmt.Errorf("invalid SesnCfg.Ble.Central."+
+				"SupervisionTimeout: %s; must exceed %s", st, floor)
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,79 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package sesn
+
+import (
+	"testing"
+	"time"
+
+	"mynewt.apache.org/newtmgr/nmxact/bledefs"
+)
+
+func newTestSesnCfg() SesnCfg {
+	cfg := NewSesnCfg()
+	cfg.PeerSpec.Ble.Addr = bledefs.BleAddr{Bytes: [6]byte{1, 2, 3, 4, 5, 6}}
+	return cfg
+}
+
+// Verifies that Validate() only accepts supervision timeouts that a connect
+// procedure can request.
+func TestSesnCfgSupervisionTimeout(t *testing.T) {
+	for _, tc := range []struct {
+		tmo time.Duration
+		ok  bool
+	}{
+		{0, true},
+		{bledefs.BLE_SUPERVISION_TMO_MIN, false},
+		{110 * time.Millisecond, true},
+		{115 * time.Millisecond, false},
+		{bledefs.BLE_SUPERVISION_TMO_MAX, true},
+		{bledefs.BLE_SUPERVISION_TMO_MAX + 10*time.Millisecond, false},
+	} {
+		cfg := newTestSesnCfg()
+		cfg.Ble.Central.SupervisionTimeout = tc.tmo
+
+		err := cfg.Validate()
+		if tc.ok && err != nil {
+			t.Fatalf("supervision timeout %s rejected: %s",
+				tc.tmo, err.Error())
+		}
+		if !tc.ok && err == nil {
+			t.Fatalf("supervision timeout %s accepted", tc.tmo)
+		}
+	}
+}
+
+// Verifies that a hand-built configuration only needs its peer and the
+// fields that Validate() documents as required.
+func TestSesnCfgZeroValue(t *testing.T) {
+	var cfg SesnCfg
+	cfg.PeerSpec.Ble.Addr = bledefs.BleAddr{Bytes: [6]byte{1, 2, 3, 4, 5, 6}}
+	cfg.Ble.Central.ConnTries = 1
+	cfg.Ble.Central.ConnTimeout = time.Second
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("zero-valued configuration rejected: %s", err.Error())
+	}
+
+	cfg.Ble.SecurityTimeout = -time.Second
+	if err := cfg.Validate(); err == nil {
+		t.Fatalf("negative security timeout accepted")
+	}
+}
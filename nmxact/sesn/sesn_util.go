@@ -20,9 +20,12 @@
 package sesn
 
 import (
+	"bytes"
+	"fmt"
 	"time"
 
 	"github.com/runtimeco/go-coap"
+	log "github.com/sirupsen/logrus"
 
 	"mynewt.apache.org/newtmgr/nmxact/nmcoap"
 	"mynewt.apache.org/newtmgr/nmxact/nmp"
@@ -34,7 +37,12 @@ import (
 func TxRxMgmt(s Sesn, m *nmp.NmpMsg, o TxOptions) (nmp.NmpRsp, error) {
 	retries := o.Tries - 1
 	for i := 0; ; i++ {
-		r, err := s.TxRxMgmt(m, o.Timeout)
+		timeout, err := o.AttemptTimeout()
+		if err != nil {
+			return nil, err
+		}
+
+		r, err := s.TxRxMgmt(m, timeout)
 		if err == nil {
 			return r, nil
 		}
@@ -45,6 +53,55 @@ func TxRxMgmt(s Sesn, m *nmp.NmpMsg, o TxOptions) (nmp.NmpRsp, error) {
 	}
 }
 
+// The outcome of a management request sent with TxRxMgmtEx().
+type TxResult struct {
+	Rsp nmp.NmpRsp
+
+	// Accumulated over all attempts.  Only valid if HaveStats is set.
+	Stats     TxStats
+	HaveStats bool
+
+	// Number of times the request was sent.
+	Attempts int
+}
+
+// TxRxMgmtEx is like TxRxMgmt(), but also reports how many fragments and
+// bytes the request produced.  Statistics are only available if the session
+// implements TxStatsSesn.  On failure, the partially populated result is
+// returned alongside the error.
+func TxRxMgmtEx(s Sesn, m *nmp.NmpMsg, o TxOptions) (*TxResult, error) {
+	res := &TxResult{}
+	ss, ok := s.(TxStatsSesn)
+	res.HaveStats = ok
+
+	retries := o.Tries - 1
+	for i := 0; ; i++ {
+		timeout, err := o.AttemptTimeout()
+		if err != nil {
+			return res, err
+		}
+
+		var r nmp.NmpRsp
+		res.Attempts++
+		if ok {
+			var stats TxStats
+			r, stats, err = ss.TxRxMgmtEx(m, timeout)
+			res.Stats.Frags += stats.Frags
+			res.Stats.Bytes += stats.Bytes
+		} else {
+			r, err = s.TxRxMgmt(m, timeout)
+		}
+		if err == nil {
+			res.Rsp = r
+			return res, nil
+		}
+
+		if !nmxutil.IsRspTimeout(err) || i >= retries {
+			return res, err
+		}
+	}
+}
+
 // TxCoap transmits a single CoAP message over the provided session.
 func TxCoap(s Sesn, mp nmcoap.MsgParams) error {
 	msg, err := nmcoap.CreateMsg(s.CoapIsTcp(), mp)
@@ -55,6 +112,52 @@ func TxCoap(s Sesn, mp nmcoap.MsgParams) error {
 	return s.TxCoap(msg)
 }
 
+// Builds the parameters for a CoAP request.  The request is assigned a token
+// that is unique among outstanding requests.
+func newCoapReq(code coap.COAPCode, uri string,
+	payload []byte) nmcoap.MsgParams {
+
+	mp := nmcoap.MsgParams{
+		Code:    code,
+		Uri:     uri,
+		Token:   nmxutil.NextReqToken(),
+		Payload: payload,
+	}
+
+	if payload != nil {
+		mp.Options = append(mp.Options, nmcoap.MsgOption{
+			Id:  coap.ContentFormat,
+			Val: nmcoap.MEDIA_TYPE_CBOR,
+		})
+	}
+
+	return mp
+}
+
+// NewCoapGet builds the parameters for a CoAP GET request of the specified
+// resource.
+func NewCoapGet(uri string) nmcoap.MsgParams {
+	return newCoapReq(coap.GET, uri, nil)
+}
+
+// NewCoapPut builds the parameters for a CoAP PUT request.  A non-nil payload
+// is marked as CBOR.
+func NewCoapPut(uri string, payload []byte) nmcoap.MsgParams {
+	return newCoapReq(coap.PUT, uri, payload)
+}
+
+// NewCoapPost builds the parameters for a CoAP POST request.  A non-nil
+// payload is marked as CBOR.
+func NewCoapPost(uri string, payload []byte) nmcoap.MsgParams {
+	return newCoapReq(coap.POST, uri, payload)
+}
+
+// NewCoapDelete builds the parameters for a CoAP DELETE request of the
+// specified resource.
+func NewCoapDelete(uri string) nmcoap.MsgParams {
+	return newCoapReq(coap.DELETE, uri, nil)
+}
+
 // RxCoap performs a blocking receive of a CoAP message.  It returns a nil
 // message if the specified listener is closed while the function is running.
 func RxCoap(cl *nmcoap.Listener, timeout time.Duration) (coap.Message, error) {
@@ -92,19 +195,39 @@ func TxRxCoap(s Sesn, mp nmcoap.MsgParams,
 	}
 	defer s.StopListenCoap(mc)
 
-	listenOnce := func() (coap.Message, error) {
-		return RxCoap(cl, opts.Timeout)
-	}
-
 	retries := opts.Tries - 1
+	codeRetries := 0
 	for i := 0; ; i++ {
+		timeout, err := opts.AttemptTimeout()
+		if err != nil {
+			return nil, err
+		}
+
 		if err := TxCoap(s, mp); err != nil {
 			return nil, err
 		}
 
-		rsp, err := listenOnce()
+		rsp, err := RxCoap(cl, timeout)
 		if err == nil {
-			return rsp, nil
+			p := opts.CoapRetry
+			if rsp == nil || p == nil || !p.shouldRetry(rsp.Code()) ||
+				codeRetries >= p.MaxRetries {
+
+				// Success, or out of retries; the caller inspects the
+				// final response code.
+				return rsp, nil
+			}
+
+			d := p.delay(rsp, codeRetries)
+			log.Debugf("CoAP request failed with code %s; retrying in %s",
+				rsp.Code().String(), d)
+			time.Sleep(d)
+
+			// Retries due to the response code don't count against the
+			// timeout retries.
+			codeRetries++
+			i--
+			continue
 		}
 
 		if !nmxutil.IsRspTimeout(err) || i >= retries {
@@ -112,3 +235,132 @@ func TxRxCoap(s Sesn, mp nmcoap.MsgParams,
 		}
 	}
 }
+
+// Controls Content-Format negotiation for a CoAP request.  The request is
+// first sent using Formats[0].  If the server answers 4.06 (Not Acceptable)
+// or 4.15 (Unsupported Content-Format), the request is resent using the
+// next format, until the list is exhausted.
+type CoapFormatPolicy struct {
+	// Formats to try, in order of preference.
+	Formats []coap.MediaType
+
+	// Optional; encodes the request payload in the specified format.  If
+	// nil, the payload of the request parameters is sent unchanged with
+	// each format.
+	Encode func(format coap.MediaType) ([]byte, error)
+}
+
+// Replaces the option with the specified ID, or appends it if absent.
+func setCoapOption(opts []nmcoap.MsgOption, id coap.OptionID,
+	val interface{}) []nmcoap.MsgOption {
+
+	out := make([]nmcoap.MsgOption, 0, len(opts)+1)
+	for _, o := range opts {
+		if o.Id != id {
+			out = append(out, o)
+		}
+	}
+
+	return append(out, nmcoap.MsgOption{Id: id, Val: val})
+}
+
+// TxRxCoapNegotiate sends a CoAP request, negotiating its format according
+// to the specified policy.  Each attempt carries an Accept option, and a
+// Content-Format option if it has a payload.  Each attempt is a separate
+// TxRxCoap() transaction with its own token.  Returns the final response and
+// the format it was requested with.
+func TxRxCoapNegotiate(s Sesn, mp nmcoap.MsgParams, opts TxOptions,
+	policy CoapFormatPolicy) (coap.Message, coap.MediaType, error) {
+
+	if len(policy.Formats) == 0 {
+		return nil, 0, fmt.Errorf("CoAP format policy specifies no formats")
+	}
+
+	var rsp coap.Message
+	var format coap.MediaType
+
+	for i, f := range policy.Formats {
+		format = f
+
+		amp := mp
+		amp.Token = nmxutil.NextReqToken()
+		if policy.Encode != nil {
+			payload, err := policy.Encode(f)
+			if err != nil {
+				return nil, f, err
+			}
+			amp.Payload = payload
+		}
+
+		amp.Options = setCoapOption(amp.Options, coap.Accept, f)
+		if amp.Payload != nil {
+			amp.Options = setCoapOption(amp.Options, coap.ContentFormat, f)
+		}
+
+		var err error
+		rsp, err = TxRxCoap(s, amp, opts)
+		if err != nil {
+			return nil, f, err
+		}
+
+		if rsp == nil || (rsp.Code() != coap.NotAcceptable &&
+			rsp.Code() != coap.UnsupportedMediaType) {
+
+			break
+		}
+
+		if i+1 < len(policy.Formats) {
+			log.Debugf("CoAP server rejected format %d (%s); retrying "+
+				"with format %d", f, rsp.Code().String(),
+				policy.Formats[i+1])
+		}
+	}
+
+	return rsp, format, nil
+}
+
+// TxRxCoapConditional sends a CoAP GET that is conditional on the resource
+// having changed since its cached response.  If the cache holds an ETag for
+// the request's URI, it is sent in an ETag option.  A 2.03 (Valid) reply
+// means the resource is unchanged: the cached response is returned and
+// notModified is true.  A 2.05 (Content) reply replaces the cache entry.
+// Requests other than GET are sent unconditionally.
+func TxRxCoapConditional(s Sesn, mp nmcoap.MsgParams, opts TxOptions,
+	cache *nmcoap.EtagCache) (coap.Message, bool, error) {
+
+	if mp.Code != coap.GET || cache == nil {
+		rsp, err := TxRxCoap(s, mp, opts)
+		return rsp, false, err
+	}
+
+	etag, cached, ok := cache.Lookup(mp.Uri)
+	if ok {
+		mp.Options = setCoapOption(mp.Options, coap.ETag, etag)
+	}
+
+	rsp, err := TxRxCoap(s, mp, opts)
+	if err != nil {
+		return nil, false, err
+	}
+	if rsp == nil {
+		return rsp, false, nil
+	}
+
+	switch rsp.Code() {
+	case coap.Valid:
+		if !ok {
+			return rsp, false, nil
+		}
+		if b := nmcoap.Etag(rsp); b != nil && !bytes.Equal(b, etag) {
+			// The server validated a representation we don't have.
+			cache.Remove(mp.Uri)
+			return rsp, false, nil
+		}
+		return cached, true, nil
+
+	case coap.Content:
+		cache.Store(mp.Uri, rsp)
+	}
+
+	return rsp, false, nil
+}
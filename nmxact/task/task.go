@@ -22,22 +22,65 @@ package task
 import (
 	"fmt"
 	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
 )
 
+// Task priority.  Each priority level is serviced by its own lane.
+type Prio int
+
+const (
+	PRIO_NORMAL Prio = iota
+	PRIO_HIGH
+)
+
+// The number of high priority tasks that may run back to back while normal
+// priority tasks are waiting.  After this many, one normal priority task is
+// allowed to run before the high priority lane is serviced again.
+const MAX_HIGH_PRIO_BURST = 4
+
 // A single action that runs in the main loop.
 type action struct {
-	fn func() error
-	ch chan error
+	fn    func() error
+	ch    chan error
+	label string
 }
 
+// Optional callbacks that observe job execution, e.g., for tracing.  Both
+// run in the worker, immediately before and after the job.  They must not
+// block.
+type StartFn func(label string)
+type EndFn func(label string, dur time.Duration, err error)
+
+// Executed when a job has been running for longer than the watchdog
+// threshold.  It runs in its own Goroutine while the job is still running.
+type WatchdogFn func(label string, elapsed time.Duration)
+
 // A queue for running jobs serially.
+//
+// Jobs are enqueued with a priority.  Unless the queue is started with more
+// than one worker, the queue never runs two jobs concurrently.  Within a
+// priority level, jobs start in the order they were enqueued.  A queued high
+// priority job runs before any queued normal priority job, with one
+// exception: to prevent starvation, a waiting normal priority job is
+// guaranteed to run after at most MAX_HIGH_PRIO_BURST consecutive high
+// priority jobs.  A job that is already running is never preempted.
 type TaskQueue struct {
 	actCh  chan action
+	hiCh   chan action
 	stopCh chan struct{}
 	active bool
 	name   string
-	mtx    sync.Mutex
-	wg     sync.WaitGroup
+
+	onStart StartFn
+	onEnd   EndFn
+
+	wdogTmo time.Duration
+	wdogCb  WatchdogFn
+
+	mtx sync.Mutex
+	wg  sync.WaitGroup
 }
 
 func NewTaskQueue(name string) TaskQueue {
@@ -51,16 +94,39 @@ var InactiveError = fmt.Errorf("inactive task queue")
 // Pushes the specified function onto the task queue.  When the job completes,
 // the result is sent over the returned channel
 func (q *TaskQueue) Enqueue(fn func() error) chan error {
+	return q.EnqueuePrio(PRIO_NORMAL, fn)
+}
+
+// Pushes the specified function onto the task queue with the given priority.
+// When the job completes, the result is sent over the returned channel
+func (q *TaskQueue) EnqueuePrio(prio Prio, fn func() error) chan error {
+	return q.EnqueueLabeled(prio, "", fn)
+}
+
+// Pushes the specified function onto the task queue with the given priority.
+// The label identifies the job to the start and end hooks; if empty, the
+// queue's name is used.  When the job completes, the result is sent over the
+// returned channel.
+func (q *TaskQueue) EnqueueLabeled(prio Prio, label string,
+	fn func() error) chan error {
+
 	q.mtx.Lock()
 	defer q.mtx.Unlock()
 
+	if label == "" {
+		label = q.name
+	}
+
 	act := action{
-		fn: fn,
-		ch: make(chan error, 1),
+		fn:    fn,
+		ch:    make(chan error, 1),
+		label: label,
 	}
 
 	if !q.active {
 		act.ch <- InactiveError
+	} else if prio == PRIO_HIGH {
+		q.hiCh <- act
 	} else {
 		q.actCh <- act
 	}
@@ -73,41 +139,174 @@ func (q *TaskQueue) Run(fn func() error) error {
 	return <-q.Enqueue(fn)
 }
 
-// Starts the task queue.  A task queue must be started before jobs can be
-// enqueued to it.
+// Enqueues the specified function with the given priority and waits for it
+// to complete.
+func (q *TaskQueue) RunPrio(prio Prio, fn func() error) error {
+	return <-q.EnqueuePrio(prio, fn)
+}
+
+// Enqueues the specified labeled function with the given priority and waits
+// for it to complete.
+func (q *TaskQueue) RunLabeled(prio Prio, label string, fn func() error) error {
+	return <-q.EnqueueLabeled(prio, label, fn)
+}
+
+// Configures the callbacks executed when a job starts and finishes.  Either
+// may be nil.  The hooks take effect the next time the queue is started.
+func (q *TaskQueue) SetHooks(onStart StartFn, onEnd EndFn) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	q.onStart = onStart
+	q.onEnd = onEnd
+}
+
+// Configures a watchdog that fires when a single job runs for longer than
+// `threshold`.  The watchdog logs a warning, including the job's label, and
+// then executes the callback, if any.  A threshold of 0 disables the
+// watchdog.  The setting takes effect the next time the queue is started.
+func (q *TaskQueue) SetWatchdog(threshold time.Duration, cb WatchdogFn) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	q.wdogTmo = threshold
+	q.wdogCb = cb
+}
+
+// Starts the task queue with a single worker.  A task queue must be started
+// before jobs can be enqueued to it.
 func (q *TaskQueue) Start(depth int) error {
+	return q.StartWorkers(depth, 1)
+}
+
+// Starts the task queue with the specified number of workers.  Each worker
+// runs one job at a time, so up to `workers` jobs can run concurrently.  Each
+// priority lane holds up to `depth` queued jobs.
+func (q *TaskQueue) StartWorkers(depth int, workers int) error {
 	q.mtx.Lock()
 	defer q.mtx.Unlock()
 
 	if q.active {
 		return fmt.Errorf("Task queue started twice \"%s\"", q.name)
 	}
+	if workers < 1 {
+		return fmt.Errorf("Invalid task queue worker count: %d", workers)
+	}
 	q.active = true
 
 	actCh := make(chan action, depth)
 	q.actCh = actCh
 
+	hiCh := make(chan action, depth)
+	q.hiCh = hiCh
+
 	stopCh := make(chan struct{})
 	q.stopCh = stopCh
 
-	q.wg.Add(1)
-	go func() {
+	onStart := q.onStart
+	onEnd := q.onEnd
+	wdogTmo := q.wdogTmo
+	wdogCb := q.wdogCb
+	name := q.name
+
+	run := func(act action) {
+		var start time.Time
+		if onStart != nil {
+			onStart(act.label)
+		}
+		if onEnd != nil {
+			start = time.Now()
+		}
+
+		if wdogTmo > 0 {
+			label := act.label
+			wdog := time.AfterFunc(wdogTmo, func() {
+				log.Warnf("Task queue \"%s\": job \"%s\" still running "+
+					"after %s", name, label, wdogTmo)
+				if wdogCb != nil {
+					wdogCb(label, wdogTmo)
+				}
+			})
+			defer wdog.Stop()
+		}
+
+		err := act.fn()
+
+		if onEnd != nil {
+			onEnd(act.label, time.Since(start), err)
+		}
+		act.ch <- err
+		close(act.ch)
+	}
+
+	worker := func() {
 		defer q.wg.Done()
 
+		// Number of consecutive high priority jobs run while normal priority
+		// jobs were waiting.
+		burst := 0
+
+		runHi := func(act action) {
+			run(act)
+			if len(actCh) > 0 {
+				burst++
+			} else {
+				burst = 0
+			}
+		}
+
 		for {
+			// Give a waiting normal priority job a turn if the high
+			// priority lane has been monopolizing the queue.
+			if burst >= MAX_HIGH_PRIO_BURST {
+				burst = 0
+				select {
+				case act, ok := <-actCh:
+					if ok {
+						run(act)
+					}
+					continue
+
+				default:
+				}
+			}
+
+			// Service the high priority lane first.
+			select {
+			case act, ok := <-hiCh:
+				if ok {
+					runHi(act)
+				}
+				continue
+
+			case <-stopCh:
+				return
+
+			default:
+			}
+
 			select {
+			case act, ok := <-hiCh:
+				if ok {
+					runHi(act)
+				}
+
 			case act, ok := <-actCh:
 				if ok {
-					err := act.fn()
-					act.ch <- err
-					close(act.ch)
+					burst = 0
+					run(act)
 				}
 
 			case <-stopCh:
 				return
 			}
 		}
-	}()
+	}
+
+	q.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go worker()
+	}
 
 	return nil
 }
@@ -142,16 +341,18 @@ func (q *TaskQueue) StopNoWait(cause error) error {
 	// Stop the task loop.
 	close(q.stopCh)
 
-	// Drain unprocessed actions from the action channel.
-	close(q.actCh)
-	for {
-		next, ok := <-q.actCh
-		if !ok {
-			break
-		}
+	// Drain unprocessed actions from the action channels.
+	for _, ch := range []chan action{q.hiCh, q.actCh} {
+		close(ch)
+		for {
+			next, ok := <-ch
+			if !ok {
+				break
+			}
 
-		next.ch <- cause
-		close(next.ch)
+			next.ch <- cause
+			close(next.ch)
+		}
 	}
 
 	q.active = false
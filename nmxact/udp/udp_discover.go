@@ -0,0 +1,132 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package udp
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/runtimeco/go-coap"
+	log "github.com/sirupsen/logrus"
+
+	"mynewt.apache.org/newtmgr/nmxact/nmcoap"
+	"mynewt.apache.org/newtmgr/nmxact/nmxutil"
+)
+
+// "All CoAP Nodes" multicast addresses (RFC 7252, section 12.8).  The IPv6
+// link-local address requires a zone (e.g., "[ff02::fd%eth0]:5683").
+const COAP_MCAST_ADDR_IPV4 = "224.0.1.187:5683"
+const COAP_MCAST_ADDR_IPV6 = "[ff02::fd]:5683"
+
+const COAP_DISCOVERY_PATH = ".well-known/core"
+
+// A CoAP endpoint that responded to a discovery request.
+type DiscoveredEndpoint struct {
+	Addr *net.UDPAddr
+
+	// Payload of the endpoint's response; a list of resources in CoRE link
+	// format.
+	Links []byte
+}
+
+// Discover sends a multicast GET of the /.well-known/core resource to the
+// specified group address and collects responses until the window expires.
+// Each responding endpoint is reported once, in the order its first response
+// arrived.
+func Discover(mcastAddr string, window time.Duration) (
+	[]DiscoveredEndpoint, error) {
+
+	addr, err := net.ResolveUDPAddr("udp", mcastAddr)
+	if err != nil {
+		return nil, fmt.Errorf("Failure resolving multicast address: %s",
+			err.Error())
+	}
+
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to listen for UDP responses: %s",
+			err.Error())
+	}
+	defer conn.Close()
+
+	// Multicast requests must be non-confirmable (RFC 7252, section 8.1).
+	token := nmxutil.NextReqToken()
+	m := coap.NewDgramMessage(coap.MessageParams{
+		Type:      coap.NonConfirmable,
+		Code:      coap.GET,
+		MessageID: nmcoap.NextMessageId(),
+		Token:     token,
+	})
+	m.SetPathString(COAP_DISCOVERY_PATH)
+
+	b, err := nmcoap.Encode(m)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.WriteToUDP(b, addr); err != nil {
+		return nil, fmt.Errorf("Failed to send discovery request: %s",
+			err.Error())
+	}
+
+	if err := conn.SetReadDeadline(time.Now().Add(window)); err != nil {
+		return nil, err
+	}
+
+	var eps []DiscoveredEndpoint
+	seen := map[string]struct{}{}
+
+	data := make([]byte, MAX_PACKET_SIZE)
+	for {
+		nr, srcAddr, err := conn.ReadFromUDP(data)
+		if err != nil {
+			if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+				// Discovery window expired.
+				return eps, nil
+			}
+			return nil, err
+		}
+
+		rsp, err := coap.ParseDgramMessage(data[:nr])
+		if err != nil {
+			log.Debugf("Discarding invalid CoAP response from %s: %s",
+				srcAddr.String(), err.Error())
+			continue
+		}
+
+		if !bytes.Equal(rsp.Token(), token) {
+			continue
+		}
+
+		key := srcAddr.String()
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		log.Debugf("Discovered CoAP endpoint: %s", key)
+		eps = append(eps, DiscoveredEndpoint{
+			Addr:  srcAddr,
+			Links: append([]byte(nil), rsp.Payload()...),
+		})
+	}
+}
@@ -39,6 +39,9 @@ type UdpSesn struct {
 	addr *net.UDPAddr
 	conn *net.UDPConn
 	txvr *mgmt.Transceiver
+
+	// Nil if the session has no transmit quota.
+	quota *nmxutil.ByteQuota
 }
 
 func NewUdpSesn(cfg sesn.SesnCfg) (*UdpSesn, error) {
@@ -46,11 +49,19 @@ func NewUdpSesn(cfg sesn.SesnCfg) (*UdpSesn, error) {
 		cfg: cfg,
 	}
 	txvr, err := mgmt.NewTransceiver(cfg.TxFilterCb, cfg.RxFilterCb, false,
-		cfg.MgmtProto, 3)
+		cfg.MgmtProto, cfg.TxvrLogDepth)
 	if err != nil {
 		return nil, err
 	}
 	s.txvr = txvr
+	s.txvr.SetUnsolicitedCb(cfg.UnsolicitedCb)
+	s.txvr.SetRxFragTimeout(cfg.RxFragTimeout)
+	s.txvr.SetFragGapCb(cfg.FragGapCb)
+	s.txvr.SetProtoMismatchCb(cfg.ProtoMismatchCb, cfg.ProtoStrict)
+
+	if cfg.TxQuota != 0 {
+		s.quota = nmxutil.NewByteQuota(cfg.TxQuota)
+	}
 
 	return s, nil
 }
@@ -63,7 +74,9 @@ func (s *UdpSesn) Open() error {
 
 	conn, addr, err := Listen(s.cfg.PeerSpec.Udp,
 		func(data []byte) {
-			s.txvr.DispatchNmpRsp(data)
+			if !s.cfg.FaultInjector.DropRx() {
+				s.txvr.DispatchNmpRsp(data)
+			}
 		})
 	if err != nil {
 		return err
@@ -104,6 +117,31 @@ func (s *UdpSesn) MtuOut() int {
 		nmp.NMP_HDR_SIZE
 }
 
+func (s *UdpSesn) txRaw(b []byte) error {
+	if err := s.quota.Consume(len(b)); err != nil {
+		return err
+	}
+
+	drop, err := s.cfg.FaultInjector.BeforeWrite()
+	if err != nil || drop {
+		return err
+	}
+
+	_, err = s.conn.WriteToUDP(b, s.addr)
+	return err
+}
+
+// Retrieves the number of datagram bytes charged against the transmit quota
+// since it was last reset.  Always 0 if the session has no quota.
+func (s *UdpSesn) QuotaUsed() int64 {
+	return s.quota.Used()
+}
+
+// Allows transmission to resume after the transmit quota is used up.
+func (s *UdpSesn) ResetQuota() {
+	s.quota.Reset()
+}
+
 func (s *UdpSesn) TxRxMgmt(m *nmp.NmpMsg,
 	timeout time.Duration) (nmp.NmpRsp, error) {
 
@@ -111,11 +149,18 @@ func (s *UdpSesn) TxRxMgmt(m *nmp.NmpMsg,
 		return nil, fmt.Errorf("Attempt to transmit over closed UDP session")
 	}
 
-	txRaw := func(b []byte) error {
-		_, err := s.conn.WriteToUDP(b, s.addr)
-		return err
+	return s.txvr.TxRxMgmt(s.txRaw, m, s.MtuOut(), timeout)
+}
+
+func (s *UdpSesn) TxRxMgmtEx(m *nmp.NmpMsg,
+	timeout time.Duration) (nmp.NmpRsp, sesn.TxStats, error) {
+
+	if !s.IsOpen() {
+		return nil, sesn.TxStats{},
+			fmt.Errorf("Attempt to transmit over closed UDP session")
 	}
-	return s.txvr.TxRxMgmt(txRaw, m, s.MtuOut(), timeout)
+
+	return s.txvr.TxRxMgmtEx(s.txRaw, m, s.MtuOut(), timeout)
 }
 
 func (s *UdpSesn) AbortRx(seq uint8) error {
@@ -124,12 +169,7 @@ func (s *UdpSesn) AbortRx(seq uint8) error {
 }
 
 func (s *UdpSesn) TxCoap(m coap.Message) error {
-	txRaw := func(b []byte) error {
-		_, err := s.conn.WriteToUDP(b, s.addr)
-		return err
-	}
-
-	return s.txvr.TxCoap(txRaw, m, s.MtuOut())
+	return s.txvr.TxCoap(s.txRaw, m, s.MtuOut())
 }
 
 func (s *UdpSesn) MgmtProto() sesn.MgmtProto {
@@ -148,6 +188,14 @@ func (s *UdpSesn) CoapIsTcp() bool {
 	return false
 }
 
+func (s *UdpSesn) Capabilities() sesn.SesnCaps {
+	return sesn.SesnCaps{
+		Observe:    true,
+		Reconnect:  false,
+		MaxPayload: s.MtuOut(),
+	}
+}
+
 func (s *UdpSesn) RxAccept() (sesn.Sesn, *sesn.SesnCfg, error) {
 	return nil, nil, fmt.Errorf("Op not implemented yet")
 }
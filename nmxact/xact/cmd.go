@@ -20,7 +20,9 @@
 package xact
 
 import (
+	"context"
 	"fmt"
+	"sync"
 
 	"mynewt.apache.org/newtmgr/nmxact/sesn"
 )
@@ -40,6 +42,11 @@ type Cmd interface {
 
 type CmdBase struct {
 	txOptions sesn.TxOptions
+	checkRc   bool
+
+	// Protects the fields below.  Abort() may be called from another
+	// Goroutine while the command is running.
+	mtx       sync.Mutex
 	curNmpSeq uint8
 	curSesn   sesn.Sesn
 	abortErr  error
@@ -59,13 +66,94 @@ func (c *CmdBase) SetTxOptions(opt sesn.TxOptions) {
 	c.txOptions = opt
 }
 
+// Indicates whether a nonzero return code in a response is reported as an
+// nmp.RcError rather than as a successful result.
+func (c *CmdBase) CheckRc() bool {
+	return c.checkRc
+}
+
+func (c *CmdBase) SetCheckRc(check bool) {
+	c.checkRc = check
+}
+
 func (c *CmdBase) Abort() error {
-	if c.curSesn != nil {
-		if err := c.curSesn.AbortRx(c.curNmpSeq); err != nil {
+	// Record the abort before cancelling the request in progress, so that a
+	// request starting concurrently either sees the abort or gets cancelled.
+	c.mtx.Lock()
+	c.abortErr = fmt.Errorf("Command aborted")
+	s := c.curSesn
+	seq := c.curNmpSeq
+	c.mtx.Unlock()
+
+	if s != nil {
+		if err := s.AbortRx(seq); err != nil {
 			return err
 		}
 	}
 
-	c.abortErr = fmt.Errorf("Command aborted")
 	return nil
 }
+
+// Returns the abort error if the command has been aborted, or nil.
+func (c *CmdBase) aborted() error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return c.abortErr
+}
+
+// Records the request in progress so that Abort() can cancel it.  Fails if
+// the command has already been aborted.
+func (c *CmdBase) beginReq(s sesn.Sesn, seq uint8) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.abortErr != nil {
+		return c.abortErr
+	}
+
+	c.curNmpSeq = seq
+	c.curSesn = s
+	return nil
+}
+
+func (c *CmdBase) endReq() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.curNmpSeq = 0
+	c.curSesn = nil
+}
+
+// RunContext executes the specified command, aborting it if the context is
+// cancelled or expires before the command completes.  Cancellation aborts
+// only the command; the session stays open and can be used for subsequent
+// commands.  A request that is being sent when the context is cancelled may
+// run to completion or to its timeout, but the command stops there.  If the
+// command fails due to cancellation, the context's error is returned.
+func RunContext(ctx context.Context, c Cmd, s sesn.Sesn) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Abort()
+		case <-done:
+		}
+	}()
+
+	res, err := c.Run(s)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+
+	return res, nil
+}
@@ -0,0 +1,63 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package xact
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+)
+
+// Verifies that cancelling the context of a multi-request command from
+// another Goroutine stops the command after the request in flight.  Run
+// with -race.
+func TestRunContextCancel(t *testing.T) {
+	s := newFakeSesn(256)
+
+	c := NewImageUploadCmd()
+	c.Data = fakeImage(2000)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s.rspFn = func(s *fakeSesn, m *nmp.NmpMsg) (nmp.NmpRsp, error) {
+		if len(s.sizes) == 2 {
+			// Cancel while the request is outstanding, and wait for the
+			// abort to reach the command.
+			cancel()
+			deadline := time.Now().Add(time.Second)
+			for c.aborted() == nil && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+		}
+		return ackUpload(m)
+	}
+
+	_, err := RunContext(ctx, c, s)
+	if err != context.Canceled {
+		t.Fatalf("expected context.Canceled; got %v", err)
+	}
+	if len(s.sizes) != 2 {
+		t.Fatalf("expected upload to stop after 2 requests; sent %d",
+			len(s.sizes))
+	}
+}
@@ -20,6 +20,8 @@
 package xact
 
 import (
+	"sort"
+
 	"mynewt.apache.org/newtmgr/nmxact/nmp"
 	"mynewt.apache.org/newtmgr/nmxact/sesn"
 )
@@ -111,3 +113,134 @@ func (c *ConfigWriteCmd) Run(s sesn.Sesn) (Result, error) {
 	res.Rsp = srsp
 	return res, nil
 }
+
+//////////////////////////////////////////////////////////////////////////////
+// $write batch                                                             //
+//////////////////////////////////////////////////////////////////////////////
+
+// Writes several config values.  The config group has no multi-key
+// transaction, so the writes happen one at a time, in key order.
+//
+// If Commit is set, the values are first written without saving; only if
+// every key is accepted are they written again with the save flag, which
+// persists them.  A key rejected in the first pass thus leaves the persisted
+// configuration untouched, and the device reverts to it on the next reboot;
+// the running values of keys written before the failure do change.  Only a
+// failure during the save pass can leave a partially persisted batch.
+//
+// If Commit is not set, the batch is best-effort: every key is attempted
+// regardless of earlier failures, and nothing is persisted.
+type ConfigWriteBatchCmd struct {
+	CmdBase
+	Vals   map[string]string
+	Commit bool
+}
+
+func NewConfigWriteBatchCmd() *ConfigWriteBatchCmd {
+	return &ConfigWriteBatchCmd{
+		CmdBase: NewCmdBase(),
+	}
+}
+
+type ConfigWriteBatchResult struct {
+	// Keys the device rejected, mapped to the return code.
+	Failed map[string]int
+
+	// Whether the values were persisted.
+	Committed bool
+}
+
+func newConfigWriteBatchResult() *ConfigWriteBatchResult {
+	return &ConfigWriteBatchResult{
+		Failed: map[string]int{},
+	}
+}
+
+// Returns the return code of the first rejected key, in key order, or 0 if
+// every key was accepted.
+func (r *ConfigWriteBatchResult) Status() int {
+	keys := make([]string, 0, len(r.Failed))
+	for k := range r.Failed {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	if len(keys) == 0 {
+		return nmp.NMP_ERR_OK
+	}
+	return r.Failed[keys[0]]
+}
+
+func (c *ConfigWriteBatchCmd) write(s sesn.Sesn, name string, val string,
+	save bool) (int, error) {
+
+	r := nmp.NewConfigWriteReq()
+	r.Name = name
+	r.Val = val
+	r.Save = save
+
+	rsp, err := txReq(s, r.Msg(), &c.CmdBase)
+	if err != nil {
+		return 0, err
+	}
+
+	return rsp.(*nmp.ConfigWriteRsp).Rc, nil
+}
+
+func (c *ConfigWriteBatchCmd) Run(s sesn.Sesn) (Result, error) {
+	keys := make([]string, 0, len(c.Vals))
+	for k := range c.Vals {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	res := newConfigWriteBatchResult()
+
+	for _, k := range keys {
+		rc, err := c.write(s, k, c.Vals[k], false)
+		if err != nil {
+			return nil, err
+		}
+		if rc != nmp.NMP_ERR_OK {
+			res.Failed[k] = rc
+			if c.Commit {
+				return res, nil
+			}
+		}
+	}
+
+	if !c.Commit {
+		return res, nil
+	}
+
+	for _, k := range keys {
+		rc, err := c.write(s, k, c.Vals[k], true)
+		if err != nil {
+			return nil, err
+		}
+		if rc != nmp.NMP_ERR_OK {
+			res.Failed[k] = rc
+			return res, nil
+		}
+	}
+
+	res.Committed = true
+	return res, nil
+}
+
+// Writes the specified config values.  This is a convenience wrapper around
+// ConfigWriteBatchCmd.
+func ConfigWriteBatch(s sesn.Sesn, vals map[string]string,
+	commit bool) (*ConfigWriteBatchResult, error) {
+
+	c := NewConfigWriteBatchCmd()
+	c.Vals = vals
+	c.Commit = commit
+
+	res, err := c.Run(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(*ConfigWriteBatchResult), nil
+}
@@ -0,0 +1,211 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package xact
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/runtimeco/go-coap"
+
+	"mynewt.apache.org/newtmgr/nmxact/image"
+	"mynewt.apache.org/newtmgr/nmxact/mgmt"
+	"mynewt.apache.org/newtmgr/nmxact/nmcoap"
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+	"mynewt.apache.org/newtmgr/nmxact/nmxutil"
+	"mynewt.apache.org/newtmgr/nmxact/sesn"
+)
+
+// A session that answers management requests in-process.  Each request is
+// encoded exactly as a real session would encode it, and rejected if it does
+// not fit the current MTU.
+type fakeSesn struct {
+	mtx sync.Mutex
+	mtu int
+
+	// Called before each request is encoded.  A non-nil error fails the
+	// request as if the transport had rejected it.
+	txHook func(s *fakeSesn, m *nmp.NmpMsg) error
+
+	// Produces the response to a request that fit the MTU.  If unset, image
+	// uploads are acknowledged in full and other requests fail.
+	rspFn func(s *fakeSesn, m *nmp.NmpMsg) (nmp.NmpRsp, error)
+
+	// Optional; called by Open().  A non-nil error fails the open.
+	openFn func() error
+
+	// Encoded size of each request that was sent, along with the MTU in
+	// effect at the time.
+	sizes []int
+	mtus  []int
+}
+
+func newFakeSesn(mtu int) *fakeSesn {
+	return &fakeSesn{
+		mtu: mtu,
+	}
+}
+
+func (s *fakeSesn) setMtu(mtu int) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.mtu = mtu
+}
+
+func (s *fakeSesn) Close() error    { return nil }
+func (s *fakeSesn) IsOpen() bool    { return true }
+func (s *fakeSesn) MtuIn() int      { return s.MtuOut() }
+func (s *fakeSesn) CoapIsTcp() bool { return false }
+
+func (s *fakeSesn) Open() error {
+	if s.openFn != nil {
+		return s.openFn()
+	}
+	return nil
+}
+
+func (s *fakeSesn) MtuOut() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.mtu
+}
+
+func (s *fakeSesn) MgmtProto() sesn.MgmtProto {
+	return sesn.MGMT_PROTO_NMP
+}
+
+func (s *fakeSesn) Capabilities() sesn.SesnCaps {
+	return sesn.SesnCaps{
+		MaxPayload: s.MtuOut(),
+	}
+}
+
+func (s *fakeSesn) AbortRx(nmpSeq uint8) error {
+	return nil
+}
+
+func (s *fakeSesn) RxAccept() (sesn.Sesn, *sesn.SesnCfg, error) {
+	return nil, nil, fmt.Errorf("unsupported")
+}
+
+func (s *fakeSesn) RxCoap(opt sesn.TxOptions) (coap.Message, error) {
+	return nil, fmt.Errorf("unsupported")
+}
+
+func (s *fakeSesn) TxRxMgmt(m *nmp.NmpMsg,
+	timeout time.Duration) (nmp.NmpRsp, error) {
+
+	if s.txHook != nil {
+		if err := s.txHook(s, m); err != nil {
+			return nil, err
+		}
+	}
+
+	b, err := mgmt.EncodeMgmt(s, m)
+	if err != nil {
+		return nil, err
+	}
+
+	mtu := s.MtuOut()
+	if len(b) > mtu {
+		return nil, nmxutil.NewMtuExceededError(len(b), mtu)
+	}
+
+	s.mtx.Lock()
+	s.sizes = append(s.sizes, len(b))
+	s.mtus = append(s.mtus, mtu)
+	s.mtx.Unlock()
+
+	if s.rspFn != nil {
+		return s.rspFn(s, m)
+	}
+	return ackUpload(m)
+}
+
+func (s *fakeSesn) ListenCoap(
+	mc nmcoap.MsgCriteria) (*nmcoap.Listener, error) {
+
+	return nil, fmt.Errorf("unsupported")
+}
+
+func (s *fakeSesn) StopListenCoap(mc nmcoap.MsgCriteria) {
+}
+
+func (s *fakeSesn) TxCoap(m coap.Message) error {
+	return fmt.Errorf("unsupported")
+}
+
+func (s *fakeSesn) Filters() (nmcoap.MsgFilter, nmcoap.MsgFilter) {
+	return nil, nil
+}
+
+func (s *fakeSesn) SetFilters(txFilter nmcoap.MsgFilter,
+	rxFilter nmcoap.MsgFilter) {
+}
+
+// Acknowledges the entirety of an image upload request.
+func ackUpload(m *nmp.NmpMsg) (nmp.NmpRsp, error) {
+	req, ok := m.Body.(*nmp.ImageUploadReq)
+	if !ok {
+		return nil, fmt.Errorf("unexpected request: %T", m.Body)
+	}
+
+	rsp := nmp.NewImageUploadRsp()
+	rsp.Hdr().Seq = m.Hdr.Seq
+	rsp.Off = req.Off + uint32(len(req.Data))
+	return rsp, nil
+}
+
+// Builds a version 2 image with a body of the specified size and a SHA256
+// TLV.
+func fakeImage(bodySz int) []byte {
+	hdr := make([]byte, image.IMAGE_HEADER_SIZE)
+	binary.LittleEndian.PutUint32(hdr[0:], image.IMAGE_MAGIC_V2)
+	binary.LittleEndian.PutUint16(hdr[8:], image.IMAGE_HEADER_SIZE)
+	binary.LittleEndian.PutUint32(hdr[12:], uint32(bodySz))
+
+	body := make([]byte, bodySz)
+	for i := range body {
+		body[i] = byte(i)
+	}
+
+	hash := sha256.Sum256(append(hdr, body...))
+
+	tlvTotLen := image.IMAGE_TRAILER_SIZE + image.IMAGE_TLV_HDR_SIZE +
+		image.IMAGE_HASH_LEN
+
+	var buf bytes.Buffer
+	buf.Write(hdr)
+	buf.Write(body)
+	binary.Write(&buf, binary.LittleEndian, uint16(image.IMAGE_TRAILER_MAGIC))
+	binary.Write(&buf, binary.LittleEndian, uint16(tlvTotLen))
+	buf.WriteByte(image.IMAGE_TLV_SHA256)
+	buf.WriteByte(0)
+	binary.Write(&buf, binary.LittleEndian, uint16(image.IMAGE_HASH_LEN))
+	buf.Write(hash[:])
+
+	return buf.Bytes()
+}
@@ -36,6 +36,12 @@ type FsDownloadCmd struct {
 	CmdBase
 	Name       string
 	ProgressCb FsDownloadProgressCb
+
+	// Restricts the download to a byte range of the file.  Length=0 means
+	// "through the end of the file".  Responses passed to the progress
+	// callback and recorded in the result are trimmed to the range.
+	Offset int
+	Length int
 }
 
 func NewFsDownloadCmd() *FsDownloadCmd {
@@ -57,10 +63,34 @@ func (r *FsDownloadResult) Status() int {
 	return rsp.Rc
 }
 
+// Ensures the requested range lies within a file of the specified size.
+func (c *FsDownloadCmd) checkRange(fileSz int) error {
+	if c.Offset > fileSz || c.Offset+c.Length > fileSz {
+		return fmt.Errorf("Invalid download range; off=%d len=%d "+
+			"file-size=%d", c.Offset, c.Length, fileSz)
+	}
+
+	return nil
+}
+
 func (c *FsDownloadCmd) Run(s sesn.Sesn) (Result, error) {
+	if c.Offset < 0 || c.Length < 0 {
+		return nil, fmt.Errorf("Invalid download range; off=%d len=%d",
+			c.Offset, c.Length)
+	}
+
 	res := newFsDownloadResult()
+
+	// The device only reports the file size in response to a read at
+	// offset 0.  If the range starts later, the first chunk is read anyway
+	// so that the range can be validated.
 	off := 0
 
+	end := 0
+	if c.Length > 0 {
+		end = c.Offset + c.Length
+	}
+
 	for {
 		r := nmp.NewFsDownloadReq()
 		r.Name = c.Name
@@ -71,22 +101,51 @@ func (c *FsDownloadCmd) Run(s sesn.Sesn) (Result, error) {
 			return nil, err
 		}
 		frsp := rsp.(*nmp.FsDownloadRsp)
-		res.Rsps = append(res.Rsps, frsp)
 
 		if frsp.Rc != 0 {
+			res.Rsps = append(res.Rsps, frsp)
 			break
 		}
 
-		if c.ProgressCb != nil {
-			c.ProgressCb(c, frsp)
+		if frsp.Off == 0 {
+			if err := c.checkRange(int(frsp.Len)); err != nil {
+				return nil, err
+			}
 		}
 
-		if len(frsp.Data) == 0 {
+		next := int(frsp.Off) + len(frsp.Data)
+		eof := len(frsp.Data) == 0
+
+		// Trim the chunk to the requested range.
+		if skip := c.Offset - int(frsp.Off); skip > 0 {
+			if skip > len(frsp.Data) {
+				skip = len(frsp.Data)
+			}
+			frsp.Data = frsp.Data[skip:]
+			frsp.Off += uint32(skip)
+		}
+		if end > 0 && int(frsp.Off)+len(frsp.Data) > end {
+			frsp.Data = frsp.Data[:end-int(frsp.Off)]
+		}
+
+		// Don't report a leading chunk that lies entirely before the range.
+		if len(frsp.Data) > 0 || eof {
+			res.Rsps = append(res.Rsps, frsp)
+			if c.ProgressCb != nil {
+				c.ProgressCb(c, frsp)
+			}
+		}
+
+		if eof || (end > 0 && next >= end) {
 			// Download complete.
 			break
 		}
 
-		off = int(frsp.Off) + len(frsp.Data)
+		if next < c.Offset {
+			// The first chunk ended before the range; skip ahead.
+			next = c.Offset
+		}
+		off = next
 	}
 
 	return res, nil
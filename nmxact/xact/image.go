@@ -20,11 +20,14 @@
 package xact
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"fmt"
+	"time"
 
 	pb "gopkg.in/cheggaaa/pb.v1"
 
+	"mynewt.apache.org/newtmgr/nmxact/image"
 	"mynewt.apache.org/newtmgr/nmxact/mgmt"
 	"mynewt.apache.org/newtmgr/nmxact/nmp"
 	"mynewt.apache.org/newtmgr/nmxact/nmxutil"
@@ -37,6 +40,26 @@ import (
 const IMAGE_UPLOAD_MAX_CHUNK = 512
 const IMAGE_UPLOAD_MIN_1ST_CHUNK = 32
 
+// Number of times a chunk is re-sized after the MTU shrinks before the
+// upload fails.
+const IMAGE_UPLOAD_MTU_RETRIES = 3
+
+// Weight given to the most recent chunk when smoothing the upload rate.
+const IMAGE_UPLOAD_RATE_ALPHA = 0.25
+
+// Describes the state of an image upload in progress.  The smoothed rate is an
+// exponentially weighted moving average of the per-chunk rates; the raw
+// numbers are included for callers that want to do their own math.
+type ImageUploadProgress struct {
+	Off          int           // Number of bytes the peer has acknowledged.
+	Total        int           // Size of the image, in bytes.
+	Elapsed      time.Duration // Time since the upload started.
+	LastChunkSz  int           // Size of the most recent chunk, in bytes.
+	LastChunkDur time.Duration // Round trip time of the most recent chunk.
+	Rate         float64       // Smoothed throughput, in bytes per second.
+	Eta          time.Duration // Estimated time remaining; 0 if unknown.
+}
+
 type ImageUploadProgressFn func(c *ImageUploadCmd, r *nmp.ImageUploadRsp)
 type ImageUploadCmd struct {
 	CmdBase
@@ -45,10 +68,48 @@ type ImageUploadCmd struct {
 	Upgrade    bool
 	ProgressCb ImageUploadProgressFn
 	ImageNum   int
+
+	// If set, the upload is planned but no image data is sent.  See
+	// ImageUploadPlan.
+	DryRun bool
+
+	// If set, the round trip time of each upload request is recorded.
+	RecordRtts bool
+
+	progress ImageUploadProgress
+	rtts     []ImageUploadRtt
+}
+
+// The round trip time of a single upload request.
+type ImageUploadRtt struct {
+	Off int           // Offset of the chunk within the image.
+	Len int           // Size of the chunk, in bytes.
+	Rtt time.Duration // Elapsed time from request to response.
+}
+
+// Describes what an image upload would do.  This is produced by a dry run.
+// The device does not report slot sizes, so available space is not verified.
+type ImageUploadPlan struct {
+	Info      *image.ImageInfo // Parsed image header and TLVs.
+	ImageNum  int
+	Slot      int // Slot that the image would be written to.
+	Size      int // Size of the image, in bytes.
+	NumChunks int // Number of upload requests required at the current MTU.
+
+	// Estimated duration of the upload, extrapolated from the round trip
+	// time of the image state read.
+	EstTime time.Duration
 }
 
 type ImageUploadResult struct {
 	Rsps []*nmp.ImageUploadRsp
+
+	// Only set for dry runs.
+	Plan *ImageUploadPlan
+
+	// Only set if the command's RecordRtts field was set.  One entry per
+	// request, in the order sent.
+	Rtts []ImageUploadRtt
 }
 
 func NewImageUploadCmd() *ImageUploadCmd {
@@ -57,12 +118,58 @@ func NewImageUploadCmd() *ImageUploadCmd {
 	}
 }
 
+// Retrieves the current upload progress.  This is typically called from the
+// progress callback.
+func (c *ImageUploadCmd) Progress() ImageUploadProgress {
+	return c.progress
+}
+
+// Retrieves the request round trip times recorded so far.  Empty unless the
+// RecordRtts field is set.
+func (c *ImageUploadCmd) Rtts() []ImageUploadRtt {
+	return c.rtts
+}
+
+// Updates the progress record after a chunk has been acknowledged.
+func (c *ImageUploadCmd) updateProgress(start time.Time, chunkStart time.Time,
+	off int) {
+
+	p := &c.progress
+
+	now := time.Now()
+	chunkSz := off - p.Off
+
+	p.Elapsed = now.Sub(start)
+	p.LastChunkSz = chunkSz
+	p.LastChunkDur = now.Sub(chunkStart)
+	p.Off = off
+
+	if chunkSz > 0 && p.LastChunkDur > 0 {
+		rate := float64(chunkSz) / p.LastChunkDur.Seconds()
+		if p.Rate == 0 {
+			p.Rate = rate
+		} else {
+			p.Rate = IMAGE_UPLOAD_RATE_ALPHA*rate +
+				(1-IMAGE_UPLOAD_RATE_ALPHA)*p.Rate
+		}
+	}
+
+	if p.Rate > 0 && p.Total > p.Off {
+		secs := float64(p.Total-p.Off) / p.Rate
+		p.Eta = time.Duration(secs * float64(time.Second))
+	} else {
+		p.Eta = 0
+	}
+}
+
 func newImageUploadResult() *ImageUploadResult {
 	return &ImageUploadResult{}
 }
 
 func (r *ImageUploadResult) Status() int {
-	if len(r.Rsps) > 0 {
+	if r.Plan != nil {
+		return nmp.NMP_ERR_OK
+	} else if len(r.Rsps) > 0 {
 		return r.Rsps[len(r.Rsps)-1].Rc
 	} else {
 		return nmp.NMP_ERR_EUNKNOWN
@@ -106,8 +213,8 @@ func encodeUploadReq(s sesn.Sesn, hash []byte, upgrade bool, data []byte,
 	return enc, nil
 }
 
-func findChunkLen(s sesn.Sesn, hash []byte, upgrade bool, data []byte,
-	off int, imageNum int, seq uint8) (int, error) {
+func findChunkLen(s sesn.Sesn, mtu int, hash []byte, upgrade bool,
+	data []byte, off int, imageNum int, seq uint8) (int, error) {
 
 	// Let's start by encoding max allowed chunk len and we will see how many
 	// bytes we need to cut
@@ -120,20 +227,27 @@ func findChunkLen(s sesn.Sesn, hash []byte, upgrade bool, data []byte,
 			return 0, err
 		}
 
-		if len(enc) <= s.MtuOut() {
+		if len(enc) <= mtu {
 			break
 		}
 
 		// Encoded length is larger than MTU, we need to make chunk shorter
-		overflow := len(enc) - s.MtuOut()
+		overflow := len(enc) - mtu
 		chunklen -= overflow
+		if chunklen <= 0 {
+			return 0, nil
+		}
 	}
 
 	return chunklen, nil
 }
 
-func nextImageUploadReq(s sesn.Sesn, upgrade bool, data []byte, off int, imageNum int) (
-	*nmp.ImageUploadReq, error) {
+// Builds the next upload request, sized to fit the specified MTU.  Every
+// check uses the same MTU value, even if the link is renegotiated while the
+// request is being built.
+func nextImageUploadReq(s sesn.Sesn, mtu int, upgrade bool, data []byte,
+	off int, imageNum int) (*nmp.ImageUploadReq, error) {
+
 	var hash []byte = nil
 
 	// For 1st chunk we'll need valid data hash
@@ -145,7 +259,8 @@ func nextImageUploadReq(s sesn.Sesn, upgrade bool, data []byte, off int, imageNu
 	seq := nmxutil.NextNmpSeq()
 
 	// Find chunk length
-	chunklen, err := findChunkLen(s, hash, upgrade, data, off, imageNum, seq)
+	chunklen, err := findChunkLen(s, mtu, hash, upgrade, data, off, imageNum,
+		seq)
 	if err != nil {
 		return nil, err
 	}
@@ -154,7 +269,8 @@ func nextImageUploadReq(s sesn.Sesn, upgrade bool, data []byte, off int, imageNu
 	// fit we'll recalculate without hash
 	if off == 0 && chunklen < IMAGE_UPLOAD_MIN_1ST_CHUNK {
 		hash = nil
-		chunklen, err = findChunkLen(s, hash, upgrade, data, off, imageNum, seq)
+		chunklen, err = findChunkLen(s, mtu, hash, upgrade, data, off,
+			imageNum, seq)
 		if err != nil {
 			return nil, err
 		}
@@ -163,9 +279,12 @@ func nextImageUploadReq(s sesn.Sesn, upgrade bool, data []byte, off int, imageNu
 	// If calculated chunk length is not enough to send at least single byte
 	// we can't do much more...
 	if chunklen <= 0 {
-		return nil, fmt.Errorf("Cannot create image upload request; "+
-			"MTU too low to fit any image data; max-payload-size=%d",
-			s.MtuOut())
+		enc, err := encodeUploadReq(s, hash, upgrade, data, off, 1,
+			imageNum, seq)
+		if err != nil {
+			return nil, err
+		}
+		return nil, nmxutil.NewMtuExceededError(len(enc), mtu)
 	}
 
 	r := buildImageUploadReq(len(data), hash, upgrade,
@@ -177,30 +296,164 @@ func nextImageUploadReq(s sesn.Sesn, upgrade bool, data []byte, off int, imageNu
 	if err != nil {
 		return nil, err
 	}
-	if len(enc) > s.MtuOut() {
-		return nil, fmt.Errorf("Invalid chunk length; payload-size=%d "+
-			"max-payload-size=%d", len(enc), s.MtuOut())
+	if len(enc) > mtu {
+		return nil, nmxutil.NewMtuExceededError(len(enc), mtu)
 	}
 
 	return r, nil
 }
 
+// Verifies that the command's data is a well-formed image and that the start
+// offset lies within it.
+func (c *ImageUploadCmd) validate() (*image.ImageInfo, error) {
+	if len(c.Data) == 0 {
+		return nil, fmt.Errorf("Cannot upload empty image")
+	}
+	if c.StartOff < 0 || c.StartOff > len(c.Data) {
+		return nil, fmt.Errorf("Invalid start offset: %d (image size=%d)",
+			c.StartOff, len(c.Data))
+	}
+
+	return image.ParseBytes(c.Data)
+}
+
+// Performs the checks of a real upload without sending any image data.
+func (c *ImageUploadCmd) plan(s sesn.Sesn) (*ImageUploadPlan, error) {
+	info, err := c.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &ImageUploadPlan{
+		Info:     info,
+		ImageNum: c.ImageNum,
+		Slot:     1,
+		Size:     len(c.Data),
+	}
+
+	// Read the device's image state to determine the target slot.
+	cmd := NewImageStateReadCmd()
+	cmd.SetTxOptions(c.TxOptions())
+
+	start := time.Now()
+	res, err := cmd.Run(s)
+	if err != nil {
+		return nil, err
+	}
+	rtt := time.Since(start)
+
+	srsp := res.(*ImageStateReadResult).Rsp
+	if srsp.Rc != 0 {
+		return nil, fmt.Errorf("Image state read failed; rc=%d", srsp.Rc)
+	}
+
+	for _, img := range srsp.Images {
+		if img.Image != c.ImageNum {
+			continue
+		}
+
+		if info.Hash != nil && bytes.Equal(img.Hash, info.Hash) {
+			return nil, fmt.Errorf("Image already present in slot %d",
+				img.Slot)
+		}
+
+		if img.Active {
+			// The image gets written to the slot that isn't running.
+			if img.Slot == 0 {
+				plan.Slot = 1
+			} else {
+				plan.Slot = 0
+			}
+		}
+	}
+
+	// Build each request exactly as a real upload would to count chunks.
+	for off := c.StartOff; off < len(c.Data); {
+		r, err := nextImageUploadReq(s, s.MtuOut(), c.Upgrade, c.Data, off,
+			c.ImageNum)
+		if err != nil {
+			return nil, err
+		}
+
+		off += len(r.Data)
+		plan.NumChunks++
+	}
+
+	plan.EstTime = time.Duration(plan.NumChunks) * rtt
+
+	return plan, nil
+}
+
 func (c *ImageUploadCmd) Run(s sesn.Sesn) (Result, error) {
 	res := newImageUploadResult()
 
+	if c.DryRun {
+		plan, err := c.plan(s)
+		if err != nil {
+			return nil, err
+		}
+
+		res.Plan = plan
+		return res, nil
+	}
+
+	if _, err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	c.progress = ImageUploadProgress{
+		Off:   c.StartOff,
+		Total: len(c.Data),
+	}
+	c.rtts = nil
+
+	mtuRetries := 0
 	for off := c.StartOff; off < len(c.Data); {
-		r, err := nextImageUploadReq(s, c.Upgrade, c.Data, off, c.ImageNum)
+		mtu := s.MtuOut()
+		r, err := nextImageUploadReq(s, mtu, c.Upgrade, c.Data, off,
+			c.ImageNum)
 		if err != nil {
 			return nil, err
 		}
 
+		// The MTU can drop between chunks (e.g., a reconnect negotiates a
+		// smaller value), including while this chunk was being sized.  If it
+		// did, re-chunk against the current MTU rather than letting the
+		// transport split the request across several writes.
+		if s.MtuOut() < mtu {
+			continue
+		}
+
+		chunkStart := time.Now()
 		rsp, err := txReq(s, r.Msg(), &c.CmdBase)
 		if err != nil {
+			// If the MTU shrank after the chunk was sized and the first
+			// fragment was rejected, nothing was sent; re-chunk against the
+			// new MTU.  A partially sent request is not retried.
+			if e, ok := err.(*nmxutil.MtuExceededError); ok && !e.Partial &&
+				mtuRetries < IMAGE_UPLOAD_MTU_RETRIES {
+
+				mtuRetries++
+				continue
+			}
 			return nil, err
 		}
+		mtuRetries = 0
 		irsp := rsp.(*nmp.ImageUploadRsp)
 
+		if c.RecordRtts {
+			c.rtts = append(c.rtts, ImageUploadRtt{
+				Off: off,
+				Len: len(r.Data),
+				Rtt: time.Since(chunkStart),
+			})
+		}
+
 		off = int(irsp.Off)
+		if irsp.Rc == 0 {
+			c.updateProgress(start, chunkStart, off)
+		}
 
 		if c.ProgressCb != nil {
 			c.ProgressCb(c, irsp)
@@ -212,6 +465,7 @@ func (c *ImageUploadCmd) Run(s sesn.Sesn) (Result, error) {
 		}
 	}
 
+	res.Rtts = c.rtts
 	return res, nil
 }
 
@@ -242,6 +496,11 @@ type ImageUpgradeCmd struct {
 	Upgrade     bool
 	ProgressBar *pb.ProgressBar
 	ImageNum    int
+
+	// If set, the upload's request round trip times are recorded in the
+	// result.  Requests from attempts interrupted by a disconnect are
+	// included.
+	RecordRtts bool
 }
 
 type ImageUpgradeResult struct {
@@ -308,9 +567,12 @@ func (c *ImageUpgradeCmd) runUpload(s sesn.Sesn) (*ImageUploadResult, error) {
 		if r.Rc == 0 {
 			startOff = int(r.Off)
 		}
-		c.ProgressCb(uc, r)
+		if c.ProgressCb != nil {
+			c.ProgressCb(uc, r)
+		}
 	}
 
+	var rtts []ImageUploadRtt
 	for {
 		cmd := NewImageUploadCmd()
 		cmd.Data = c.Data
@@ -318,11 +580,15 @@ func (c *ImageUpgradeCmd) runUpload(s sesn.Sesn) (*ImageUploadResult, error) {
 		cmd.Upgrade = c.Upgrade
 		cmd.ProgressCb = progressCb
 		cmd.ImageNum = c.ImageNum
+		cmd.RecordRtts = c.RecordRtts
 		cmd.SetTxOptions(c.TxOptions())
 
 		res, err := cmd.Run(s)
+		rtts = append(rtts, cmd.Rtts()...)
 		if err == nil {
-			return res.(*ImageUploadResult), nil
+			ures := res.(*ImageUploadResult)
+			ures.Rtts = rtts
+			return ures, nil
 		}
 
 		if err := c.rescue(s, err); err != nil {
@@ -330,7 +596,8 @@ func (c *ImageUpgradeCmd) runUpload(s sesn.Sesn) (*ImageUploadResult, error) {
 			return nil, err
 		}
 
-		// Disconnected but recovered; retry last part.
+		// Disconnected but recovered; retry last part.  The reconnected link
+		// may have a different MTU; chunk sizes are recalculated from it.
 	}
 }
 
@@ -0,0 +1,179 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package xact
+
+import (
+	"bytes"
+	"testing"
+
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+	"mynewt.apache.org/newtmgr/nmxact/nmxutil"
+)
+
+// Verifies that every chunk is sized against the MTU in effect when it is
+// sent, even if the MTU drops partway through the upload.
+func TestImageUploadMtuDropBetweenChunks(t *testing.T) {
+	s := newFakeSesn(256)
+
+	var rcvd []byte
+	s.rspFn = func(s *fakeSesn, m *nmp.NmpMsg) (nmp.NmpRsp, error) {
+		rcvd = append(rcvd, m.Body.(*nmp.ImageUploadReq).Data...)
+
+		// Simulate a renegotiation after the second chunk.
+		if len(s.sizes) == 2 {
+			s.setMtu(100)
+		}
+		return ackUpload(m)
+	}
+
+	data := fakeImage(2000)
+
+	c := NewImageUploadCmd()
+	c.Data = data
+
+	res, err := c.Run(s)
+	if err != nil {
+		t.Fatalf("upload failed: %s", err.Error())
+	}
+	if res.Status() != nmp.NMP_ERR_OK {
+		t.Fatalf("unexpected status: %d", res.Status())
+	}
+
+	for i, sz := range s.sizes {
+		if sz > s.mtus[i] {
+			t.Fatalf("request %d exceeds MTU; size=%d mtu=%d",
+				i, sz, s.mtus[i])
+		}
+	}
+	if s.mtus[len(s.mtus)-1] != 100 {
+		t.Fatalf("MTU drop not observed")
+	}
+
+	if !bytes.Equal(rcvd, data) {
+		t.Fatalf("uploaded data does not match image")
+	}
+}
+
+// Verifies that a chunk rejected outright because the MTU shrank is rebuilt
+// against the new MTU.
+func TestImageUploadMtuShrinkRechunk(t *testing.T) {
+	s := newFakeSesn(256)
+
+	attempts := 0
+	s.txHook = func(s *fakeSesn, m *nmp.NmpMsg) error {
+		attempts++
+		if attempts == 1 {
+			// The MTU shrinks after the first chunk was sized; its first
+			// fragment doesn't fit.
+			s.setMtu(100)
+			return nmxutil.NewMtuExceededError(256, 100)
+		}
+		return nil
+	}
+
+	data := fakeImage(1000)
+
+	c := NewImageUploadCmd()
+	c.Data = data
+
+	res, err := c.Run(s)
+	if err != nil {
+		t.Fatalf("upload failed: %s", err.Error())
+	}
+	if res.Status() != nmp.NMP_ERR_OK {
+		t.Fatalf("unexpected status: %d", res.Status())
+	}
+	if attempts != len(s.sizes)+1 {
+		t.Fatalf("unexpected attempt count; attempts=%d sent=%d",
+			attempts, len(s.sizes))
+	}
+	for i, sz := range s.sizes {
+		if sz > 100 {
+			t.Fatalf("request %d exceeds MTU; size=%d", i, sz)
+		}
+	}
+}
+
+// Verifies that a request is not rebuilt if some of its fragments were
+// already sent.
+func TestImageUploadMtuShrinkPartial(t *testing.T) {
+	s := newFakeSesn(256)
+
+	attempts := 0
+	s.txHook = func(s *fakeSesn, m *nmp.NmpMsg) error {
+		attempts++
+		s.setMtu(100)
+
+		err := nmxutil.NewMtuExceededError(156, 100)
+		err.Partial = true
+		return err
+	}
+
+	c := NewImageUploadCmd()
+	c.Data = fakeImage(1000)
+
+	_, err := c.Run(s)
+	if !nmxutil.IsMtuExceeded(err) {
+		t.Fatalf("expected MTU exceeded error; have %v", err)
+	}
+	if attempts != 1 {
+		t.Fatalf("partially sent request was retried; attempts=%d",
+			attempts)
+	}
+}
+
+// Verifies that an MTU too small to carry any image data is reported with a
+// structured error.
+func TestImageUploadMtuTooLow(t *testing.T) {
+	s := newFakeSesn(20)
+
+	c := NewImageUploadCmd()
+	c.Data = fakeImage(1000)
+
+	_, err := c.Run(s)
+	e, ok := err.(*nmxutil.MtuExceededError)
+	if !ok {
+		t.Fatalf("expected MTU exceeded error; have %v", err)
+	}
+	if e.Limit != 20 || e.Attempted <= e.Limit {
+		t.Fatalf("unexpected error contents: %+v", *e)
+	}
+	if len(s.sizes) != 0 {
+		t.Fatalf("request sent despite MTU; count=%d", len(s.sizes))
+	}
+}
+
+// Verifies that a malformed image is rejected before anything is sent.
+func TestImageUploadInvalidImage(t *testing.T) {
+	s := newFakeSesn(256)
+
+	data := fakeImage(1000)
+	data[0] ^= 0xff
+
+	c := NewImageUploadCmd()
+	c.Data = data
+
+	if _, err := c.Run(s); err == nil {
+		t.Fatalf("upload of invalid image succeeded")
+	}
+	if len(s.sizes) != 0 {
+		t.Fatalf("request sent for invalid image; count=%d", len(s.sizes))
+	}
+}
@@ -0,0 +1,124 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package xact
+
+import (
+	"mynewt.apache.org/newtmgr/nmxact/sesn"
+)
+
+// A rc-checking command; every command that embeds CmdBase qualifies.
+type rcCmd interface {
+	Cmd
+	SetCheckRc(check bool)
+}
+
+// Typed wrappers for the commands in the OS (default) management group.
+// Each method executes a single command and returns the decoded response.
+// A nonzero return code is reported as an *nmp.RcError.
+type OsMgmt struct {
+	s    sesn.Sesn
+	opts sesn.TxOptions
+}
+
+func NewOsMgmt(s sesn.Sesn, opts sesn.TxOptions) *OsMgmt {
+	return &OsMgmt{
+		s:    s,
+		opts: opts,
+	}
+}
+
+func (o *OsMgmt) run(c rcCmd) (Result, error) {
+	c.SetTxOptions(o.opts)
+	c.SetCheckRc(true)
+
+	return c.Run(o.s)
+}
+
+// Sends the specified string to the device and returns the echoed reply.
+func (o *OsMgmt) Echo(payload string) (string, error) {
+	c := NewEchoCmd()
+	c.Payload = payload
+
+	res, err := o.run(c)
+	if err != nil {
+		return "", err
+	}
+
+	return res.(*EchoResult).Rsp.Payload, nil
+}
+
+// Reads the device's date and time, as formatted by the device.
+func (o *OsMgmt) DateTime() (string, error) {
+	res, err := o.run(NewDateTimeReadCmd())
+	if err != nil {
+		return "", err
+	}
+
+	return res.(*DateTimeReadResult).Rsp.DateTime, nil
+}
+
+// Sets the device's date and time.  The string must be in the format that
+// the device reports.
+func (o *OsMgmt) SetDateTime(dt string) error {
+	c := NewDateTimeWriteCmd()
+	c.DateTime = dt
+
+	_, err := o.run(c)
+	return err
+}
+
+// Retrieves per-task statistics, keyed by task name.
+func (o *OsMgmt) TaskStats() (map[string]map[string]int, error) {
+	res, err := o.run(NewTaskStatCmd())
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(*TaskStatResult).Rsp.Tasks, nil
+}
+
+// Retrieves per-mempool statistics, keyed by mempool name.
+func (o *OsMgmt) MempoolStats() (map[string]map[string]int, error) {
+	res, err := o.run(NewMempoolStatCmd())
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(*MempoolStatResult).Rsp.Mpools, nil
+}
+
+// Estimates the device's uptime, in OS ticks.  ok is false if the firmware
+// does not report the information required.
+func (o *OsMgmt) Uptime() (ticks uint64, ok bool, err error) {
+	res, err := o.run(NewUptimeCmd())
+	if err != nil {
+		return 0, false, err
+	}
+
+	ures := res.(*UptimeResult)
+	return ures.Ticks, ures.Supported, nil
+}
+
+// Instructs the device to reboot.  The session is not reopened; see
+// ResetAndWaitCmd.
+func (o *OsMgmt) Reset() error {
+	_, err := o.run(NewResetCmd())
+	return err
+}
@@ -29,6 +29,15 @@ import (
 type ResCmd struct {
 	CmdBase
 	MsgParams nmcoap.MsgParams
+
+	// Whether to decode the response payload with the decoder registered
+	// for its content format (see nmcoap.RegisterDecoder).
+	Decode bool
+
+	// Optional; if set, GET requests are made conditional on the resource
+	// having changed since the response cached here (see
+	// sesn.TxRxCoapConditional).
+	EtagCache *nmcoap.EtagCache
 }
 
 func NewResCmd() *ResCmd {
@@ -39,6 +48,14 @@ func NewResCmd() *ResCmd {
 
 type ResResult struct {
 	Rsp coap.Message
+
+	// Only set if the command's Decode field was set.  Holds the raw payload
+	// bytes if no decoder is registered for the response's content format.
+	Value interface{}
+
+	// Indicates that the device replied 2.03 (Valid) to a conditional GET.
+	// Rsp then holds the cached response rather than the device's reply.
+	NotModified bool
 }
 
 func newResResult() *ResResult {
@@ -56,16 +73,23 @@ func (r *ResResult) Status() int {
 }
 
 func (c *ResCmd) Run(s sesn.Sesn) (Result, error) {
-	var rsp coap.Message
-	var err error
-
-	rsp, err = sesn.TxRxCoap(s, c.MsgParams, c.txOptions)
+	rsp, notModified, err := sesn.TxRxCoapConditional(s, c.MsgParams,
+		c.txOptions, c.EtagCache)
 	if err != nil {
 		return nil, err
 	}
 
 	res := newResResult()
 	res.Rsp = rsp
+	res.NotModified = notModified
+
+	if c.Decode {
+		v, err := nmcoap.DecodePayload(rsp)
+		if err != nil {
+			return nil, err
+		}
+		res.Value = v
+	}
 
 	return res, nil
 }
@@ -20,6 +20,9 @@
 package xact
 
 import (
+	"fmt"
+	"time"
+
 	"mynewt.apache.org/newtmgr/nmxact/nmp"
 	"mynewt.apache.org/newtmgr/nmxact/sesn"
 )
@@ -60,3 +63,165 @@ func (c *ResetCmd) Run(s sesn.Sesn) (Result, error) {
 	res.Rsp = srsp
 	return res, nil
 }
+
+const RESET_REBOOT_TMO_DFLT = 60 * time.Second
+const RESET_REOPEN_ITVL = time.Second
+
+// Closes the session and repeatedly attempts to reopen it until the device
+// accepts a new session or the timeout expires.  aborted is polled between
+// attempts; a non-nil return value cancels the procedure.
+func awaitReopen(s sesn.Sesn, timeout time.Duration,
+	aborted func() error) error {
+
+	if s.IsOpen() {
+		s.Close()
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		if err := aborted(); err != nil {
+			return err
+		}
+
+		err := s.Open()
+		if err == nil {
+			return nil
+		}
+
+		if !time.Now().Add(RESET_REOPEN_ITVL).Before(deadline) {
+			return fmt.Errorf("Device did not come back within %s: %s",
+				timeout, err.Error())
+		}
+		time.Sleep(RESET_REOPEN_ITVL)
+	}
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// $reset and wait                                                          //
+//////////////////////////////////////////////////////////////////////////////
+
+const RESET_RATE_SAMPLE_ITVL_DFLT = time.Second
+
+// Without a reset, the device's uptime must advance by at least this
+// fraction of the elapsed wall time.  Allows for error in the tick rate
+// estimate and for request latency.
+const RESET_UPTIME_TOLERANCE = 0.9
+
+// Resets the device, waits for it to come back, and verifies that it
+// actually rebooted by checking its uptime (see UptimeCmd).  Two uptime
+// samples taken before the reset yield the device's tick rate.  Had the
+// device not reset, its uptime after it came back would be the first
+// sample plus the elapsed wall time; an uptime short of that indicates a
+// reboot.  If the firmware doesn't report uptime, or the uptime doesn't
+// advance between the samples, the reset is not verified and the result's
+// Verified field is false.
+type ResetAndWaitCmd struct {
+	CmdBase
+
+	// How long to wait for the device to accept a new session after the
+	// reset.
+	RebootTimeout time.Duration
+
+	// The interval between the uptime samples taken before the reset.
+	RateSampleItvl time.Duration
+}
+
+type ResetAndWaitResult struct {
+	Rsp *nmp.ResetRsp
+
+	// Uptime estimates, in OS ticks, taken before the reset and after the
+	// device came back.  Only meaningful if Verified is set.
+	Before uint64
+	After  uint64
+
+	// The device's estimated tick rate, in ticks per second.  Only
+	// meaningful if Verified is set.
+	TicksPerSec float64
+
+	// Whether the uptime was available both before and after.
+	Verified bool
+}
+
+func NewResetAndWaitCmd() *ResetAndWaitCmd {
+	return &ResetAndWaitCmd{
+		CmdBase:        NewCmdBase(),
+		RebootTimeout:  RESET_REBOOT_TMO_DFLT,
+		RateSampleItvl: RESET_RATE_SAMPLE_ITVL_DFLT,
+	}
+}
+
+func newResetAndWaitResult() *ResetAndWaitResult {
+	return &ResetAndWaitResult{}
+}
+
+func (r *ResetAndWaitResult) Status() int {
+	return 0
+}
+
+func (c *ResetAndWaitCmd) Run(s sesn.Sesn) (Result, error) {
+	res := newResetAndWaitResult()
+
+	before, okBefore, err := Uptime(s, c.TxOptions())
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+
+	// Estimate the tick rate from a second sample.
+	var rate float64
+	if okBefore {
+		time.Sleep(c.RateSampleItvl)
+		if err := c.aborted(); err != nil {
+			return nil, err
+		}
+
+		second, ok, err := Uptime(s, c.TxOptions())
+		if err != nil {
+			return nil, err
+		}
+		if ok && second > before {
+			rate = float64(second-before) / time.Since(start).Seconds()
+			before = second
+			start = time.Now()
+		}
+	}
+
+	r := nmp.NewResetReq()
+	rsp, err := txReq(s, r.Msg(), &c.CmdBase)
+	if err != nil {
+		// The device may reset before its response is delivered.
+		if s.IsOpen() {
+			return nil, err
+		}
+	} else {
+		res.Rsp = rsp.(*nmp.ResetRsp)
+	}
+
+	err = awaitReopen(s, c.RebootTimeout, c.aborted)
+	if err != nil {
+		return nil, err
+	}
+
+	after, okAfter, err := Uptime(s, c.TxOptions())
+	if err != nil {
+		return nil, err
+	}
+	elapsed := time.Since(start)
+
+	if rate > 0 && okAfter {
+		res.Before = before
+		res.After = after
+		res.TicksPerSec = rate
+		res.Verified = true
+
+		// The uptime the device would report had it not reset.
+		expected := before +
+			uint64(rate*elapsed.Seconds()*RESET_UPTIME_TOLERANCE)
+		if after >= expected {
+			return nil, fmt.Errorf("Device did not reset; uptime "+
+				"before=%d after=%d elapsed=%s", before, after, elapsed)
+		}
+	}
+
+	return res, nil
+}
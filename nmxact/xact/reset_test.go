@@ -0,0 +1,108 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package xact
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+)
+
+// A device with a 1 kHz tick whose uptime is reported via task statistics.
+type fakeDevice struct {
+	boot     time.Time
+	resets   bool
+	bootTime time.Duration
+}
+
+func (d *fakeDevice) rsp(s *fakeSesn, m *nmp.NmpMsg) (nmp.NmpRsp, error) {
+	switch m.Body.(type) {
+	case *nmp.TaskStatReq:
+		rsp := nmp.NewTaskStatRsp()
+		rsp.Hdr().Seq = m.Hdr.Seq
+		rsp.Tasks = map[string]map[string]int{
+			"idle": {"runtime": int(time.Since(d.boot) / time.Millisecond)},
+		}
+		return rsp, nil
+
+	case *nmp.ResetReq:
+		if d.resets {
+			// The device's clock restarts, then it takes a while before it
+			// accepts requests again.
+			d.boot = time.Now()
+			time.Sleep(d.bootTime)
+		}
+		rsp := nmp.NewResetRsp()
+		rsp.Hdr().Seq = m.Hdr.Seq
+		return rsp, nil
+
+	default:
+		return nil, fmt.Errorf("unexpected request: %T", m.Body)
+	}
+}
+
+func runResetAndWait(d *fakeDevice) (*ResetAndWaitResult, error) {
+	s := newFakeSesn(256)
+	s.rspFn = d.rsp
+
+	c := NewResetAndWaitCmd()
+	c.RateSampleItvl = 50 * time.Millisecond
+
+	res, err := c.Run(s)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*ResetAndWaitResult), nil
+}
+
+// Verifies that a reset is detected even if the device had only just
+// booted, so that its uptime after the reset exceeds its uptime before.
+func TestResetAndWaitRecentBoot(t *testing.T) {
+	d := &fakeDevice{
+		boot:     time.Now(),
+		resets:   true,
+		bootTime: 100 * time.Millisecond,
+	}
+
+	res, err := runResetAndWait(d)
+	if err != nil {
+		t.Fatalf("ResetAndWait: %s", err.Error())
+	}
+	if !res.Verified {
+		t.Fatalf("reset not verified")
+	}
+	if res.After < res.Before {
+		t.Fatalf("test precondition not met; before=%d after=%d",
+			res.Before, res.After)
+	}
+}
+
+// Verifies that a device that ignores the reset request is reported.
+func TestResetAndWaitNoReset(t *testing.T) {
+	d := &fakeDevice{
+		boot: time.Now().Add(-time.Hour),
+	}
+
+	if _, err := runResetAndWait(d); err == nil {
+		t.Fatalf("missing reset not detected")
+	}
+}
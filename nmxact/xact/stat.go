@@ -20,6 +20,9 @@
 package xact
 
 import (
+	"fmt"
+	"sort"
+
 	"mynewt.apache.org/newtmgr/nmxact/nmp"
 	"mynewt.apache.org/newtmgr/nmxact/sesn"
 )
@@ -105,3 +108,194 @@ func (c *StatListCmd) Run(s sesn.Sesn) (Result, error) {
 	res.Rsp = srsp
 	return res, nil
 }
+
+//////////////////////////////////////////////////////////////////////////////
+// $helpers                                                                 //
+//////////////////////////////////////////////////////////////////////////////
+
+// Converts a decoded CBOR stat value to an unsigned counter.
+func statVal(v interface{}) (uint64, error) {
+	switch n := v.(type) {
+	case uint64:
+		return n, nil
+	case uint32:
+		return uint64(n), nil
+	case uint16:
+		return uint64(n), nil
+	case uint8:
+		return uint64(n), nil
+	case uint:
+		return uint64(n), nil
+	case int64:
+		if n >= 0 {
+			return uint64(n), nil
+		}
+	case int32:
+		if n >= 0 {
+			return uint64(n), nil
+		}
+	case int:
+		if n >= 0 {
+			return uint64(n), nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid stat value: %v (%T)", v, v)
+}
+
+// StatsList retrieves the names of the stat groups exposed by the device,
+// sorted alphabetically.
+func StatsList(s sesn.Sesn, opts sesn.TxOptions) ([]string, error) {
+	c := NewStatListCmd()
+	c.SetTxOptions(opts)
+
+	res, err := c.Run(s)
+	if err != nil {
+		return nil, err
+	}
+
+	sres := res.(*StatListResult)
+	if sres.Status() != 0 {
+		return nil, fmt.Errorf("stat list failed; rc=%d", sres.Status())
+	}
+
+	names := append([]string(nil), sres.Rsp.List...)
+	sort.Strings(names)
+	return names, nil
+}
+
+// Reads the specified stat group.  A nonzero response code is reported via
+// the rc return value rather than as an error.
+func statsRead(s sesn.Sesn, group string,
+	opts sesn.TxOptions) (map[string]uint64, int, error) {
+
+	c := NewStatReadCmd()
+	c.SetTxOptions(opts)
+	c.Name = group
+
+	res, err := c.Run(s)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sres := res.(*StatReadResult)
+	if sres.Status() != 0 {
+		return nil, sres.Status(), nil
+	}
+
+	m := make(map[string]uint64, len(sres.Rsp.Fields))
+	for name, v := range sres.Rsp.Fields {
+		val, err := statVal(v)
+		if err != nil {
+			return nil, 0, fmt.Errorf("stat group \"%s\", field \"%s\": %s",
+				group, name, err.Error())
+		}
+		m[name] = val
+	}
+
+	return m, 0, nil
+}
+
+// StatsRead reads the specified stat group and returns a map of counter
+// names to values.
+func StatsRead(s sesn.Sesn, group string,
+	opts sesn.TxOptions) (map[string]uint64, error) {
+
+	m, rc, err := statsRead(s, group, opts)
+	if err != nil {
+		return nil, err
+	}
+	if rc != 0 {
+		return nil, fmt.Errorf("stat read failed; group=\"%s\" rc=%d",
+			group, rc)
+	}
+
+	return m, nil
+}
+
+// StatsReadAll reads every stat group the device exposes.  The result maps
+// group names to counter maps.  Groups that disappear between the list and
+// the read (the device reports ENOENT) are omitted.
+func StatsReadAll(s sesn.Sesn,
+	opts sesn.TxOptions) (map[string]map[string]uint64, error) {
+
+	names, err := StatsList(s, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	all := make(map[string]map[string]uint64, len(names))
+	for _, name := range names {
+		m, rc, err := statsRead(s, name, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		switch rc {
+		case nmp.NMP_ERR_OK:
+			all[name] = m
+		case nmp.NMP_ERR_ENOENT:
+			// Group removed after it was listed.
+		default:
+			return nil, fmt.Errorf("stat read failed; group=\"%s\" rc=%d",
+				name, rc)
+		}
+	}
+
+	return all, nil
+}
+
+// Reads a stat group repeatedly and reports how much each counter grew
+// between reads, in effect clearing the counters on every read without
+// touching the device.  The stat group has no clear command, so clearing
+// cannot be done on the device; computing deltas from consecutive
+// snapshots also avoids the gap that a read followed by a separate clear
+// would leave.
+type StatsSampler struct {
+	s     sesn.Sesn
+	group string
+	opts  sesn.TxOptions
+	prev  map[string]uint64
+}
+
+func NewStatsSampler(s sesn.Sesn, group string,
+	opts sesn.TxOptions) *StatsSampler {
+
+	return &StatsSampler{
+		s:     s,
+		group: group,
+		opts:  opts,
+	}
+}
+
+// Reads the stat group.  Returns the snapshot that was read and, for each
+// counter, the amount it grew since the previous call.  On the first call,
+// the deltas equal the snapshot.  A counter that went down (e.g., because
+// the device rebooted) is assumed to have restarted from zero.
+func (ss *StatsSampler) ReadAndClear() (snapshot map[string]uint64,
+	delta map[string]uint64, err error) {
+
+	snapshot, err = StatsRead(ss.s, ss.group, ss.opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	delta = make(map[string]uint64, len(snapshot))
+	for name, cur := range snapshot {
+		prev := ss.prev[name]
+		if cur >= prev {
+			delta[name] = cur - prev
+		} else {
+			delta[name] = cur
+		}
+	}
+
+	ss.prev = snapshot
+	return snapshot, delta, nil
+}
+
+// Discards the previous snapshot, so that the next read reports counters
+// relative to zero.
+func (ss *StatsSampler) Reset() {
+	ss.prev = nil
+}
@@ -0,0 +1,378 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package xact
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"mynewt.apache.org/newtmgr/nmxact/image"
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+	"mynewt.apache.org/newtmgr/nmxact/sesn"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// $ota                                                                     //
+//////////////////////////////////////////////////////////////////////////////
+
+// Determines how a newly uploaded image is activated.
+type UpgradePolicy int
+
+const (
+	// Mark the image for a test boot, and confirm it once the device comes
+	// back running it.  If the device fails to come back, the boot loader
+	// reverts to the old image on the next reset.
+	UPGRADE_POLICY_TEST_CONFIRM UpgradePolicy = iota
+
+	// Mark the image as permanent before resetting.
+	UPGRADE_POLICY_CONFIRM
+)
+
+type UpgradePhase int
+
+const (
+	UPGRADE_PHASE_STATE_READ UpgradePhase = iota
+	UPGRADE_PHASE_UPLOAD
+	UPGRADE_PHASE_MARK
+	UPGRADE_PHASE_RESET
+	UPGRADE_PHASE_REBOOT_WAIT
+	UPGRADE_PHASE_VERIFY
+	UPGRADE_PHASE_CONFIRM
+	UPGRADE_PHASE_ROLLBACK
+	UPGRADE_PHASE_DONE
+)
+
+var upgradePhaseNameMap = map[UpgradePhase]string{
+	UPGRADE_PHASE_STATE_READ:  "state_read",
+	UPGRADE_PHASE_UPLOAD:      "upload",
+	UPGRADE_PHASE_MARK:        "mark",
+	UPGRADE_PHASE_RESET:       "reset",
+	UPGRADE_PHASE_REBOOT_WAIT: "reboot_wait",
+	UPGRADE_PHASE_VERIFY:      "verify",
+	UPGRADE_PHASE_CONFIRM:     "confirm",
+	UPGRADE_PHASE_ROLLBACK:    "rollback",
+	UPGRADE_PHASE_DONE:        "done",
+}
+
+func (p UpgradePhase) String() string {
+	s := upgradePhaseNameMap[p]
+	if s == "" {
+		s = "???"
+	}
+	return s
+}
+
+type UpgradePhaseFn func(c *UpgradeCmd, phase UpgradePhase)
+
+// Performs a complete over-the-air upgrade:
+//  1. Read the image state, noting the running image.
+//  2. Upload the new image (see ImageUpgradeCmd).
+//  3. Mark the new image for test or as permanent, depending on the policy.
+//  4. Reset the device and wait for it to come back.
+//  5. Verify that the new image is running.  If it is not, mark the old image
+//     as permanent (rollback) and fail.
+//  6. For UPGRADE_POLICY_TEST_CONFIRM, confirm the new image.
+type UpgradeCmd struct {
+	CmdBase
+	Data     []byte
+	Policy   UpgradePolicy
+	NoErase  bool
+	ImageNum int
+
+	// How long to wait for the device to accept a new session after the
+	// reset.
+	RebootTimeout time.Duration
+
+	// Optional; executed when each phase starts.
+	PhaseCb UpgradePhaseFn
+
+	// Optional; executed for each upload response.
+	UploadProgressCb ImageUploadProgressFn
+
+	// The current phase and the sub-command in progress; protected by
+	// CmdBase.mtx.
+	phase UpgradePhase
+	cur   Cmd
+}
+
+type UpgradeResult struct {
+	OldHash []byte
+	NewHash []byte
+
+	UpgradeRes *ImageUpgradeResult
+
+	// Image state reported after the device came back.
+	StateRsp *nmp.ImageStateRsp
+}
+
+func NewUpgradeCmd() *UpgradeCmd {
+	return &UpgradeCmd{
+		CmdBase:       NewCmdBase(),
+		Policy:        UPGRADE_POLICY_TEST_CONFIRM,
+		RebootTimeout: RESET_REBOOT_TMO_DFLT,
+	}
+}
+
+func newUpgradeResult() *UpgradeResult {
+	return &UpgradeResult{}
+}
+
+func (r *UpgradeResult) Status() int {
+	if r.StateRsp != nil {
+		return r.StateRsp.Rc
+	} else {
+		return nmp.NMP_ERR_EUNKNOWN
+	}
+}
+
+// Retrieves the phase currently in progress, or the phase that failed.
+func (c *UpgradeCmd) Phase() UpgradePhase {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return c.phase
+}
+
+func (c *UpgradeCmd) Abort() error {
+	// Mark this command aborted first, so that runSub() doesn't start a new
+	// sub-command after the current one is read.
+	err := c.CmdBase.Abort()
+
+	c.mtx.Lock()
+	cur := c.cur
+	c.mtx.Unlock()
+
+	if cur != nil {
+		cur.Abort()
+	}
+	return err
+}
+
+func (c *UpgradeCmd) enterPhase(phase UpgradePhase) error {
+	if err := c.aborted(); err != nil {
+		return err
+	}
+
+	c.mtx.Lock()
+	c.phase = phase
+	c.mtx.Unlock()
+
+	if c.PhaseCb != nil {
+		c.PhaseCb(c, phase)
+	}
+	return nil
+}
+
+func (c *UpgradeCmd) phaseErr(err error) error {
+	return fmt.Errorf("Upgrade failed in %s phase: %s",
+		c.Phase().String(), err.Error())
+}
+
+// Runs a sub-command on behalf of this one.
+func (c *UpgradeCmd) runSub(s sesn.Sesn, cmd Cmd) (Result, error) {
+	cmd.SetTxOptions(c.TxOptions())
+
+	c.mtx.Lock()
+	if err := c.abortErr; err != nil {
+		c.mtx.Unlock()
+		return nil, err
+	}
+	c.cur = cmd
+	c.mtx.Unlock()
+
+	defer func() {
+		c.mtx.Lock()
+		c.cur = nil
+		c.mtx.Unlock()
+	}()
+
+	res, err := cmd.Run(s)
+	if err != nil {
+		return nil, err
+	}
+	if res.Status() != nmp.NMP_ERR_OK {
+		return nil, fmt.Errorf("Request failed; rc=%d (%s)",
+			res.Status(), nmp.NmpErrToString(res.Status()))
+	}
+
+	return res, nil
+}
+
+func (c *UpgradeCmd) readState(s sesn.Sesn) (*nmp.ImageStateRsp, error) {
+	res, err := c.runSub(s, NewImageStateReadCmd())
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(*ImageStateReadResult).Rsp, nil
+}
+
+func (c *UpgradeCmd) writeState(s sesn.Sesn, hash []byte,
+	confirm bool) error {
+
+	cmd := NewImageStateWriteCmd()
+	cmd.Hash = hash
+	cmd.Confirm = confirm
+
+	_, err := c.runSub(s, cmd)
+	return err
+}
+
+// Retrieves the entry for the running image, or nil if there is none.
+func (c *UpgradeCmd) activeImage(
+	rsp *nmp.ImageStateRsp) *nmp.ImageStateEntry {
+
+	for i := range rsp.Images {
+		img := &rsp.Images[i]
+		if img.Image == c.ImageNum && img.Active {
+			return img
+		}
+	}
+
+	return nil
+}
+
+func (c *UpgradeCmd) Run(s sesn.Sesn) (Result, error) {
+	info, err := image.ParseBytes(c.Data)
+	if err != nil {
+		return nil, err
+	}
+	if info.Hash == nil {
+		return nil, fmt.Errorf("Image does not contain a SHA256 TLV")
+	}
+
+	res := newUpgradeResult()
+	res.NewHash = info.Hash
+
+	// Note the running image so that it can be restored on failure.
+	if err := c.enterPhase(UPGRADE_PHASE_STATE_READ); err != nil {
+		return nil, err
+	}
+	srsp, err := c.readState(s)
+	if err != nil {
+		return nil, c.phaseErr(err)
+	}
+	if old := c.activeImage(srsp); old != nil {
+		if bytes.Equal(old.Hash, info.Hash) {
+			return nil, fmt.Errorf("Image already running")
+		}
+		res.OldHash = old.Hash
+	}
+
+	if err := c.enterPhase(UPGRADE_PHASE_UPLOAD); err != nil {
+		return nil, err
+	}
+	ucmd := NewImageUpgradeCmd()
+	ucmd.Data = c.Data
+	ucmd.NoErase = c.NoErase
+	ucmd.ImageNum = c.ImageNum
+	ucmd.ProgressCb = c.UploadProgressCb
+	ures, err := c.runSub(s, ucmd)
+	if err != nil {
+		return nil, c.phaseErr(err)
+	}
+	res.UpgradeRes = ures.(*ImageUpgradeResult)
+
+	if err := c.enterPhase(UPGRADE_PHASE_MARK); err != nil {
+		return nil, err
+	}
+	confirm := c.Policy == UPGRADE_POLICY_CONFIRM
+	if err := c.writeState(s, info.Hash, confirm); err != nil {
+		return nil, c.phaseErr(err)
+	}
+
+	// The device may reset before its response is delivered; a failure here
+	// is only reported if the device is still reachable.
+	if err := c.enterPhase(UPGRADE_PHASE_RESET); err != nil {
+		return nil, err
+	}
+	if _, err := c.runSub(s, NewResetCmd()); err != nil && s.IsOpen() {
+		return nil, c.phaseErr(err)
+	}
+
+	if err := c.enterPhase(UPGRADE_PHASE_REBOOT_WAIT); err != nil {
+		return nil, err
+	}
+	err = awaitReopen(s, c.RebootTimeout, c.aborted)
+	if err != nil {
+		return nil, c.phaseErr(err)
+	}
+
+	if err := c.enterPhase(UPGRADE_PHASE_VERIFY); err != nil {
+		return nil, err
+	}
+	srsp, err = c.readState(s)
+	if err != nil {
+		return nil, c.phaseErr(err)
+	}
+	res.StateRsp = srsp
+
+	if cur := c.activeImage(srsp); cur == nil ||
+		!bytes.Equal(cur.Hash, info.Hash) {
+
+		verr := fmt.Errorf("Device is not running the new image")
+		if res.OldHash == nil {
+			return nil, c.phaseErr(verr)
+		}
+
+		// Make sure the device stays on the old image.
+		if err := c.enterPhase(UPGRADE_PHASE_ROLLBACK); err != nil {
+			return nil, err
+		}
+		if err := c.writeState(s, res.OldHash, true); err != nil {
+			return nil, c.phaseErr(err)
+		}
+		return nil, fmt.Errorf("Upgrade rolled back: %s", verr.Error())
+	}
+
+	if c.Policy == UPGRADE_POLICY_TEST_CONFIRM {
+		if err := c.enterPhase(UPGRADE_PHASE_CONFIRM); err != nil {
+			return nil, err
+		}
+		if err := c.writeState(s, info.Hash, true); err != nil {
+			return nil, c.phaseErr(err)
+		}
+	}
+
+	if err := c.enterPhase(UPGRADE_PHASE_DONE); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Upgrades the device to the specified image using the specified policy.
+// This is a convenience wrapper around UpgradeCmd.
+func Upgrade(s sesn.Sesn, data []byte, policy UpgradePolicy,
+	phaseCb UpgradePhaseFn) (*UpgradeResult, error) {
+
+	c := NewUpgradeCmd()
+	c.Data = data
+	c.Policy = policy
+	c.PhaseCb = phaseCb
+
+	res, err := c.Run(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(*UpgradeResult), nil
+}
@@ -0,0 +1,235 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package xact
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"mynewt.apache.org/newtmgr/nmxact/image"
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+)
+
+// A device that runs the image in slot 0.  An uploaded image is booted on
+// the next reset, unless the device is set to stay on the old image.
+type upgradeDevice struct {
+	running  []byte
+	newHash  []byte
+	uploaded bool
+	stayOld  bool
+
+	// Every image state write, in order.
+	writes []nmp.ImageStateWriteReq
+}
+
+func newUpgradeDevice(data []byte) *upgradeDevice {
+	info, err := image.ParseBytes(data)
+	if err != nil {
+		panic(err)
+	}
+
+	old := sha256.Sum256([]byte("old image"))
+	return &upgradeDevice{
+		running: old[:],
+		newHash: info.Hash,
+	}
+}
+
+func (d *upgradeDevice) rsp(s *fakeSesn, m *nmp.NmpMsg) (nmp.NmpRsp, error) {
+	var rsp nmp.NmpRsp
+
+	switch req := m.Body.(type) {
+	case *nmp.ImageStateReadReq:
+		srsp := nmp.NewImageStateRsp()
+		srsp.Images = []nmp.ImageStateEntry{
+			{Image: 0, Slot: 0, Hash: d.running, Active: true},
+		}
+		if d.uploaded {
+			srsp.Images = append(srsp.Images,
+				nmp.ImageStateEntry{Image: 0, Slot: 1, Hash: d.newHash})
+		}
+		rsp = srsp
+
+	case *nmp.ImageStateWriteReq:
+		d.writes = append(d.writes, *req)
+		rsp = nmp.NewImageStateRsp()
+
+	case *nmp.ImageEraseReq:
+		rsp = nmp.NewImageEraseRsp()
+
+	case *nmp.ImageUploadReq:
+		d.uploaded = true
+		return ackUpload(m)
+
+	case *nmp.ResetReq:
+		if d.uploaded && !d.stayOld {
+			d.running = d.newHash
+		}
+		rsp = nmp.NewResetRsp()
+
+	default:
+		return nil, fmt.Errorf("unexpected request: %T", m.Body)
+	}
+
+	rsp.Hdr().Seq = m.Hdr.Seq
+	return rsp, nil
+}
+
+func newTestUpgradeCmd(data []byte, policy UpgradePolicy) *UpgradeCmd {
+	c := NewUpgradeCmd()
+	c.Data = data
+	c.Policy = policy
+	c.RebootTimeout = 5 * time.Second
+	return c
+}
+
+// Verifies the requests sent by a successful upgrade under each policy.
+func TestUpgradePolicies(t *testing.T) {
+	data := fakeImage(1000)
+
+	for _, policy := range []UpgradePolicy{
+		UPGRADE_POLICY_TEST_CONFIRM,
+		UPGRADE_POLICY_CONFIRM,
+	} {
+		d := newUpgradeDevice(data)
+		s := newFakeSesn(256)
+		s.rspFn = d.rsp
+
+		c := newTestUpgradeCmd(data, policy)
+
+		var phases []UpgradePhase
+		c.PhaseCb = func(c *UpgradeCmd, phase UpgradePhase) {
+			phases = append(phases, phase)
+		}
+
+		// The progress callback is optional.
+		progress := 0
+		if policy == UPGRADE_POLICY_TEST_CONFIRM {
+			c.UploadProgressCb = func(uc *ImageUploadCmd,
+				r *nmp.ImageUploadRsp) {
+
+				progress++
+			}
+		}
+
+		res, err := c.Run(s)
+		if err != nil {
+			t.Fatalf("policy %d: Run: %s", policy, err.Error())
+		}
+		if !bytes.Equal(res.(*UpgradeResult).NewHash, d.newHash) {
+			t.Fatalf("policy %d: wrong new hash in result", policy)
+		}
+		if c.Phase() != UPGRADE_PHASE_DONE {
+			t.Fatalf("policy %d: ended in phase %s", policy, c.Phase())
+		}
+		if phases[len(phases)-1] != UPGRADE_PHASE_DONE {
+			t.Fatalf("policy %d: last reported phase %s",
+				policy, phases[len(phases)-1])
+		}
+
+		// TEST_CONFIRM marks the image for test, then confirms it once it
+		// runs; CONFIRM marks it permanent up front.
+		var confirms []bool
+		for _, w := range d.writes {
+			if !bytes.Equal(w.Hash, d.newHash) {
+				t.Fatalf("policy %d: state write for the wrong image",
+					policy)
+			}
+			confirms = append(confirms, w.Confirm)
+		}
+		want := []bool{true}
+		if policy == UPGRADE_POLICY_TEST_CONFIRM {
+			want = []bool{false, true}
+			if progress == 0 {
+				t.Fatalf("policy %d: upload progress not reported", policy)
+			}
+		}
+		if fmt.Sprint(confirms) != fmt.Sprint(want) {
+			t.Fatalf("policy %d: state write confirms %v; want %v",
+				policy, confirms, want)
+		}
+	}
+}
+
+// Verifies that a device coming back on its old image is kept there and the
+// upgrade fails.
+func TestUpgradeRollback(t *testing.T) {
+	data := fakeImage(1000)
+	d := newUpgradeDevice(data)
+	d.stayOld = true
+	old := d.running
+
+	s := newFakeSesn(256)
+	s.rspFn = d.rsp
+
+	c := newTestUpgradeCmd(data, UPGRADE_POLICY_TEST_CONFIRM)
+	_, err := c.Run(s)
+	if err == nil || !strings.Contains(err.Error(), "rolled back") {
+		t.Fatalf("expected rollback error; got %v", err)
+	}
+	if c.Phase() != UPGRADE_PHASE_ROLLBACK {
+		t.Fatalf("failed in phase %s", c.Phase())
+	}
+
+	last := d.writes[len(d.writes)-1]
+	if !bytes.Equal(last.Hash, old) || !last.Confirm {
+		t.Fatalf("old image not confirmed")
+	}
+}
+
+// Verifies that an abort interrupts the wait for the device to come back.
+// Run with -race.
+func TestUpgradeAbortRebootWait(t *testing.T) {
+	data := fakeImage(1000)
+	d := newUpgradeDevice(data)
+
+	s := newFakeSesn(256)
+	s.rspFn = d.rsp
+	s.openFn = func() error { return fmt.Errorf("device not back yet") }
+
+	c := newTestUpgradeCmd(data, UPGRADE_POLICY_TEST_CONFIRM)
+	c.RebootTimeout = time.Minute
+	c.PhaseCb = func(c *UpgradeCmd, phase UpgradePhase) {
+		if phase == UPGRADE_PHASE_REBOOT_WAIT {
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				c.Abort()
+			}()
+		}
+	}
+
+	start := time.Now()
+	if _, err := c.Run(s); err == nil {
+		t.Fatalf("aborted upgrade succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 3*RESET_REOPEN_ITVL {
+		t.Fatalf("abort took %s to take effect", elapsed)
+	}
+	if c.Phase() != UPGRADE_PHASE_REBOOT_WAIT {
+		t.Fatalf("aborted in phase %s", c.Phase())
+	}
+	if len(d.writes) != 1 {
+		t.Fatalf("unexpected state writes after abort: %d", len(d.writes))
+	}
+}
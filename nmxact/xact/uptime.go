@@ -0,0 +1,102 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package xact
+
+import (
+	"mynewt.apache.org/newtmgr/nmxact/nmp"
+	"mynewt.apache.org/newtmgr/nmxact/sesn"
+)
+
+// Mynewt firmware does not expose an uptime or boot counter through NMP.
+// Instead, uptime is estimated from the task statistics: every OS tick is
+// charged to some task (the idle task included), so the sum of the tasks'
+// run times approximates the number of ticks since boot.  Firmware built
+// without task run time accounting does not report the "runtime" field; in
+// that case, the uptime is unsupported.
+
+type UptimeCmd struct {
+	CmdBase
+}
+
+func NewUptimeCmd() *UptimeCmd {
+	return &UptimeCmd{
+		CmdBase: NewCmdBase(),
+	}
+}
+
+type UptimeResult struct {
+	Rsp *nmp.TaskStatRsp
+
+	// Whether the device reported task run times.  If false, Ticks is
+	// meaningless.
+	Supported bool
+
+	// Estimated OS ticks since boot.
+	Ticks uint64
+}
+
+func newUptimeResult() *UptimeResult {
+	return &UptimeResult{}
+}
+
+func (r *UptimeResult) Status() int {
+	return r.Rsp.Rc
+}
+
+func (c *UptimeCmd) Run(s sesn.Sesn) (Result, error) {
+	r := nmp.NewTaskStatReq()
+
+	rsp, err := txReq(s, r.Msg(), &c.CmdBase)
+	if err != nil {
+		return nil, err
+	}
+	srsp := rsp.(*nmp.TaskStatRsp)
+
+	res := newUptimeResult()
+	res.Rsp = srsp
+
+	if srsp.Rc == nmp.NMP_ERR_OK {
+		for _, t := range srsp.Tasks {
+			if rt, ok := t["runtime"]; ok && rt >= 0 {
+				res.Supported = true
+				res.Ticks += uint64(rt)
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// Estimates the device's uptime, in OS ticks.  ok is false if the firmware
+// does not report the information required.
+func Uptime(s sesn.Sesn, opt sesn.TxOptions) (ticks uint64, ok bool,
+	err error) {
+
+	c := NewUptimeCmd()
+	c.SetTxOptions(opt)
+
+	res, err := c.Run(s)
+	if err != nil {
+		return 0, false, err
+	}
+
+	ures := res.(*UptimeResult)
+	return ures.Ticks, ures.Supported, nil
+}
@@ -27,21 +27,27 @@ import (
 func txReq(s sesn.Sesn, m *nmp.NmpMsg, c *CmdBase) (
 	nmp.NmpRsp, error) {
 
-	if c.abortErr != nil {
-		return nil, c.abortErr
+	if err := c.beginReq(s, m.Hdr.Seq); err != nil {
+		return nil, err
 	}
-
-	c.curNmpSeq = m.Hdr.Seq
-	c.curSesn = s
-	defer func() {
-		c.curNmpSeq = 0
-		c.curSesn = nil
-	}()
+	defer c.endReq()
 
 	rsp, err := sesn.TxRxMgmt(s, m, c.TxOptions())
+
+	// An abort that arrived before the request's listener was registered
+	// could not cancel it; honor it now.
+	if abortErr := c.aborted(); abortErr != nil {
+		return nil, abortErr
+	}
 	if err != nil {
 		return nil, err
 	}
 
+	if c.checkRc {
+		if err := nmp.CheckRc(rsp); err != nil {
+			return nil, err
+		}
+	}
+
 	return rsp, nil
 }